@@ -1,21 +1,34 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"regexp"
 	"runtime"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"github.com/kvaps/kube-fencing/pkg/audit"
 	"github.com/kvaps/kube-fencing/pkg/controller"
+	"github.com/kvaps/kube-fencing/pkg/controller/job"
 	"github.com/kvaps/kube-fencing/pkg/controller/node"
+	"github.com/kvaps/kube-fencing/pkg/status"
+	"github.com/kvaps/kube-fencing/pkg/util"
+	"github.com/kvaps/kube-fencing/pkg/webhook"
 	"github.com/kvaps/kube-fencing/version"
 
 	//"github.com/operator-framework/operator-sdk/pkg/k8sutil"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
@@ -29,6 +42,46 @@ func printVersion() {
 
 func main() {
 
+	namespace := flag.String("namespace", "", "Namespace with fencing PodTemplates and jobs, detected from the environment by default")
+	templateNamespaces := flag.String("template-namespaces", "", "Comma-separated list of additional namespaces searched for PodTemplates, enables cluster-wide watching of jobs")
+	metricsAddr := flag.String("metrics-addr", "0", "The address the metric endpoint binds to, 0 disables it")
+	statusAddr := flag.String("status-addr", "0", "The address the fencing status endpoint binds to, 0 disables it")
+	conditionType := flag.String("condition-type", string(v1.NodeReady), "Default node condition type used to detect failed nodes")
+	flag.StringVar(&node.TriggerEventReason, "trigger-event-reason", "", "Reason of the Events against Nodes which mark the node failed, empty disables it")
+	includeNodes := flag.String("include-nodes", "", "Comma-separated list of regular expressions, only matching nodes are fenced")
+	excludeNodes := flag.String("exclude-nodes", "", "Comma-separated list of regular expressions, matching nodes are never fenced")
+	flag.DurationVar(&node.DefaultTimeout, "default-timeout", 0, "Timeout to wait for the node recovery before fencing when fencing/timeout is not specified, 0 fences immediately")
+	flag.DurationVar(&node.MinNodeAge, "min-node-age", 0, "Minimum age of the node to be fenced, younger nodes may be still initializing, 0 disables the check")
+	flag.BoolVar(&node.EnableFinalizer, "enable-finalizer", false, "Add finalizer to flush fencing enabled nodes before their deletion")
+	flag.BoolVar(&node.ManualRecovery, "manual-recovery", false, "Leave fencing annotations and jobs of recovered nodes for manual cleanup, can be overridden by fencing/manual-recovery annotation")
+	flag.IntVar(&node.KeepFailedJobsLimit, "keep-failed-jobs-limit", 3, "Maximum number of failed jobs retained for every node with fencing/keep-failed-jobs=true")
+	flag.StringVar(&node.PoolLabel, "pool-label", "", "Node label used to select PodTemplate labeled with fencing/pool=<value>")
+	flag.IntVar(&node.MaxConcurrentFences, "max-concurrent-fences", 0, "Maximum number of nodes being fenced at the same time with any backend, 0 means unlimited")
+	flag.IntVar(&node.MinHealthyNodes, "min-healthy-nodes", 0, "Minimum number of Ready nodes required to start fencing, 0 disables the check")
+	flag.DurationVar(&node.BatchWindow, "batch-window", 0, "Debounce window gathering simultaneously failed nodes before fencing decisions, 0 disables it")
+	flag.Float64Var(&node.SafeModeThreshold, "safe-mode-threshold", 0, "Fraction of nodes (0-1) losing their status within safe-mode-window above which all fencing is suspended, 0 disables safe mode")
+	flag.DurationVar(&node.SafeModeWindow, "safe-mode-window", time.Minute, "Sliding window the nodes must lose their status within to enter safe mode")
+	flag.Float64Var(&node.FenceRate, "fence-rate", 0, "Maximum number of fencing attempts started per minute, 0 means unlimited")
+	flag.IntVar(&node.FenceBurst, "fence-burst", 1, "Number of fencing attempts which can be started at once within fence-rate")
+	flag.Float64Var(&node.RecoveryRate, "recovery-rate", 0, "Maximum number of recovered nodes cleaned up per minute, 0 means unlimited")
+	flag.IntVar(&node.RecoveryBurst, "recovery-burst", 10, "Number of recovered nodes which can be cleaned up at once within recovery-rate")
+	syncPeriod := flag.Duration("sync-period", 10*time.Hour, "Period of the full resync of all watched objects")
+	flag.StringVar(&node.StateConfigMap, "state-configmap", "", "Name of ConfigMap to periodically dump the controller state to, empty disables it")
+	flag.DurationVar(&node.HistoryRetention, "history-retention", 0, "Period after which archived (retained and recovered) fencing jobs are deleted, 0 keeps them forever")
+	nodePatchType := flag.String("node-patch-type", "merge", "Patch type used to update node annotations: merge, strategic or apply")
+	auditLog := flag.String("audit-log", "", "File to write JSON audit records of fencing decisions to, - for stdout, empty disables it")
+	jobLabels := flag.String("job-labels", "", "Comma-separated list of key=value labels added to every fencing job")
+	flag.BoolVar(&node.BlockOwnerDeletion, "block-owner-deletion", true, "Set blockOwnerDeletion in the node owner reference of fencing jobs")
+	incidentID := flag.String("incident-id", "", "Incident ID stamped as fencing/incident-id on every fencing job until it is set at runtime via status endpoint")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP gRPC endpoint (host:port) to export reconcile traces to, empty disables tracing")
+	otlpInsecure := flag.Bool("otlp-insecure", false, "Export traces to otlp-endpoint without TLS")
+	jobAnnotations := flag.String("job-annotations", "", "Comma-separated list of key=value annotations added to every fencing job")
+	imagePullSecrets := flag.String("image-pull-secrets", "", "Comma-separated list of image pull secrets added to the pods of every fencing, confirm and after-hook job")
+	webhookPort := flag.Int("webhook-port", 0, "The port the node defaulting webhook binds to, 0 disables it")
+	webhookCertDir := flag.String("webhook-cert-dir", "", "Directory with tls.crt and tls.key for the webhook server")
+	webhookNodeSelector := flag.String("webhook-node-selector", "", "Label selector of the nodes defaulted by the webhook, empty selects all nodes")
+	webhookAnnotations := flag.String("webhook-annotations", "fencing/enabled=true", "Comma-separated list of key=value annotations added to new nodes by the webhook")
+	klog.InitFlags(nil)
 	flag.Parse()
 	printVersion()
 
@@ -38,12 +91,79 @@ func main() {
 	)
 
 	// Get current namespace
-	Namespace, _, err := kubeconfig.Namespace()
+	Namespace, err := getNamespace(*namespace, kubeconfig.Namespace)
 	if err != nil {
 		klog.Errorln("Failed to get watch namespace", err)
 		os.Exit(1)
 	}
 	node.Namespace = Namespace
+	if *templateNamespaces != "" {
+		node.TemplateNamespaces = strings.Split(*templateNamespaces, ",")
+	}
+	node.ConditionType = v1.NodeConditionType(*conditionType)
+	if node.IncludeNodes, err = parseRegexps(*includeNodes); err != nil {
+		klog.Errorln("Failed to parse include-nodes", err)
+		os.Exit(1)
+	}
+	if node.ExcludeNodes, err = parseRegexps(*excludeNodes); err != nil {
+		klog.Errorln("Failed to parse exclude-nodes", err)
+		os.Exit(1)
+	}
+	if node.JobLabels, err = parseMap(*jobLabels); err != nil {
+		klog.Errorln("Failed to parse job-labels", err)
+		os.Exit(1)
+	}
+	if node.JobAnnotations, err = parseMap(*jobAnnotations); err != nil {
+		klog.Errorln("Failed to parse job-annotations", err)
+		os.Exit(1)
+	}
+	node.DefaultIncidentID = *incidentID
+	if *imagePullSecrets != "" {
+		node.ImagePullSecrets = strings.Split(*imagePullSecrets, ",")
+		job.ImagePullSecrets = node.ImagePullSecrets
+	}
+	if webhook.NodeSelector, err = labels.Parse(*webhookNodeSelector); err != nil {
+		klog.Errorln("Failed to parse webhook-node-selector", err)
+		os.Exit(1)
+	}
+	if webhook.DefaultAnnotations, err = parseMap(*webhookAnnotations); err != nil {
+		klog.Errorln("Failed to parse webhook-annotations", err)
+		os.Exit(1)
+	}
+	switch *nodePatchType {
+	case "merge":
+		util.NodePatchType = types.MergePatchType
+	case "strategic":
+		util.NodePatchType = types.StrategicMergePatchType
+	case "apply":
+		util.NodePatchType = types.ApplyPatchType
+	default:
+		klog.Errorln("Unknown node-patch-type", *nodePatchType)
+		os.Exit(1)
+	}
+	switch *auditLog {
+	case "":
+	case "-":
+		audit.Sink = os.Stdout
+	default:
+		f, err := os.OpenFile(*auditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			klog.Errorln("Failed to open audit-log", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		audit.Sink = f
+	}
+
+	// Setup OpenTelemetry tracing of the reconciles
+	if *otlpEndpoint != "" {
+		shutdown, err := setupTracing(*otlpEndpoint, *otlpInsecure)
+		if err != nil {
+			klog.Errorln("Failed to setup OTLP exporter", err)
+			os.Exit(1)
+		}
+		defer shutdown()
+	}
 
 	// Get a config to talk to the apiserver
 	cfg, err := config.GetConfig()
@@ -52,14 +172,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Check if Jobs are supported by the cluster
+	batchAvailable, err := util.IsGroupVersionAvailable(cfg, "batch/v1")
+	if err != nil {
+		klog.Errorln("Failed to discover batch/v1 API", err)
+		os.Exit(1)
+	}
+	if !batchAvailable {
+		klog.Errorln("batch/v1 API is not available in the cluster, job-based fencing is disabled")
+		node.JobsDisabled = true
+		job.Disabled = true
+	}
+
 	// Create a new Cmd to provide shared dependencies and start components
-	mgr, err := manager.New(cfg, manager.Options{
-		MetricsBindAddress:      "0",
-		Namespace:               Namespace,
-		LeaderElection:          true,
-		LeaderElectionID:        "kube-fencing-lock",
-		LeaderElectionNamespace: Namespace,
-	})
+	mgr, err := manager.New(cfg, managerOptions(Namespace, node.TemplateNamespaces, *metricsAddr, *syncPeriod, *webhookPort, *webhookCertDir))
 	if err != nil {
 		klog.Errorln("Failed to create new manager", err)
 		os.Exit(1)
@@ -73,6 +199,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Setup fencing status endpoint
+	if *statusAddr != "0" {
+		if err := status.Add(mgr, *statusAddr); err != nil {
+			klog.Errorln("Failed to setup status endpoint", err)
+			os.Exit(1)
+		}
+	}
+
+	// Setup node defaulting webhook
+	if *webhookPort != 0 {
+		if err := webhook.Add(mgr); err != nil {
+			klog.Errorln("Failed to setup webhook", err)
+			os.Exit(1)
+		}
+	}
+
 	klog.Infoln("Starting the Cmd.")
 
 	// Start the Cmd
@@ -80,4 +222,74 @@ func main() {
 		klog.Errorln("Manager exited non-zero", err)
 		os.Exit(1)
 	}
+
+	// Let in-flight fencings be marked as interrupted
+	node.WaitShutdown(10 * time.Second)
+}
+
+// getNamespace returns the namespace specified by flag or detected from the environment
+func getNamespace(namespace string, detect func() (string, bool, error)) (string, error) {
+	if namespace != "" {
+		return namespace, nil
+	}
+	namespace, _, err := detect()
+	if err != nil {
+		return "", err
+	}
+	if namespace == "" {
+		return "", errors.New("namespace is not specified and can not be detected, use --namespace flag")
+	}
+	return namespace, nil
+}
+
+// managerOptions returns the options of the manager electing the leader in namespace and watching namespace,
+// and templateNamespaces if PodTemplates are searched in multiple namespaces
+func managerOptions(namespace string, templateNamespaces []string, metricsAddr string, syncPeriod time.Duration, webhookPort int, webhookCertDir string) manager.Options {
+	var newCache cache.NewCacheFunc
+	if len(templateNamespaces) > 0 {
+		newCache = util.NamespacesCacheBuilder(append([]string{namespace}, templateNamespaces...))
+	}
+	return manager.Options{
+		MetricsBindAddress:      metricsAddr,
+		SyncPeriod:              &syncPeriod,
+		Namespace:               namespace,
+		NewCache:                newCache,
+		LeaderElection:          true,
+		LeaderElectionID:        "kube-fencing-lock",
+		LeaderElectionNamespace: namespace,
+		Port:                    webhookPort,
+		CertDir:                 webhookCertDir,
+	}
+}
+
+// parseRegexps compiles comma-separated list of regular expressions
+func parseRegexps(s string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range strings.Split(s, ",") {
+		if p == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// parseMap parses comma-separated list of key=value pairs
+func parseMap(s string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, p := range strings.Split(s, ",") {
+		if p == "" {
+			continue
+		}
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid key=value pair %q", p)
+		}
+		res[kv[0]] = kv[1]
+	}
+	return res, nil
 }
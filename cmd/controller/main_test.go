@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/controller/node"
+)
+
+func TestGetNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		flag      string
+		detected  string
+		err       error
+		namespace string
+	}{
+		{name: "flag", flag: "fencing", detected: "default", namespace: "fencing"},
+		{name: "detected", detected: "kube-fencing", namespace: "kube-fencing"},
+		{name: "detection failed", err: errors.New("invalid kubeconfig")},
+		{name: "no auto-detect source"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detect := func() (string, bool, error) {
+				return tt.detected, false, tt.err
+			}
+			namespace, err := getNamespace(tt.flag, detect)
+			if tt.namespace == "" {
+				if err == nil {
+					t.Errorf("namespace %q is returned, want error", namespace)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("namespace is not detected: %v", err)
+			}
+			if namespace != tt.namespace {
+				t.Errorf("namespace is %q, want %q", namespace, tt.namespace)
+			}
+		})
+	}
+}
+
+func TestAddWithoutNamespace(t *testing.T) {
+	defer func(v string) { node.Namespace = v }(node.Namespace)
+	node.Namespace = ""
+	if err := node.Add(nil); err == nil {
+		t.Errorf("node controller is added without namespace")
+	}
+}
+
+func TestManagerOptions(t *testing.T) {
+	opts := managerOptions("fencing", nil, "0", 5*time.Minute, 9443, "/certs")
+	if opts.SyncPeriod == nil || *opts.SyncPeriod != 5*time.Minute {
+		t.Errorf("sync period is %v, want 5m", opts.SyncPeriod)
+	}
+	if opts.Namespace != "fencing" || opts.NewCache != nil {
+		t.Errorf("watched namespace is %q, want fencing only", opts.Namespace)
+	}
+	// Template namespaces are watched in addition, never all namespaces
+	opts = managerOptions("fencing", []string{"rack1"}, "0", 5*time.Minute, 9443, "/certs")
+	if opts.Namespace != "fencing" || opts.NewCache == nil {
+		t.Errorf("watched namespace is %q, want fencing and template namespaces", opts.Namespace)
+	}
+	if !opts.LeaderElection || opts.LeaderElectionNamespace != "fencing" {
+		t.Errorf("leader election is %v in %q, want enabled in fencing", opts.LeaderElection, opts.LeaderElectionNamespace)
+	}
+	if opts.Port != 9443 || opts.CertDir != "/certs" {
+		t.Errorf("webhook server is %d with %q, want 9443 with /certs", opts.Port, opts.CertDir)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !otlp
+// +build !otlp
+
+package main
+
+import (
+	"fmt"
+)
+
+// setupTracing fails as the OTLP exporter is built only with otlp build tag,
+// so its gRPC dependencies are not compiled into the default binary
+func setupTracing(endpoint string, insecure bool) (func(), error) {
+	return nil, fmt.Errorf("tracing is not supported, the controller must be built with -tags otlp")
+}
@@ -0,0 +1,33 @@
+//go:build otlp
+// +build otlp
+
+package main
+
+import (
+	"context"
+
+	"github.com/kvaps/kube-fencing/pkg/controller/node"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// setupTracing exports the reconcile spans to the OTLP gRPC endpoint, it returns the function flushing them on exit
+func setupTracing(endpoint string, insecure bool) (func(), error) {
+	opts := []otlpgrpc.Option{otlpgrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlpgrpc.WithInsecure())
+	}
+	exporter, err := otlp.NewExporter(context.Background(), otlpgrpc.NewDriver(opts...))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String("kube-fencing-controller"))),
+	)
+	node.Tracer = provider.Tracer("github.com/kvaps/kube-fencing/pkg/controller/node")
+	return func() { provider.Shutdown(context.Background()) }, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/kvaps/kube-fencing/pkg/controller/node"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout))
+}
+
+// run validates the PodTemplate, prints the generated Job to out and returns the exit code
+func run(args []string, out io.Writer) int {
+
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	file := flags.String("f", "", "Path to the PodTemplate YAML file")
+	nodeName := flags.String("node", "example-node", "Name of the sample node")
+	namespace := flags.String("namespace", "fencing", "Namespace for the generated Job")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *file == "" {
+		fmt.Fprintln(out, "PodTemplate file is not specified, use -f")
+		return 2
+	}
+
+	data, err := ioutil.ReadFile(*file)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	podTemplate := &v1.PodTemplate{}
+	if err := yaml.UnmarshalStrict(data, podTemplate); err != nil {
+		fmt.Fprintln(out, "Failed to parse PodTemplate:", err)
+		return 1
+	}
+
+	// Define a sample node
+	sample := &v1.Node{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Node",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: *nodeName,
+			Annotations: map[string]string{
+				"fencing/enabled":  "true",
+				"fencing/template": podTemplate.Name,
+			},
+		},
+	}
+
+	node.Namespace = *namespace
+	job, err := node.BuildFencingJob(sample, podTemplate)
+	if err != nil {
+		fmt.Fprintln(out, "Invalid PodTemplate:", err)
+		return 1
+	}
+
+	job.TypeMeta = metav1.TypeMeta{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+	}
+	data, err = yaml.Marshal(job)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	fmt.Fprint(out, string(data))
+	return 0
+}
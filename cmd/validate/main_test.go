@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validTemplate = `apiVersion: v1
+kind: PodTemplate
+metadata:
+  name: fencing
+  annotations:
+    fencing/mode: delete
+template:
+  spec:
+    restartPolicy: Never
+    containers:
+    - name: fence
+      image: fence-agents
+`
+
+const noContainersTemplate = `apiVersion: v1
+kind: PodTemplate
+metadata:
+  name: fencing
+template:
+  spec:
+    restartPolicy: Never
+`
+
+const unknownModeTemplate = `apiVersion: v1
+kind: PodTemplate
+metadata:
+  name: fencing
+  annotations:
+    fencing/mode: reboot
+template:
+  spec:
+    containers:
+    - name: fence
+      image: fence-agents
+`
+
+const unknownFieldTemplate = `apiVersion: v1
+kind: PodTemplate
+metadata:
+  name: fencing
+spec:
+  containers: []
+`
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		template string
+		args     []string
+		code     int
+		// output is expected to contain all of the strings
+		output []string
+	}{
+		{name: "valid template", template: validTemplate, args: []string{"-node", "node1"}, code: 0,
+			output: []string{"kind: Job", "name: fence-node1", "namespace: fencing", "fencing/mode: delete", "image: fence-agents"}},
+		{name: "namespace flag", template: validTemplate, args: []string{"-namespace", "kube-system"}, code: 0,
+			output: []string{"name: fence-example-node", "namespace: kube-system"}},
+		{name: "no containers", template: noContainersTemplate, code: 1, output: []string{"Invalid PodTemplate:", "container"}},
+		{name: "unknown mode", template: unknownModeTemplate, code: 1, output: []string{"Invalid PodTemplate:", "fencing/mode"}},
+		{name: "unknown field", template: unknownFieldTemplate, code: 1, output: []string{"Failed to parse PodTemplate:"}},
+		{name: "missing file", args: []string{"-f", filepath.Join(dir, "missing.yaml")}, code: 1, output: []string{"no such file"}},
+		{name: "file is not specified", code: 2, output: []string{"use -f"}},
+		{name: "unknown flag", args: []string{"-unknown"}, code: 2},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.template != "" {
+				file := filepath.Join(dir, fmt.Sprintf("template%d.yaml", i))
+				if err := ioutil.WriteFile(file, []byte(tt.template), 0644); err != nil {
+					t.Fatal(err)
+				}
+				args = append([]string{"-f", file}, args...)
+			}
+			out := &bytes.Buffer{}
+			if code := run(args, out); code != tt.code {
+				t.Errorf("exit code is %d, want %d, output:\n%s", code, tt.code, out)
+			}
+			for _, s := range tt.output {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("output does not contain %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// Sink receives one JSON audit record per line, nil disables the audit log
+var Sink io.Writer
+
+var mu sync.Mutex
+
+// Record describes a single fencing decision and its inputs
+type Record struct {
+	Time        time.Time         `json:"time"`
+	Node        string            `json:"node"`
+	Decision    string            `json:"decision"`
+	Reason      string            `json:"reason,omitempty"`
+	State       string            `json:"state"`
+	Conditions  map[string]string `json:"conditions,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Emit writes the decision made for the node with the effective fencing annotations to the Sink
+func Emit(node *v1.Node, annotations map[string]string, decision, reason string) {
+	if Sink == nil {
+		return
+	}
+	rec := Record{
+		Time:        time.Now().UTC(),
+		Node:        node.Name,
+		Decision:    decision,
+		Reason:      reason,
+		State:       node.Annotations["fencing/state"],
+		Conditions:  map[string]string{},
+		Annotations: map[string]string{},
+	}
+	for _, c := range node.Status.Conditions {
+		rec.Conditions[string(c.Type)] = string(c.Status)
+	}
+	for k, v := range annotations {
+		if audited[k] {
+			rec.Annotations[k] = v
+		}
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		klog.Errorln("Failed to encode audit record for node", node.Name, ":", err)
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, err := Sink.Write(append(line, '\n')); err != nil {
+		klog.Errorln("Failed to write audit record for node", node.Name, ":", err)
+	}
+}
+
+// audited are the annotations written to the audit log. Only the options driving the fencing decisions
+// are listed, so addresses, URLs, commands, hooks and secret references never reach the Sink.
+var audited = map[string]bool{
+	"fencing/enabled":             true,
+	"fencing/state":               true,
+	"fencing/timestamp":           true,
+	"fencing/first-timestamp":     true,
+	"fencing/started-at":          true,
+	"fencing/fenced-at":           true,
+	"fencing/recovered-at":        true,
+	"fencing/id":                  true,
+	"fencing/incident-id":         true,
+	"fencing/mode":                true,
+	"fencing/backend":             true,
+	"fencing/action":              true,
+	"fencing/template":            true,
+	"fencing/namespace":           true,
+	"fencing/config-ref":          true,
+	"fencing/timeout":             true,
+	"fencing/overall-deadline":    true,
+	"fencing/trigger":             true,
+	"fencing/condition-type":      true,
+	"fencing/lease-threshold":     true,
+	"fencing/heartbeat-threshold": true,
+	"fencing/priority":            true,
+	"fencing/pool":                true,
+	"fencing/max-concurrent":      true,
+	"fencing/attempts":            true,
+	"fencing/max-attempts":        true,
+	"fencing/last-attempt":        true,
+	"fencing/backoff":             true,
+	"fencing/backoff-max":         true,
+	"fencing/cooldown":            true,
+	"fencing/require-approval":    true,
+	"fencing/approved":            true,
+	"fencing/emergency":           true,
+	"fencing/escalation":          true,
+	"fencing/escalated":           true,
+	"fencing/observe":             true,
+	"fencing/skip-if-empty":       true,
+	"fencing/expect-recovery":     true,
+	"fencing/manual-recovery":     true,
+	"fencing/recovery-stability":  true,
+	"fencing/interrupted":         true,
+	"fencing/stage":               true,
+	"fencing/drain":               true,
+	"fencing/out-of-service":      true,
+	"fencing/cleanup-policy":      true,
+	"fencing/job-uid":             true,
+}
@@ -3,15 +3,20 @@ package job
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/kvaps/kube-fencing/pkg/metrics"
 	"github.com/kvaps/kube-fencing/pkg/util"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
-	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -21,15 +26,30 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+var (
+	// Disabled disables the Job Controller when batch/v1 API is not available
+	Disabled bool
+	// ImagePullSecrets are added to the pods of every confirm and after-hook job
+	ImagePullSecrets []string
+)
+
 // Add creates a new Job Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
+	if Disabled {
+		return nil
+	}
 	return add(mgr, newReconciler(mgr))
 }
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileJob{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return &ReconcileJob{
+		client:    mgr.GetClient(),
+		clientset: kubernetes.NewForConfigOrDie(mgr.GetConfig()),
+		scheme:    mgr.GetScheme(),
+		recorder:  mgr.GetEventRecorderFor("fencing-controller"),
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -40,8 +60,8 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
-	// Watch for changes to primary resource Job
-	err = c.Watch(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForObject{})
+	// Watch for changes to primary resource Job, ignoring jobs of other controllers
+	err = c.Watch(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForObject{}, fencingJobPredicate)
 	if err != nil {
 		return err
 	}
@@ -57,7 +77,10 @@ type ReconcileJob struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
 	client client.Client
-	scheme *runtime.Scheme
+	// clientset is used for the subresources unsupported by client, e.g. pods/eviction
+	clientset kubernetes.Interface
+	scheme    *runtime.Scheme
+	recorder  record.EventRecorder
 }
 
 // Reconcile reads that state of the cluster for a Job object and makes changes based on the state read
@@ -65,7 +88,27 @@ type ReconcileJob struct {
 // Note:
 // The Controller will requeue the Request to be processed again if the returned error is non-nil or
 // Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
-func (r *ReconcileJob) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+func (r *ReconcileJob) Reconcile(request reconcile.Request) (result reconcile.Result, err error) {
+	// Record reconciliation duration and errors, runs after panic recovery
+	start := time.Now()
+	defer func() {
+		metrics.ObserveReconcile("job", start, err)
+	}()
+
+	// Don't let a single malformed object to crash the whole controller
+	defer func() {
+		if p := recover(); p != nil {
+			klog.Errorln("Recovered from panic while reconciling job", request.Name, ":", p)
+			metrics.ReconcilePanics.WithLabelValues("job").Inc()
+			result = reconcile.Result{}
+			err = fmt.Errorf("panic while reconciling job %s: %v", request.Name, p)
+		}
+	}()
+	return r.reconcile(request)
+}
+
+// reconcile contains the Reconcile logic
+func (r *ReconcileJob) reconcile(request reconcile.Request) (reconcile.Result, error) {
 
 	// Fetch the Job instance
 	instance := &batchv1.Job{}
@@ -80,7 +123,11 @@ func (r *ReconcileJob) Reconcile(request reconcile.Request) (reconcile.Result, e
 	}
 
 	// We need only Jobs created by node controller
-	if instance.Labels["fencing"] != "fence" {
+	switch instance.Labels["fencing"] {
+	case "fence":
+	case "confirm":
+		return r.reconcileConfirm(instance)
+	default:
 		return reconcile.Result{}, err
 	}
 
@@ -103,20 +150,35 @@ func (r *ReconcileJob) Reconcile(request reconcile.Request) (reconcile.Result, e
 		return reconcile.Result{}, err
 	}
 
-	// Set fencing/state=failed if job was failed
+	// Pods exited with benign codes are considered succeeded, e.g. when the node is already powered off
+	exitedWithSuccess, err := util.JobSucceededByExitCode(context.TODO(), r.client, instance)
+	if err != nil {
+		klog.Errorln("Failed to check exit codes of job", instance.Name, ":", err)
+	}
+
+	// Set fencing/state=failed if job was failed and no more attempts are allowed,
+	// otherwise Node Controller retries the fencing with a new job
 	_, jf := util.GetJobCondition(&instance.Status, batchv1.JobFailed)
-	if jf != nil {
-		klog.Infoln("Failed fencing node", nodeName)
+	if jf != nil && !exitedWithSuccess {
+		reason := util.GetJobFailureReason(&instance.Status)
+		if message := r.getTerminationMessage(instance); message != "" {
+			reason = reason + " (" + message + ")"
+		}
+		annotations := map[string]interface{}{
+			"fencing/last-error": reason,
+		}
+		if attemptsExhausted(instance, node) {
+			klog.Infoln("Failed fencing node", nodeName, ":", reason)
+			r.recorder.Event(node, v1.EventTypeWarning, "FencingFailed", "Fencing job "+instance.Name+" failed: "+reason)
+			annotations["fencing/state"] = "failed"
+			annotations["fencing/timestamp"] = nil
+		} else {
+			klog.Infoln("Fencing attempt of node", nodeName, "failed, it will be retried:", reason)
+			r.recorder.Event(node, v1.EventTypeWarning, "FencingAttemptFailed", "Fencing job "+instance.Name+" failed, fencing will be retried: "+reason)
+		}
+
 		// Setting fencing status annotation
-		mergePatch, _ := json.Marshal(map[string]interface{}{
-			"metadata": map[string]interface{}{
-				"annotations": map[string]interface{}{
-					"fencing/state":     "failed",
-					"fencing/timestamp": nil,
-				},
-			},
-		})
-		err = r.client.Patch(context.TODO(), node, client.RawPatch(types.MergePatchType, mergePatch))
+		err = util.PatchNodeAnnotations(context.TODO(), r.client, node, annotations)
 		if err != nil {
 			klog.Errorln("Failed to patch node", node.Name, ":", err)
 			return reconcile.Result{}, err
@@ -126,141 +188,210 @@ func (r *ReconcileJob) Reconcile(request reconcile.Request) (reconcile.Result, e
 
 	// We need to wait until job succeeded
 	_, jc := util.GetJobCondition(&instance.Status, batchv1.JobComplete)
-	if jc == nil {
-		return reconcile.Result{}, nil
+	if jc == nil && !exitedWithSuccess {
+		// Optionally consider the job completed as soon as its pod succeeded
+		if instance.Annotations["fencing/complete-on-pod-success"] != "true" || !r.podSucceeded(instance) {
+			return reconcile.Result{}, nil
+		}
+	}
+
+	// Confirm the node is fenced before declaring it
+	if confirmTemplate := instance.Annotations["fencing/confirm-template"]; confirmTemplate != "" {
+		klog.Infoln("Confirming fencing node", nodeName)
+		return r.createJobForJob(instance, confirmTemplate, "confirm")
 	}
 
 	klog.Infoln("Succesful fencing node", nodeName)
+	return r.fenceNode(instance, node)
+}
 
-	// Get the fencing mode
-	fencingMode, ok := instance.Annotations["fencing/mode"]
-	if !ok {
+// reconcileConfirm declares the node fenced when the confirm job succeeded,
+// or removes the fencing job to retry the fencing when the confirm job failed
+func (r *ReconcileJob) reconcileConfirm(confirm *batchv1.Job) (reconcile.Result, error) {
+
+	// Get the fencing job
+	owner := metav1.GetControllerOf(confirm)
+	if owner == nil {
 		return reconcile.Result{}, nil
 	}
+	instance := &batchv1.Job{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: owner.Name, Namespace: confirm.Namespace}, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
 
-	// Start the cleanup
-	switch fencingMode {
-	case "none":
-		// Do nothing
-	case "delete":
-		// Delete the node
-		klog.Infoln("Removing node", nodeName)
-		err = r.client.Delete(context.TODO(), node,
+	// Ignore the confirm job left by the previous fencing job of the same name
+	if instance.UID != owner.UID {
+		return reconcile.Result{}, nil
+	}
+
+	// Ignore already fenced nodes
+	if instance.Annotations["fencing/state"] == "fenced" {
+		return reconcile.Result{}, nil
+	}
+
+	// Get the node
+	nodeName := instance.Annotations["fencing/node"]
+	node := &v1.Node{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: nodeName}, node)
+	if err != nil {
+		klog.Errorln(err, "No node found", nodeName)
+		return reconcile.Result{}, err
+	}
+
+	// Retry fencing if confirm job was failed
+	_, jf := util.GetJobCondition(&confirm.Status, batchv1.JobFailed)
+	if jf != nil {
+		reason := "confirm job " + confirm.Name + " failed: " + util.GetJobFailureReason(&confirm.Status)
+		klog.Infoln("Failed to confirm fencing node", nodeName, ":", reason)
+		r.recorder.Event(node, v1.EventTypeWarning, "FencingFailed", reason)
+
+		// Remove the confirm job first, so it does not block the confirm job of the next fencing job
+		klog.Infoln("Deleting confirm job", confirm.Name)
+		err = r.client.Delete(context.TODO(), confirm,
 			client.GracePeriodSeconds(0),
 			client.PropagationPolicy(metav1.DeletePropagationBackground),
 		)
-		if err != nil {
-			klog.Errorln("Failed to delete node", nodeName, ":", err)
-			return reconcile.Result{}, nil
-		}
-	case "flush":
-		// Flush all resources from the node
-		klog.Infoln("Flushing node", nodeName)
-
-		// Fetch a list of all namespaces for DeleteAllOf requests
-		namespaces := v1.NamespaceList{}
-		pod := &v1.Pod{}
-		if err := r.client.List(context.TODO(), &namespaces); err != nil {
-			klog.Errorln("Failed to get namespace list:", err)
-		}
-		for _, ns := range namespaces.Items {
-			opts := []client.DeleteAllOfOption{
-				client.InNamespace(ns.Name),
-				client.MatchingFields{"spec.nodeName": nodeName},
-				client.GracePeriodSeconds(0),
-				client.PropagationPolicy(metav1.DeletePropagationBackground),
-			}
-			err = r.client.DeleteAllOf(context.TODO(), pod, opts...)
-			if err != nil {
-				klog.Errorln("Failed to delete pods in namespace", ns.Name, ":", err)
-			}
+		if err != nil && !errors.IsNotFound(err) {
+			klog.Errorln("Failed to delete job", confirm.Name, ":", err)
+			return reconcile.Result{}, err
 		}
 
-		// Fetch a list of all volumeattachments and delete them
-		volumeattachment := &storagev1.VolumeAttachment{}
-		volumeattachments := storagev1.VolumeAttachmentList{}
-		if err := r.client.List(context.TODO(), &volumeattachments); err != nil {
-			klog.Errorln("Failed to get volumeattachment list:", err)
+		// Remove the fencing job, node controller will start a new one
+		klog.Infoln("Deleting fencing job", instance.Name)
+		err = r.client.Delete(context.TODO(), instance,
+			client.GracePeriodSeconds(0),
+			client.PropagationPolicy(metav1.DeletePropagationBackground),
+		)
+		if err != nil && !errors.IsNotFound(err) {
+			klog.Errorln("Failed to delete job", instance.Name, ":", err)
+			return reconcile.Result{}, err
 		}
-		for _, va := range volumeattachments.Items {
-			if va.Spec.NodeName == nodeName {
-				opts := []client.DeleteAllOfOption{
-					client.MatchingFields{"metadata.name": va.Name},
-					client.GracePeriodSeconds(0),
-				}
-				err = r.client.DeleteAllOf(context.TODO(), volumeattachment, opts...)
-				if err != nil {
-					klog.Errorln("Failed to delete volumeattachment", va.Name, ":", err)
-				}
-			}
+
+		err = util.PatchNodeAnnotations(context.TODO(), r.client, node, map[string]interface{}{
+			"fencing/last-error": reason,
+		})
+		if err != nil {
+			klog.Errorln("Failed to patch node", node.Name, ":", err)
+			return reconcile.Result{}, err
 		}
-	default:
-		klog.Errorln("Unknown fencing mode", fencingMode, "for node", nodeName)
-		return reconcile.Result{}, err
+		return reconcile.Result{}, nil
 	}
 
-	if fencingMode != "delete" && fencingMode != "none" {
-		// Setting new condition
-		var newConditions []v1.NodeCondition
+	// We need to wait until confirm job succeeded
+	_, jc := util.GetJobCondition(&confirm.Status, batchv1.JobComplete)
+	if jc == nil {
+		return reconcile.Result{}, nil
+	}
 
-		for _, c := range node.Status.Conditions {
-			if c.Type == v1.NodeReady || c.Reason == "NodeStatusUnknown" {
-				c.Reason = "NodeFenced"
-				c.Message = "Node was fenced by fencing controller."
-				//TODO update time
-			}
-			newConditions = append(newConditions, c)
-		}
+	klog.Infoln("Succesful fencing node", nodeName)
+	return r.fenceNode(instance, node)
+}
 
-		node.Status.Conditions = newConditions
-		node.Status.VolumesAttached = nil
-		node.Status.VolumesInUse = nil
+// fenceNode cleans up the node according to the fencing mode and declares it fenced
+func (r *ReconcileJob) fenceNode(instance *batchv1.Job, node *v1.Node) (reconcile.Result, error) {
+	nodeName := node.Name
 
-		klog.Infoln("Updating node status", nodeName)
-		err = r.client.Status().Update(context.Background(), node)
+	// Get the fencing mode
+	if _, ok := instance.Annotations["fencing/mode"]; !ok {
+		return reconcile.Result{}, nil
+	}
+
+	// Give the restarted node a chance to rejoin before declaring it fenced
+	if v, ok := instance.Annotations["fencing/post-fence-wait"]; ok {
+		wait, err := util.ParseDuration(v)
+		if err != nil {
+			klog.Errorln("Failed to parse post-fence-wait string", v, ":", err)
+		}
+		remainTime, err := util.PostFenceWait(context.TODO(), r.client, node, wait)
 		if err != nil {
-			klog.Error("Failed to patch node", nodeName, ":", err)
+			klog.Errorln("Failed to patch node", nodeName, ":", err)
 			return reconcile.Result{}, err
 		}
+		if remainTime > 0 {
+			klog.Infoln("Waiting", remainTime, "if", nodeName, "rejoins after fencing")
+			return reconcile.Result{RequeueAfter: remainTime}, nil
+		}
+		if util.NodeReady(node) {
+			// Node controller will declare it recovered
+			klog.Infoln("Node", nodeName, "rejoined after fencing")
+			return reconcile.Result{}, nil
+		}
+	}
+
+	// Remember the workloads to confirm their rescheduling
+	rescheduleAnnotations, err := util.RescheduleAnnotations(r.clientset, nodeName, instance.Annotations)
+	if err != nil {
+		klog.Errorln("Failed to list workloads of node", nodeName, ":", err)
+	}
+
+	// Start the cleanup
+	requeueAfter, err := util.CleanupNode(context.TODO(), r.client, r.clientset, node, instance.Annotations)
+	if err != nil {
+		klog.Errorln("Failed to cleanup node", nodeName, ":", err)
+		return reconcile.Result{}, err
+	}
+	if requeueAfter > 0 {
+		return reconcile.Result{RequeueAfter: requeueAfter}, nil
 	}
 
 	// Setting fencing status annotation
-	mergePatch, _ := json.Marshal(map[string]interface{}{
-		"metadata": map[string]interface{}{
-			"annotations": map[string]interface{}{
-				"fencing/state":     "fenced",
-				"fencing/timestamp": nil,
-			},
-		},
-	})
-	err = r.client.Patch(context.TODO(), node, client.RawPatch(types.MergePatchType, mergePatch))
+	fencedAnnotations := map[string]interface{}{
+		"fencing/state":      "fenced",
+		"fencing/timestamp":  nil,
+		"fencing/fenced-at":  nil,
+		"fencing/last-error": nil,
+	}
+	err = util.PatchNodeAnnotations(context.TODO(), r.client, node, fencedAnnotations)
 	if err != nil {
 		klog.Errorln("Failed to patch node", node.Name, ":", err)
 		return reconcile.Result{}, err
 	}
+	mergePatch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": fencedAnnotations,
+		},
+	})
 	err = r.client.Patch(context.TODO(), instance, client.RawPatch(types.MergePatchType, mergePatch))
 	if err != nil {
 		klog.Errorln("Failed to patch job", instance.Name, ":", err)
 		return reconcile.Result{}, err
 	}
 
+	// Track the workloads rescheduling, node controller will confirm it
+	if len(rescheduleAnnotations) > 0 {
+		err = util.PatchNodeAnnotations(context.TODO(), r.client, node, rescheduleAnnotations)
+		if err != nil {
+			klog.Errorln("Failed to patch node", node.Name, ":", err)
+			return reconcile.Result{}, err
+		}
+	}
+
 	// Get after-hook annotation
 	afterHook, ok := instance.Annotations["fencing/after-hook"]
 	if !ok || afterHook == "" {
 		return reconcile.Result{}, nil
 	}
 	klog.Infoln("Executing after hook", afterHook, "for", node.Name)
+	return r.createJobForJob(instance, afterHook, "after-hook")
+}
+
+// createJobForJob creates a job of specified kind from the podTemplate for the fencing job
+func (r *ReconcileJob) createJobForJob(instance *batchv1.Job, templateName, kind string) (reconcile.Result, error) {
 
-	// Find PodTemplate for after hook
+	// Find PodTemplate
 	podTemplate := &v1.PodTemplate{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: afterHook, Namespace: instance.Namespace}, podTemplate)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: templateName, Namespace: instance.Namespace}, podTemplate)
 	if err != nil && errors.IsNotFound(err) {
-		klog.Errorln("Failed to find podTemplate ", afterHook, ":", err)
+		klog.Errorln("Failed to find podTemplate ", templateName, ":", err)
 		return reconcile.Result{}, nil
 	}
 
 	// Define a new Job object
-	job := newJobForJob(instance, podTemplate)
+	job := newJobForJob(instance, podTemplate, kind)
 
 	// Check if this Job already exists
 	found := &batchv1.Job{}
@@ -284,11 +415,62 @@ func (r *ReconcileJob) Reconcile(request reconcile.Request) (reconcile.Result, e
 	return reconcile.Result{}, nil
 }
 
-// newJobForJob returns a job with afterHook for the fencing job
-func newJobForJob(job *batchv1.Job, podTemplate *v1.PodTemplate) *batchv1.Job {
+// listJobPods returns the pods created by the job
+func (r *ReconcileJob) listJobPods(job *batchv1.Job) (*v1.PodList, error) {
+	pods := &v1.PodList{}
+	err := r.client.List(context.TODO(), pods,
+		client.InNamespace(job.Namespace),
+		client.MatchingLabels{"job-name": job.Name},
+	)
+	return pods, err
+}
+
+// podSucceeded returns true if any pod of the job is succeeded
+func (r *ReconcileJob) podSucceeded(job *batchv1.Job) bool {
+	pods, err := r.listJobPods(job)
+	if err != nil {
+		klog.Errorln("Failed to get pods for job", job.Name, ":", err)
+		return false
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodSucceeded {
+			return true
+		}
+	}
+	return false
+}
+
+// getTerminationMessage returns the termination message of the last terminated container of the job pods
+func (r *ReconcileJob) getTerminationMessage(job *batchv1.Job) string {
+	pods, err := r.listJobPods(job)
+	if err != nil {
+		klog.Errorln("Failed to get pods for job", job.Name, ":", err)
+		return ""
+	}
+
+	var last *v1.ContainerStateTerminated
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			t := cs.State.Terminated
+			if t == nil || t.Message == "" {
+				continue
+			}
+			if last == nil || last.FinishedAt.Before(&t.FinishedAt) {
+				last = t
+			}
+		}
+	}
+	if last == nil {
+		return ""
+	}
+	return last.Message
+}
+
+// newJobForJob returns a job of specified kind (after-hook or confirm) for the fencing job
+func newJobForJob(job *batchv1.Job, podTemplate *v1.PodTemplate, kind string) *batchv1.Job {
 	labels := map[string]string{
 		"node":    job.Annotations["fencing/node"],
-		"fencing": "after-hook",
+		"fencing": kind,
 	}
 	// Default annotations
 	annotations := map[string]string{
@@ -300,14 +482,26 @@ func newJobForJob(job *batchv1.Job, podTemplate *v1.PodTemplate) *batchv1.Job {
 	}
 
 	// Create new pod from podTemplate
-	pod := podTemplate.Template
+	pod := *podTemplate.Template.DeepCopy()
+	// Override restart policy and add image pull secrets, the same way as for the fencing job
+	util.SetJobPodSpec(&pod.Spec, podTemplate, ImagePullSecrets)
 	// Apply annotations to the pod
 	pod.ObjectMeta.Annotations = annotations
 
+	// Apply fencing labels to the pod, so they can be selected by NetworkPolicies
+	podLabels := map[string]string{}
+	for k, v := range pod.Labels {
+		podLabels[k] = v
+	}
+	for k, v := range labels {
+		podLabels[k] = v
+	}
+	pod.ObjectMeta.Labels = podLabels
+
 	// Set prefix name
 	suffix := pod.Name
 	if suffix == "" {
-		suffix = "after-hook"
+		suffix = kind
 	}
 
 	// Creating new Job
@@ -333,3 +527,14 @@ func newJobForJob(job *batchv1.Job, podTemplate *v1.PodTemplate) *batchv1.Job {
 			Template: pod},
 	}
 }
+
+// attemptsExhausted returns true if the node fencing must not be retried after the job failed,
+// fencing/max-attempts is propagated to the job, the failed job is not retried by default
+func attemptsExhausted(job *batchv1.Job, node *v1.Node) bool {
+	max := 1
+	if v, ok := job.Annotations["fencing/max-attempts"]; ok {
+		max, _ = strconv.Atoi(v)
+	}
+	attempts, _ := strconv.Atoi(node.Annotations["fencing/attempts"])
+	return max > 0 && attempts >= max
+}
@@ -0,0 +1,290 @@
+package job
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// newTestReconciler returns the ReconcileJob backed by the fake clients with the objects
+func newTestReconciler(objs ...runtime.Object) *ReconcileJob {
+	return &ReconcileJob{
+		client:    fake.NewFakeClientWithScheme(scheme.Scheme, objs...),
+		clientset: k8sfake.NewSimpleClientset(),
+		scheme:    scheme.Scheme,
+		recorder:  record.NewFakeRecorder(100),
+	}
+}
+
+// newTestJob returns the fencing job of the node with the finished condition and annotations
+func newTestJob(node string, condition batchv1.JobConditionType, annotations map[string]string) *batchv1.Job {
+	a := map[string]string{"fencing/node": node, "fencing/mode": "none"}
+	for k, v := range annotations {
+		a[k] = v
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "fence-" + node,
+			Namespace:   "fencing",
+			Labels:      map[string]string{"fencing": "fence", "node": node},
+			Annotations: a,
+		},
+	}
+	if condition != "" {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: v1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+	}
+	return job
+}
+
+// newTestNode returns the node being fenced with the annotations
+func newTestNode(name string, annotations map[string]string) *v1.Node {
+	a := map[string]string{"fencing/state": "started"}
+	for k, v := range annotations {
+		a[k] = v
+	}
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: a}}
+}
+
+// reconcileJob reconciles the job and returns its node as updated by the reconcile
+func reconcileJob(r *ReconcileJob, job *batchv1.Job) (*v1.Node, error) {
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: job.Name, Namespace: job.Namespace}})
+	node := &v1.Node{}
+	if getErr := r.client.Get(context.TODO(), types.NamespacedName{Name: job.Annotations["fencing/node"]}, node); getErr != nil {
+		return nil, getErr
+	}
+	return node, err
+}
+
+func TestReconcileFailedJob(t *testing.T) {
+	tests := []struct {
+		name     string
+		job      map[string]string
+		attempts string
+		state    string
+	}{
+		{name: "failed job is not retried by default", attempts: "1", state: "failed"},
+		{name: "attempts are left", job: map[string]string{"fencing/max-attempts": "3"}, attempts: "2", state: "started"},
+		{name: "attempts are exhausted", job: map[string]string{"fencing/max-attempts": "3"}, attempts: "3", state: "failed"},
+		{name: "zero max-attempts is unlimited", job: map[string]string{"fencing/max-attempts": "0"}, attempts: "10", state: "started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newTestJob("node1", batchv1.JobFailed, tt.job)
+			r := newTestReconciler(job, newTestNode("node1", map[string]string{"fencing/attempts": tt.attempts}))
+			node, err := reconcileJob(r, job)
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			if node.Annotations["fencing/last-error"] != "BackoffLimitExceeded" {
+				t.Errorf("last error is %q, want the job failure reason", node.Annotations["fencing/last-error"])
+			}
+		})
+	}
+}
+
+func TestReconcileJobExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		exitCode int32
+		state    string
+	}{
+		{name: "listed exit code fences the node", exitCode: 3, state: "fenced"},
+		{name: "other exit code fails the fencing", exitCode: 1, state: "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newTestJob("node1", batchv1.JobFailed, map[string]string{"fencing/success-exit-codes": "3"})
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "fence-node1-pod",
+					Namespace: job.Namespace,
+					Labels:    map[string]string{"job-name": job.Name},
+				},
+				Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+					State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: tt.exitCode}},
+				}}},
+			}
+			r := newTestReconciler(job, pod, newTestNode("node1", map[string]string{"fencing/attempts": "1"}))
+			node, err := reconcileJob(r, job)
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+		})
+	}
+}
+
+func TestReconcileLastError(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition batchv1.JobConditionType
+		lastError string
+	}{
+		{name: "failure reason is recorded", condition: batchv1.JobFailed, lastError: "BackoffLimitExceeded"},
+		{name: "previous failure is cleared on success", condition: batchv1.JobComplete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newTestJob("node1", tt.condition, map[string]string{"fencing/max-attempts": "2"})
+			r := newTestReconciler(job, newTestNode("node1", map[string]string{
+				"fencing/attempts":   "1",
+				"fencing/last-error": "DeadlineExceeded",
+			}))
+			node, err := reconcileJob(r, job)
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if lastError, ok := node.Annotations["fencing/last-error"]; lastError != tt.lastError || ok != (tt.lastError != "") {
+				t.Errorf("last error is %q, want %q", lastError, tt.lastError)
+			}
+		})
+	}
+}
+
+func TestReconcilePodSuccess(t *testing.T) {
+	tests := []struct {
+		name  string
+		job   map[string]string
+		phase v1.PodPhase
+		state string
+	}{
+		{name: "job condition is awaited by default", phase: v1.PodSucceeded, state: "started"},
+		{name: "succeeded pod completes the job", job: map[string]string{"fencing/complete-on-pod-success": "true"}, phase: v1.PodSucceeded, state: "fenced"},
+		{name: "running pod does not complete the job", job: map[string]string{"fencing/complete-on-pod-success": "true"}, phase: v1.PodRunning, state: "started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newTestJob("node1", "", tt.job)
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "fence-node1-pod",
+					Namespace: job.Namespace,
+					Labels:    map[string]string{"job-name": job.Name},
+				},
+				Status: v1.PodStatus{Phase: tt.phase},
+			}
+			r := newTestReconciler(job, pod, newTestNode("node1", nil))
+			node, err := reconcileJob(r, job)
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+		})
+	}
+}
+
+func TestReconcilePostFenceWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		fencedAt time.Duration
+		ready    bool
+		state    string
+	}{
+		{name: "wait is started", state: "started"},
+		{name: "node is waited for", fencedAt: time.Minute, state: "started"},
+		{name: "node recovered during wait", fencedAt: 10 * time.Minute, ready: true, state: "started"},
+		{name: "node stays fenced after wait", fencedAt: 10 * time.Minute, state: "fenced"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newTestJob("node1", batchv1.JobComplete, map[string]string{"fencing/post-fence-wait": "5m"})
+			annotations := map[string]string{}
+			if tt.fencedAt > 0 {
+				annotations["fencing/fenced-at"] = strconv.FormatInt(time.Now().Add(-tt.fencedAt).Unix(), 10)
+			}
+			node := newTestNode("node1", annotations)
+			if tt.ready {
+				node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+			}
+			r := newTestReconciler(job, node)
+			node, err := reconcileJob(r, job)
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			if _, ok := node.Annotations["fencing/fenced-at"]; ok != (tt.state == "started") {
+				t.Errorf("fenced-at is set %v while node is %s", ok, tt.state)
+			}
+		})
+	}
+}
+
+func TestReconcileFailedConfirm(t *testing.T) {
+	tests := []struct {
+		name     string
+		ownerUID types.UID
+		deleted  bool
+	}{
+		{name: "failed confirm job retries the fencing", ownerUID: "uid-1", deleted: true},
+		{name: "confirm job of the previous fencing job is ignored", ownerUID: "uid-0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newTestJob("node1", batchv1.JobComplete, nil)
+			job.UID = "uid-1"
+			owner := job.DeepCopy()
+			owner.UID = tt.ownerUID
+			confirm := newJobForJob(owner, &v1.PodTemplate{}, "confirm")
+			confirm.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+			r := newTestReconciler(job, confirm, newTestNode("node1", nil))
+			if _, err := reconcileJob(r, confirm); err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			for _, j := range []*batchv1.Job{job, confirm} {
+				err := r.client.Get(context.TODO(), types.NamespacedName{Name: j.Name, Namespace: j.Namespace}, &batchv1.Job{})
+				if deleted := errors.IsNotFound(err); deleted != tt.deleted {
+					t.Errorf("job %s is deleted %v, want %v", j.Name, deleted, tt.deleted)
+				}
+			}
+		})
+	}
+}
+
+func TestNewJobForJobPodSpec(t *testing.T) {
+	ImagePullSecrets = []string{"global"}
+	defer func() { ImagePullSecrets = nil }()
+
+	podTemplate := &v1.PodTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{"fencing/pull-secret": "registry"},
+		},
+	}
+	podTemplate.Template.Spec.RestartPolicy = v1.RestartPolicyAlways
+	for _, kind := range []string{"confirm", "after-hook"} {
+		t.Run(kind, func(t *testing.T) {
+			job := newJobForJob(newTestJob("node1", batchv1.JobComplete, nil), podTemplate, kind)
+			spec := job.Spec.Template.Spec
+			if spec.RestartPolicy != v1.RestartPolicyNever {
+				t.Errorf("restartPolicy is %s, want %s", spec.RestartPolicy, v1.RestartPolicyNever)
+			}
+			if len(spec.ImagePullSecrets) != 2 || spec.ImagePullSecrets[0].Name != "global" || spec.ImagePullSecrets[1].Name != "registry" {
+				t.Errorf("imagePullSecrets are %v, want [global registry]", spec.ImagePullSecrets)
+			}
+			if podTemplate.Template.Spec.RestartPolicy != v1.RestartPolicyAlways || podTemplate.Template.Spec.ImagePullSecrets != nil {
+				t.Errorf("podTemplate is modified: %v", podTemplate.Template.Spec)
+			}
+		})
+	}
+}
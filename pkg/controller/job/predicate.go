@@ -0,0 +1,36 @@
+package job
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// fencingJobPredicate drops the events of jobs not created by the controller,
+// e.g. when the fencing namespace is shared with other controllers
+var fencingJobPredicate = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return isFencingJob(e.Meta)
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return isFencingJob(e.MetaNew)
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return isFencingJob(e.Meta)
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return isFencingJob(e.Meta)
+	},
+}
+
+// isFencingJob returns true if the job is labeled with fencing=fence or fencing=confirm
+func isFencingJob(meta metav1.Object) bool {
+	if meta == nil {
+		return false
+	}
+	switch meta.GetLabels()["fencing"] {
+	case "fence", "confirm":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package job
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestFencingJobPredicate(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{name: "fencing job", labels: map[string]string{"fencing": "fence"}, want: true},
+		{name: "confirm job", labels: map[string]string{"fencing": "confirm"}, want: true},
+		{name: "after-hook job", labels: map[string]string{"fencing": "after-hook"}},
+		{name: "job of other controller", labels: map[string]string{"app": "backup"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := &metav1.ObjectMeta{Name: "job", Labels: tt.labels}
+			if got := fencingJobPredicate.Create(event.CreateEvent{Meta: meta}); got != tt.want {
+				t.Errorf("create event passed is %v, want %v", got, tt.want)
+			}
+			if got := fencingJobPredicate.Update(event.UpdateEvent{MetaOld: meta, MetaNew: meta}); got != tt.want {
+				t.Errorf("update event passed is %v, want %v", got, tt.want)
+			}
+			if got := fencingJobPredicate.Delete(event.DeleteEvent{Meta: meta}); got != tt.want {
+				t.Errorf("delete event passed is %v, want %v", got, tt.want)
+			}
+			if got := fencingJobPredicate.Generic(event.GenericEvent{Meta: meta}); got != tt.want {
+				t.Errorf("generic event passed is %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if fencingJobPredicate.Create(event.CreateEvent{}) {
+		t.Errorf("event without object is passed")
+	}
+}
@@ -0,0 +1,42 @@
+package node
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// resolveAddress returns the fencing target address of the node.
+// The address is taken from the key annotation, then from the node annotation named in fencing/address-annotation,
+// then from the node address of type specified in fencing/address-type, empty string is returned if nothing found.
+func resolveAddress(node *v1.Node, podTemplate *v1.PodTemplate, key string) string {
+	v, _ := getAnnotation(node, podTemplate, key)
+	return lookupAddress(node, v, func(k string) (string, bool) { return getAnnotation(node, podTemplate, k) })
+}
+
+// resolveTemplateAddress is resolveAddress reading the options from the PodTemplate only,
+// it is used by backends sending credentials to the address, so the node can not redirect them.
+func resolveTemplateAddress(node *v1.Node, podTemplate *v1.PodTemplate, key string) string {
+	return lookupAddress(node, podTemplate.Annotations[key], func(k string) (string, bool) {
+		v, ok := podTemplate.Annotations[k]
+		return v, ok
+	})
+}
+
+// lookupAddress returns the explicit address or resolves it by the options returned by option
+func lookupAddress(node *v1.Node, address string, option func(string) (string, bool)) string {
+	if address != "" {
+		return address
+	}
+	if k, ok := option("fencing/address-annotation"); ok {
+		if v := node.Annotations[k]; v != "" {
+			return v
+		}
+	}
+	if t, ok := option("fencing/address-type"); ok {
+		for _, a := range node.Status.Addresses {
+			if string(a.Type) == t {
+				return a.Address
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package node
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestResolveAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     map[string]string
+		template map[string]string
+		address  string
+	}{
+		{name: "nothing configured", address: ""},
+		{name: "explicit address", node: map[string]string{"fencing/address": "10.1.0.1"},
+			template: map[string]string{"fencing/address-type": "InternalIP"}, address: "10.1.0.1"},
+		{name: "node annotation", node: map[string]string{"metal3.io/bmc-address": "10.2.0.1"},
+			template: map[string]string{"fencing/address-annotation": "metal3.io/bmc-address", "fencing/address-type": "InternalIP"}, address: "10.2.0.1"},
+		{name: "missing node annotation falls back to address type", template: map[string]string{"fencing/address-annotation": "metal3.io/bmc-address", "fencing/address-type": "InternalIP"}, address: "192.168.0.1"},
+		{name: "custom address type", template: map[string]string{"fencing/address-type": "BMC"}, address: "10.3.0.1"},
+		{name: "first address of the type", template: map[string]string{"fencing/address-type": "ExternalIP"}, address: "203.0.113.1"},
+		{name: "unknown address type", template: map[string]string{"fencing/address-type": "IPMI"}, address: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", v1.ConditionUnknown, tt.node)
+			node.Status.Addresses = []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "node1"},
+				{Type: v1.NodeInternalIP, Address: "192.168.0.1"},
+				{Type: v1.NodeExternalIP, Address: "203.0.113.1"},
+				{Type: v1.NodeExternalIP, Address: "203.0.113.2"},
+				{Type: "BMC", Address: "10.3.0.1"},
+			}
+			if address := resolveAddress(node, newTestTemplate("fencing", tt.template), "fencing/address"); address != tt.address {
+				t.Errorf("address is %q, want %q", address, tt.address)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package node
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestApprovalGate(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		state       string
+		approved    bool
+	}{
+		{
+			name:        "fencing waits for approval",
+			annotations: map[string]string{"fencing/require-approval": "true"},
+			state:       "awaiting-approval",
+		},
+		{
+			name: "fencing keeps waiting without approval",
+			annotations: map[string]string{
+				"fencing/require-approval": "true",
+				"fencing/state":            "awaiting-approval",
+			},
+			state: "awaiting-approval",
+		},
+		{
+			name: "approval continues the fencing and is consumed",
+			annotations: map[string]string{
+				"fencing/require-approval": "true",
+				"fencing/state":            "awaiting-approval",
+				"fencing/approved":         "true",
+			},
+			state: "started",
+		},
+		{
+			name: "approval other than true is ignored",
+			annotations: map[string]string{
+				"fencing/require-approval": "true",
+				"fencing/state":            "awaiting-approval",
+				"fencing/approved":         "yes",
+			},
+			state:    "awaiting-approval",
+			approved: true,
+		},
+		{
+			name:        "fencing without approval gate is started",
+			annotations: map[string]string{},
+			state:       "started",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.annotations["fencing/enabled"] = "true"
+			r := newTestReconciler(
+				newTestNode("node1", v1.ConditionUnknown, tt.annotations),
+				newTestTemplate("fencing", nil),
+			)
+			node, _, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			if _, ok := node.Annotations["fencing/approved"]; ok != tt.approved {
+				t.Errorf("fencing/approved is present: %v, want %v", ok, tt.approved)
+			}
+		})
+	}
+}
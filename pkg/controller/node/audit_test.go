@@ -0,0 +1,40 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/kvaps/kube-fencing/pkg/audit"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestAuditFenceStart(t *testing.T) {
+	defer func(sink io.Writer) {
+		audit.Sink = sink
+	}(audit.Sink)
+	buf := &bytes.Buffer{}
+	audit.Sink = buf
+
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true"})
+	r := newTestReconciler(node, newTestTemplate("fencing", nil))
+	node, _, err := reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if state := node.Annotations["fencing/state"]; state != "started" {
+		t.Fatalf("state is %q, want started", state)
+	}
+
+	rec := audit.Record{}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("audit record is not JSON: %v: %q", err, buf.String())
+	}
+	if rec.Node != "node1" || rec.Decision != "start" {
+		t.Errorf("audit record is %+v, want the start decision for node1", rec)
+	}
+	if rec.Conditions["Ready"] != "Unknown" || rec.Annotations["fencing/enabled"] != "true" {
+		t.Errorf("audit record inputs are %v and %v", rec.Conditions, rec.Annotations)
+	}
+}
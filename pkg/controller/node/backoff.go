@@ -0,0 +1,60 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// defaultBackoffMax is the default cap of the delay between fencing attempts
+const defaultBackoffMax = 10 * time.Minute
+
+// attemptAnnotations returns the annotations recording a new fencing attempt
+func attemptAnnotations(node *v1.Node) map[string]interface{} {
+	attempts, _ := strconv.Atoi(node.Annotations["fencing/attempts"])
+	return map[string]interface{}{
+		"fencing/attempts":     strconv.Itoa(attempts + 1),
+		"fencing/last-attempt": strconv.FormatInt(time.Now().Unix(), 10),
+	}
+}
+
+// maxAttempts returns fencing/max-attempts of the node or podTemplate, 0 means unlimited.
+// Failed fencing job is not retried by default, errors of other backends are retried until the attempts are exhausted.
+func maxAttempts(node *v1.Node, podTemplate *v1.PodTemplate, backend string) int {
+	if v, ok := getAnnotation(node, podTemplate, "fencing/max-attempts"); ok {
+		max, _ := strconv.Atoi(v)
+		return max
+	}
+	if backend == "" || backend == "job" {
+		return 1
+	}
+	return 0
+}
+
+// attemptsExhausted returns true if no more fencing attempts are allowed after the failed one
+func attemptsExhausted(node *v1.Node, podTemplate *v1.PodTemplate, backend string) bool {
+	max := maxAttempts(node, podTemplate, backend)
+	attempts, _ := strconv.Atoi(node.Annotations["fencing/attempts"])
+	return max > 0 && attempts >= max
+}
+
+// failAttempts marks the node fencing as failed when its last attempt failed
+func (r *ReconcileNode) failAttempts(node *v1.Node, podTemplate *v1.PodTemplate, reason string) error {
+	klog.Infoln("Failed fencing node", node.Name, ":", reason)
+	err := util.PatchNodeAnnotations(context.TODO(), r.client, node, map[string]interface{}{
+		"fencing/state":      "failed",
+		"fencing/timestamp":  nil,
+		"fencing/last-error": reason,
+	})
+	if err != nil {
+		klog.Errorln("Failed to patch node", node.Name, ":", err)
+		return err
+	}
+	r.audit(node, podTemplate, "failed", reason)
+	r.recorder.Event(node, v1.EventTypeWarning, "FencingFailed", "Fencing failed after "+node.Annotations["fencing/attempts"]+" attempts: "+reason)
+	return nil
+}
@@ -0,0 +1,132 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestAttemptsExhausted(t *testing.T) {
+	tests := []struct {
+		name      string
+		backend   string
+		node      map[string]string
+		template  map[string]string
+		max       int
+		exhausted bool
+	}{
+		{name: "failed job is not retried by default", backend: "job", node: map[string]string{"fencing/attempts": "1"}, max: 1, exhausted: true},
+		{name: "default backend is job", node: map[string]string{"fencing/attempts": "1"}, max: 1, exhausted: true},
+		{name: "other backends are retried by default", backend: "webhook", node: map[string]string{"fencing/attempts": "5"}, max: 0},
+		{name: "attempts are left", backend: "job", node: map[string]string{"fencing/attempts": "1", "fencing/max-attempts": "3"}, max: 3},
+		{name: "attempts are exhausted", backend: "redfish", node: map[string]string{"fencing/attempts": "3", "fencing/max-attempts": "3"}, max: 3, exhausted: true},
+		{name: "max-attempts from podTemplate", backend: "job", node: map[string]string{"fencing/attempts": "1"}, template: map[string]string{"fencing/max-attempts": "2"}, max: 2},
+		{name: "zero max-attempts is unlimited", backend: "job", node: map[string]string{"fencing/attempts": "10", "fencing/max-attempts": "0"}, max: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", v1.ConditionUnknown, tt.node)
+			podTemplate := newTestTemplate("fencing", tt.template)
+			if max := maxAttempts(node, podTemplate, tt.backend); max != tt.max {
+				t.Errorf("max attempts is %d, want %d", max, tt.max)
+			}
+			if exhausted := attemptsExhausted(node, podTemplate, tt.backend); exhausted != tt.exhausted {
+				t.Errorf("attempts exhausted is %v, want %v", exhausted, tt.exhausted)
+			}
+		})
+	}
+}
+
+func TestJobRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts string
+		retried     bool
+	}{
+		{name: "failed job is kept for the job controller", maxAttempts: "1"},
+		{name: "failed job is replaced by a new attempt", maxAttempts: "2", retried: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failed := newTestJob("fence-node1", "node1", "fence")
+			failed.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue}}
+			r := newTestReconciler(
+				newTestNode("node1", v1.ConditionUnknown, map[string]string{
+					"fencing/enabled":      "true",
+					"fencing/state":        "started",
+					"fencing/attempts":     "1",
+					"fencing/max-attempts": tt.maxAttempts,
+				}),
+				newTestTemplate("fencing", nil),
+				failed,
+			)
+			node, _, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+
+			jobs := &batchv1.JobList{}
+			if err := r.client.List(context.TODO(), jobs, client.MatchingLabels{"node": "node1"}); err != nil {
+				t.Fatalf("list jobs failed: %v", err)
+			}
+			if len(jobs.Items) != 1 {
+				t.Fatalf("node has %d jobs, want 1", len(jobs.Items))
+			}
+			_, jf := util.GetJobCondition(&jobs.Items[0].Status, batchv1.JobFailed)
+			if retried := jf == nil; retried != tt.retried {
+				t.Errorf("job is retried %v, want %v", retried, tt.retried)
+			}
+			attempts := "1"
+			if tt.retried {
+				attempts = "2"
+			}
+			if node.Annotations["fencing/attempts"] != attempts {
+				t.Errorf("attempts are %q, want %q", node.Annotations["fencing/attempts"], attempts)
+			}
+		})
+	}
+}
+
+func TestRemovedJobRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts string
+		state       string
+		jobs        int
+	}{
+		{name: "job removed by failed confirmation is not retried", state: "failed"},
+		{name: "job removed by failed confirmation is retried", maxAttempts: "2", state: "started", jobs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			annotations := map[string]string{
+				"fencing/enabled":    "true",
+				"fencing/state":      "started",
+				"fencing/attempts":   "1",
+				"fencing/last-error": "confirm job failed",
+			}
+			if tt.maxAttempts != "" {
+				annotations["fencing/max-attempts"] = tt.maxAttempts
+			}
+			r := newTestReconciler(newTestNode("node1", v1.ConditionUnknown, annotations), newTestTemplate("fencing", nil))
+			node, _, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			jobs := &batchv1.JobList{}
+			if err := r.client.List(context.TODO(), jobs, client.MatchingLabels{"node": "node1"}); err != nil {
+				t.Fatalf("list jobs failed: %v", err)
+			}
+			if len(jobs.Items) != tt.jobs {
+				t.Errorf("node has %d jobs, want %d", len(jobs.Items), tt.jobs)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package node
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+var (
+	// BatchWindow is the debounce window gathering simultaneously failed nodes before fencing decisions, 0 disables it
+	BatchWindow time.Duration
+)
+
+// batchRecheckInterval is the interval of rechecking the quorum of the held batch
+const batchRecheckInterval = 30 * time.Second
+
+// failureBatch gathers the nodes failed within BatchWindow of each other, e.g. on the whole rack failure,
+// so the fencing decisions are made when the burst is over and all its nodes are known
+type failureBatch struct {
+	mu sync.Mutex
+	// nodes are the failed nodes of the current batch
+	nodes map[string]bool
+	// last is the time the last node joined the batch
+	last time.Time
+	// reported is true if the batch composition was logged
+	reported bool
+	// checked is true if the batch was evaluated, lastAdmitted is the result of the last evaluation,
+	// they are used for logging the changed decisions only
+	checked      bool
+	lastAdmitted bool
+}
+
+// newFailureBatch returns a new failureBatch
+func newFailureBatch() *failureBatch {
+	return &failureBatch{nodes: map[string]bool{}}
+}
+
+// join adds the failed node to the batch and returns the remaining time until the batch is closed
+func (b *failureBatch) join(name string, now time.Time) time.Duration {
+	if BatchWindow <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Start a new batch after the previous one is evaluated
+	if now.Sub(b.last) > 2*BatchWindow {
+		b.nodes = map[string]bool{}
+		b.reported = false
+		b.checked = false
+	}
+	if !b.nodes[name] {
+		b.nodes[name] = true
+		b.last = now
+		b.reported = false
+	}
+	if remain := b.last.Add(BatchWindow).Sub(now); remain > 0 {
+		return remain
+	}
+	if !b.reported {
+		b.reported = true
+		var names []string
+		for n := range b.nodes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		klog.Infoln("Evaluating batch of", len(names), "failed nodes:", strings.Join(names, ", "))
+	}
+	return 0
+}
+
+// evaluate returns true if the closed batch is admitted to fencing by check, the check is given the number of nodes
+// in the batch, so the burst is judged as a whole rather than node by node. The check is made on every call,
+// so the nodes joined later and the changed quorum are always taken into account
+func (b *failureBatch) evaluate(check func(size int) (bool, error)) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	admitted, err := check(len(b.nodes))
+	if err != nil {
+		return false, err
+	}
+	if !b.checked || admitted != b.lastAdmitted {
+		if admitted {
+			klog.Infoln("Batch of", len(b.nodes), "failed nodes is admitted to fencing")
+		} else {
+			klog.Infoln("Batch of", len(b.nodes), "failed nodes is held by quorum limit")
+		}
+	}
+	b.checked, b.lastAdmitted = true, admitted
+	return admitted, nil
+}
+
+// leave removes the node from the batch
+func (b *failureBatch) leave(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.nodes, name)
+}
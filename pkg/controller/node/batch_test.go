@@ -0,0 +1,133 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestBatchEvaluate(t *testing.T) {
+	defer func(window time.Duration) {
+		BatchWindow = window
+	}(BatchWindow)
+	BatchWindow = time.Minute
+
+	b := newFailureBatch()
+	now := time.Now()
+	b.join("node1", now)
+	b.join("node2", now)
+	if remain := b.join("node1", now.Add(BatchWindow)); remain != 0 {
+		t.Fatalf("batch is closed in %v, want closed", remain)
+	}
+
+	steps := []struct {
+		name     string
+		admit    bool
+		admitted bool
+	}{
+		{name: "batch is held", admitted: false},
+		{name: "held batch is rechecked", admit: true, admitted: true},
+		{name: "admitted batch is rechecked", admit: false, admitted: false},
+	}
+	for _, s := range steps {
+		var size int
+		admitted, err := b.evaluate(func(n int) (bool, error) {
+			size = n
+			return s.admit, nil
+		})
+		if err != nil {
+			t.Fatalf("%s: evaluate failed: %v", s.name, err)
+		}
+		if admitted != s.admitted || size != 2 {
+			t.Errorf("%s: admitted %v for batch of %d, want %v for batch of 2", s.name, admitted, size, s.admitted)
+		}
+	}
+
+	// New node is counted in the batch
+	b.join("node3", now.Add(BatchWindow))
+	var size int
+	b.evaluate(func(n int) (bool, error) {
+		size = n
+		return true, nil
+	})
+	if size != 3 {
+		t.Errorf("batch with new node has %d nodes, want 3", size)
+	}
+}
+
+func TestBatchQuorum(t *testing.T) {
+	defer func(window time.Duration, min int) {
+		BatchWindow, MinHealthyNodes = window, min
+	}(BatchWindow, MinHealthyNodes)
+	BatchWindow, MinHealthyNodes = 50*time.Millisecond, 2
+
+	failed := []string{"node1", "node2", "node3"}
+	tests := []struct {
+		name  string
+		ready int
+		// recovered is the number of nodes becoming Ready after the burst is gathered
+		recovered int
+		state     string
+	}{
+		{name: "batch is admitted as a whole", ready: 4, state: "started"},
+		{name: "batch is held by min-healthy-nodes", ready: 1, state: ""},
+		// Each node alone passes min-healthy-nodes, but the burst outnumbers the healthy nodes
+		{name: "burst outnumbering healthy nodes is held", ready: 3, state: ""},
+		{name: "batch is admitted once enough nodes recovered", ready: 3, recovered: 1, state: "started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := newTestTemplate("fencing", map[string]string{"fencing/enabled": "true"})
+			r := newTestReconciler(template)
+			for _, name := range failed {
+				if err := r.client.Create(context.TODO(), newTestNode(name, v1.ConditionUnknown, nil)); err != nil {
+					t.Fatalf("create node failed: %v", err)
+				}
+			}
+			for i := 0; i < tt.ready; i++ {
+				if err := r.client.Create(context.TODO(), newTestNode("ready"+strconv.Itoa(i), v1.ConditionTrue, nil)); err != nil {
+					t.Fatalf("create node failed: %v", err)
+				}
+			}
+
+			// The burst of failures is gathered
+			for _, name := range failed {
+				node, result, err := reconcileNode(r, name)
+				if err != nil {
+					t.Fatalf("reconcile failed: %v", err)
+				}
+				if result.RequeueAfter <= 0 || node.Annotations["fencing/state"] != "" {
+					t.Errorf("node %s is not gathered: state %q, requeue after %v", name, node.Annotations["fencing/state"], result.RequeueAfter)
+				}
+			}
+			time.Sleep(BatchWindow)
+			for j := 0; j < tt.recovered; j++ {
+				if err := r.client.Create(context.TODO(), newTestNode("recovered"+strconv.Itoa(j), v1.ConditionTrue, nil)); err != nil {
+					t.Fatalf("create node failed: %v", err)
+				}
+			}
+
+			// The node alone is held only if its quorum limit is not met
+			wantLimit := ""
+			if tt.ready+tt.recovered < MinHealthyNodes {
+				wantLimit = "quorum"
+			}
+			for _, name := range failed {
+				limit, err := r.checkLimits(context.TODO(), newTestNode(name, v1.ConditionUnknown, nil), template)
+				if err != nil || limit != wantLimit {
+					t.Fatalf("node %s alone is held by %q limit (error %v), want %q", name, limit, err, wantLimit)
+				}
+				node, _, err := reconcileNode(r, name)
+				if err != nil {
+					t.Fatalf("reconcile failed: %v", err)
+				}
+				if state := node.Annotations["fencing/state"]; state != tt.state {
+					t.Errorf("node %s state is %q, want %q", name, state, tt.state)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package node
+
+import (
+	"context"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClearFencing resets the fencing of the node stuck in failed or fenced state, so it can be fenced again:
+// the fencing jobs of the node are deleted and the fencing state annotations are removed like on recovery,
+// configuration annotations such as fencing/enabled are preserved
+func ClearFencing(ctx context.Context, c client.Client, nodeName string) error {
+	node := &v1.Node{}
+	if err := c.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		return err
+	}
+
+	jobs := &batchv1.JobList{}
+	if !JobsDisabled {
+		err := c.List(ctx, jobs,
+			client.InNamespace(jobNamespace()),
+			client.MatchingLabels{"fencing": "fence"},
+			client.MatchingFields{jobNodeIndex: node.Name},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range jobs.Items {
+		klog.Infoln("Deleting fencing job", jobs.Items[i].Name)
+		err := c.Delete(ctx, &jobs.Items[i],
+			client.GracePeriodSeconds(0),
+			client.PropagationPolicy(metav1.DeletePropagationBackground),
+		)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	if err := util.RemoveOutOfServiceTaint(ctx, c, node); err != nil {
+		return err
+	}
+
+	annotations := clearedStateAnnotations()
+	annotations["fencing/interrupted"] = nil
+	annotations["fencing/approved"] = nil
+	if err := util.PatchNodeAnnotations(ctx, c, node, annotations); err != nil {
+		return err
+	}
+	klog.Infoln("Fencing state of node", node.Name, "is cleared")
+	return nil
+}
@@ -0,0 +1,101 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestClearFencing(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		jobs        []*batchv1.Job
+		deleted     []string
+		kept        []string
+	}{
+		{
+			name: "failed node",
+			annotations: map[string]string{
+				"fencing/state":      "failed",
+				"fencing/last-error": "job failed",
+				"fencing/attempts":   "3",
+			},
+			jobs:    []*batchv1.Job{newTestJob("fence-node1", "node1", "fence")},
+			deleted: []string{"fence-node1"},
+		},
+		{
+			name: "fenced node keeps its archived jobs",
+			annotations: map[string]string{
+				"fencing/state":     "fenced",
+				"fencing/fenced-at": "1",
+				"fencing/job-uid":   "uid",
+			},
+			jobs: []*batchv1.Job{
+				newTestJob("fence-node1", "node1", "fence"),
+				newTestJob("fence-node1-1", "node1", "retained"),
+			},
+			deleted: []string{"fence-node1"},
+			kept:    []string{"fence-node1-1"},
+		},
+		{
+			name: "interrupted node without jobs",
+			annotations: map[string]string{
+				"fencing/state":       "started",
+				"fencing/interrupted": "1",
+				"fencing/approved":    "true",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.annotations["fencing/enabled"] = "true"
+			tt.annotations["fencing/template"] = "fencing-ipmi"
+			objs := []runtime.Object{newTestNode("node1", v1.ConditionUnknown, tt.annotations)}
+			for _, job := range tt.jobs {
+				objs = append(objs, job)
+			}
+			r := newTestReconciler(objs...)
+			if err := ClearFencing(context.TODO(), r.client, "node1"); err != nil {
+				t.Fatalf("clear failed: %v", err)
+			}
+
+			node := &v1.Node{}
+			if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "node1"}, node); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range node.Annotations {
+				switch k {
+				case "fencing/enabled", "fencing/template":
+				default:
+					t.Errorf("annotation %s=%s is not cleared", k, v)
+				}
+			}
+			if len(node.Annotations) != 2 {
+				t.Errorf("configuration annotations are not preserved: %v", node.Annotations)
+			}
+
+			for _, name := range tt.deleted {
+				err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: Namespace, Name: name}, &batchv1.Job{})
+				if !errors.IsNotFound(err) {
+					t.Errorf("job %s is not deleted: %v", name, err)
+				}
+			}
+			for _, name := range tt.kept {
+				if err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: Namespace, Name: name}, &batchv1.Job{}); err != nil {
+					t.Errorf("job %s is not kept: %v", name, err)
+				}
+			}
+		})
+	}
+
+	r := newTestReconciler()
+	if err := ClearFencing(context.TODO(), r.client, "node2"); !errors.IsNotFound(err) {
+		t.Errorf("clear of unknown node returned %v, want NotFound", err)
+	}
+}
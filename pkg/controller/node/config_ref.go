@@ -0,0 +1,93 @@
+package node
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// templateOnlyOptions are never taken from the node ConfigMap, as the node can reference any ConfigMap in Namespace,
+// so it could make the controller call arbitrary endpoints or send the BMC credentials anywhere
+var templateOnlyOptions = map[string]bool{
+	"fencing/webhook-url":        true,
+	"fencing/health-check-url":   true,
+	"fencing/max-concurrent":     true,
+	"fencing/address-annotation": true,
+	"fencing/address-type":       true,
+	"fencing/redfish-address":    true,
+	"fencing/redfish-secret":     true,
+	"fencing/redfish-system":     true,
+	"fencing/redfish-reset-type": true,
+	"fencing/redfish-insecure":   true,
+	"fencing/ipmi-address":       true,
+	"fencing/ipmi-secret":        true,
+	"fencing/ipmi-interface":     true,
+	"fencing/ipmi-command":       true,
+	"fencing/host-network":       true,
+	"fencing/privileged":         true,
+	"fencing/service-account":    true,
+	"fencing/pull-secret":        true,
+}
+
+// nodeConfig returns the fencing options from the ConfigMap in Namespace referenced by fencing/config-ref annotation
+// of the node. ConfigMap keys are the option names without fencing/ prefix, e.g. timeout for fencing/timeout.
+// Missing ConfigMap is reported and ignored, so are the templateOnlyOptions. Container args are not configurable
+// this way, they are defined by the PodTemplate selected with template key.
+func (r *ReconcileNode) nodeConfig(node *v1.Node) map[string]string {
+	name := node.Annotations["fencing/config-ref"]
+	if name == "" {
+		return nil
+	}
+	cm := &v1.ConfigMap{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: Namespace, Name: name}, cm)
+	if err != nil {
+		klog.Errorln("Failed to get configmap", name, "of node", node.Name, ":", err)
+		return nil
+	}
+	config := map[string]string{}
+	for k, v := range cm.Data {
+		if templateOnlyOptions["fencing/"+k] {
+			klog.Warningln("Ignoring", k, "of configmap", name, "of node", node.Name, ": it can be specified in the PodTemplate only")
+			continue
+		}
+		config["fencing/"+k] = v
+	}
+	return config
+}
+
+// configNodes returns the reconcile requests for the nodes referencing the changed ConfigMap by fencing/config-ref
+func (r *ReconcileNode) configNodes(obj handler.MapObject) []reconcile.Request {
+	if obj.Meta.GetNamespace() != Namespace {
+		return nil
+	}
+	nodes := &v1.NodeList{}
+	if err := r.client.List(context.TODO(), nodes); err != nil {
+		klog.Errorln("Failed to list nodes for configmap", obj.Meta.GetName(), ":", err)
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, node := range nodes.Items {
+		if node.Annotations["fencing/config-ref"] == obj.Meta.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: node.Name}})
+		}
+	}
+	return requests
+}
+
+// layerConfig puts the fencing options from the node ConfigMap over the podTemplate annotations,
+// so they are overridden by the node annotations only
+func layerConfig(podTemplate *v1.PodTemplate, config map[string]string) {
+	if len(config) == 0 {
+		return
+	}
+	if podTemplate.Annotations == nil {
+		podTemplate.Annotations = map[string]string{}
+	}
+	for k, v := range config {
+		podTemplate.Annotations[k] = v
+	}
+}
@@ -0,0 +1,140 @@
+package node
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// newTestConfig returns the ConfigMap with the fencing options
+func newTestConfig(name, namespace string, data map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Data:       data,
+	}
+}
+
+func TestNodeConfigLayering(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     map[string]string
+		template map[string]string
+		config   *v1.ConfigMap
+		timeout  string
+		defined  bool
+	}{
+		{name: "no config-ref", template: map[string]string{"fencing/timeout": "1m"}, timeout: "1m", defined: true},
+		{name: "config overrides podTemplate", node: map[string]string{"fencing/config-ref": "rack1"}, template: map[string]string{"fencing/timeout": "1m"},
+			config: newTestConfig("rack1", Namespace, map[string]string{"timeout": "2m"}), timeout: "2m", defined: true},
+		{name: "node overrides config", node: map[string]string{"fencing/config-ref": "rack1", "fencing/timeout": "3m"},
+			config: newTestConfig("rack1", Namespace, map[string]string{"timeout": "2m"}), timeout: "3m", defined: true},
+		{name: "missing config is ignored", node: map[string]string{"fencing/config-ref": "rack1"}, template: map[string]string{"fencing/timeout": "1m"}, timeout: "1m", defined: true},
+		{name: "config of other namespace is ignored", node: map[string]string{"fencing/config-ref": "rack1"},
+			config: newTestConfig("rack1", "default", map[string]string{"timeout": "2m"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []runtime.Object{newTestTemplate("fencing", tt.template)}
+			if tt.config != nil {
+				objs = append(objs, tt.config)
+			}
+			node := newTestNode("node1", v1.ConditionUnknown, tt.node)
+			r := newTestReconciler(objs...)
+			podTemplate, err := r.getPodTemplate(node)
+			if err != nil {
+				t.Fatalf("get template failed: %v", err)
+			}
+			timeout, defined := getAnnotation(node, podTemplate, "fencing/timeout")
+			if timeout != tt.timeout || defined != tt.defined {
+				t.Errorf("timeout is %q (defined %v), want %q (defined %v)", timeout, defined, tt.timeout, tt.defined)
+			}
+		})
+	}
+}
+
+func TestNodeConfigTemplate(t *testing.T) {
+	r := newTestReconciler(
+		newTestTemplate("fencing", nil),
+		newTestTemplate("ipmi", nil),
+		newTestConfig("rack1", Namespace, map[string]string{"template": "ipmi"}),
+	)
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/config-ref": "rack1"})
+	podTemplate, err := r.getPodTemplate(node)
+	if err != nil {
+		t.Fatalf("get template failed: %v", err)
+	}
+	if podTemplate.Name != "ipmi" {
+		t.Errorf("template is %q, want ipmi", podTemplate.Name)
+	}
+}
+
+func TestNodeConfigTemplateOnly(t *testing.T) {
+	template := map[string]string{
+		"fencing/webhook-url":      "http://fencer/fence",
+		"fencing/redfish-insecure": "false",
+	}
+	config := map[string]string{
+		"timeout":          "2m",
+		"webhook-url":      "http://attacker/fence",
+		"health-check-url": "http://attacker/health",
+		"redfish-address":  "https://attacker",
+		"redfish-secret":   "other",
+		"redfish-insecure": "true",
+		"ipmi-command":     "cycle",
+		"privileged":       "true",
+		"service-account":  "admin",
+		"args":             "--force",
+	}
+	r := newTestReconciler(newTestTemplate("fencing", template), newTestConfig("rack1", Namespace, config))
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/config-ref": "rack1"})
+	podTemplate, err := r.getPodTemplate(node)
+	if err != nil {
+		t.Fatalf("get template failed: %v", err)
+	}
+	want := map[string]string{
+		"fencing/timeout":          "2m",
+		"fencing/webhook-url":      "http://fencer/fence",
+		"fencing/redfish-insecure": "false",
+		"fencing/args":             "--force",
+	}
+	if !reflect.DeepEqual(podTemplate.Annotations, want) {
+		t.Errorf("podTemplate annotations are %v, want %v", podTemplate.Annotations, want)
+	}
+	// Container args are defined by the PodTemplate only
+	job := newJobForNode(node, podTemplate)
+	if args := job.Spec.Template.Spec.Containers[0].Args; len(args) != 0 {
+		t.Errorf("container args are %v, want the PodTemplate ones", args)
+	}
+}
+
+func TestConfigNodes(t *testing.T) {
+	r := newTestReconciler(
+		newTestNode("node1", v1.ConditionTrue, map[string]string{"fencing/config-ref": "rack1"}),
+		newTestNode("node2", v1.ConditionTrue, map[string]string{"fencing/config-ref": "rack2"}),
+		newTestNode("node3", v1.ConditionTrue, nil),
+	)
+	tests := []struct {
+		name     string
+		config   *v1.ConfigMap
+		requests []reconcile.Request
+	}{
+		{name: "referenced config", config: newTestConfig("rack1", Namespace, nil),
+			requests: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "node1"}}}},
+		{name: "not referenced config", config: newTestConfig("rack3", Namespace, nil)},
+		{name: "config of other namespace", config: newTestConfig("rack1", "default", nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := r.configNodes(handler.MapObject{Meta: tt.config, Object: tt.config})
+			if !reflect.DeepEqual(requests, tt.requests) {
+				t.Errorf("requests are %v, want %v", requests, tt.requests)
+			}
+		})
+	}
+}
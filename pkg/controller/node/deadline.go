@@ -0,0 +1,64 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// deadlineRemains returns the time remaining until the whole fencing procedure of the node, counted from
+// fencing/first-timestamp, exceeds fencing/overall-deadline, ok is false if there is no deadline
+func deadlineRemains(node *v1.Node, podTemplate *v1.PodTemplate) (remain time.Duration, ok bool) {
+	v, ok := getAnnotation(node, podTemplate, "fencing/overall-deadline")
+	if !ok {
+		return 0, false
+	}
+	deadline, err := util.ParseDuration(v)
+	if err != nil || deadline <= 0 {
+		return 0, false
+	}
+	first, _ := strconv.ParseInt(node.Annotations["fencing/first-timestamp"], 10, 64)
+	if first == 0 {
+		return 0, false
+	}
+	return time.Until(time.Unix(first, 0).Add(deadline)), true
+}
+
+// failOnDeadline stops the running fencing job and marks the node fencing as failed
+func (r *ReconcileNode) failOnDeadline(node *v1.Node) error {
+	klog.Infoln("Fencing of node", node.Name, "exceeded overall deadline")
+
+	found, err := r.findJob(node)
+	if err != nil {
+		return err
+	}
+	if found != nil {
+		_, jc := util.GetJobCondition(&found.Status, batchv1.JobComplete)
+		_, jf := util.GetJobCondition(&found.Status, batchv1.JobFailed)
+		if jc == nil && jf == nil {
+			klog.Infoln("Deleting fencing job", found.Name)
+			err = r.deleteJob(context.TODO(), node.Name, found)
+			if err != nil {
+				klog.Errorln("Failed to delete job", found.Name, ":", err)
+				return err
+			}
+		}
+	}
+
+	err = util.PatchNodeAnnotations(context.TODO(), r.client, node, map[string]interface{}{
+		"fencing/state":      "failed",
+		"fencing/timestamp":  nil,
+		"fencing/last-error": "overall deadline exceeded",
+	})
+	if err != nil {
+		klog.Errorln("Failed to patch node", node.Name, ":", err)
+		return err
+	}
+	r.recorder.Event(node, v1.EventTypeWarning, "FencingFailed", "Fencing exceeded overall deadline")
+	return nil
+}
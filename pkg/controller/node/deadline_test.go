@@ -0,0 +1,66 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestOverallDeadline(t *testing.T) {
+	tests := []struct {
+		name    string
+		started time.Duration
+		state   string
+		deleted bool
+	}{
+		{name: "retry within deadline", started: 5 * time.Minute, state: "started"},
+		{name: "deadline elapsed mid-retry", started: 20 * time.Minute, state: "failed", deleted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := strconv.FormatInt(time.Now().Add(-tt.started).Unix(), 10)
+			node := newTestNode("node1", v1.ConditionUnknown, map[string]string{
+				"fencing/enabled":          "true",
+				"fencing/state":            "started",
+				"fencing/first-timestamp":  first,
+				"fencing/started-at":       first,
+				"fencing/attempts":         "2",
+				"fencing/overall-deadline": "10m",
+			})
+			// The retried job is running
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "fence-node1",
+					Namespace: Namespace,
+					Labels:    map[string]string{"fencing": "fence", "node": "node1"},
+				},
+			}
+			r := newTestReconciler(node, job, newTestTemplate("fencing", nil))
+			node, result, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: Namespace, Name: "fence-node1"}, &batchv1.Job{})
+			if deleted := errors.IsNotFound(err); deleted != tt.deleted {
+				t.Errorf("job is deleted %v, want %v", deleted, tt.deleted)
+			}
+			if tt.deleted {
+				if node.Annotations["fencing/last-error"] != "overall deadline exceeded" {
+					t.Errorf("last error is %q", node.Annotations["fencing/last-error"])
+				}
+			} else if result.RequeueAfter <= 0 || result.RequeueAfter > 5*time.Minute {
+				t.Errorf("requeue after %v, want the deadline recheck", result.RequeueAfter)
+			}
+		})
+	}
+}
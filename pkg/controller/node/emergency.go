@@ -0,0 +1,58 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// EmergencyFence enables fencing of all NotReady nodes matching the selector and starts fencing them at once,
+// skipping fencing/timeout, health check and approval, while concurrency and quorum limits still apply.
+// The nodes already fenced or being fenced are skipped, names of the nodes started to fence are returned.
+func EmergencyFence(ctx context.Context, c client.Client, selector labels.Selector) ([]string, error) {
+	nodes := &v1.NodeList{}
+	if err := c.List(ctx, nodes, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	var started []string
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if !nodeNameAllowed(node.Name) {
+			continue
+		}
+		if _, cond := util.GetNodeCondition(&node.Status, v1.NodeReady); cond != nil && cond.Status == v1.ConditionTrue {
+			continue
+		}
+		switch node.Annotations["fencing/state"] {
+		case "", "pending", "awaiting-approval", "recovered":
+		default:
+			continue
+		}
+
+		annotations := map[string]interface{}{
+			"fencing/enabled":      "true",
+			"fencing/emergency":    "true",
+			"fencing/state":        "started",
+			"fencing/started-at":   now,
+			"fencing/timestamp":    nil,
+			"fencing/attempts":     nil,
+			"fencing/last-attempt": nil,
+		}
+		if _, ok := node.Annotations["fencing/first-timestamp"]; !ok {
+			annotations["fencing/first-timestamp"] = now
+		}
+		if err := util.PatchNodeAnnotations(ctx, c, node, annotations); err != nil {
+			return started, err
+		}
+		klog.Infoln("Emergency fencing node", node.Name)
+		started = append(started, node.Name)
+	}
+	return started, nil
+}
@@ -0,0 +1,128 @@
+package node
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestEmergencyFence(t *testing.T) {
+	type testNode struct {
+		name   string
+		ready  v1.ConditionStatus
+		state  string
+		labels map[string]string
+	}
+	rack1 := map[string]string{"rack": "r1"}
+	nodes := []testNode{
+		{name: "node1", ready: v1.ConditionUnknown, labels: rack1},
+		{name: "node2", ready: v1.ConditionFalse, state: "pending", labels: rack1},
+		{name: "node3", ready: v1.ConditionTrue, labels: rack1},
+		{name: "node4", ready: v1.ConditionUnknown, state: "fenced", labels: rack1},
+		{name: "node5", ready: v1.ConditionUnknown, state: "started", labels: rack1},
+		{name: "node6", ready: v1.ConditionUnknown, labels: map[string]string{"rack": "r2"}},
+	}
+
+	tests := []struct {
+		name     string
+		selector string
+		started  []string
+	}{
+		{name: "NotReady nodes of the rack", selector: "rack=r1", started: []string{"node1", "node2"}},
+		{name: "other rack", selector: "rack=r2", started: []string{"node6"}},
+		{name: "no matching nodes", selector: "rack=r3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objs []runtime.Object
+			for _, n := range nodes {
+				annotations := map[string]string{}
+				if n.state != "" {
+					annotations["fencing/state"] = n.state
+				}
+				node := newTestNode(n.name, n.ready, annotations)
+				node.Labels = n.labels
+				objs = append(objs, node)
+			}
+			r := newTestReconciler(objs...)
+			selector, err := labels.Parse(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			started, err := EmergencyFence(context.TODO(), r.client, selector)
+			if err != nil {
+				t.Fatalf("emergency fence failed: %v", err)
+			}
+			sort.Strings(started)
+			if !reflect.DeepEqual(started, tt.started) {
+				t.Errorf("started %v, want %v", started, tt.started)
+			}
+
+			for _, name := range tt.started {
+				node := &v1.Node{}
+				if err := r.client.Get(context.TODO(), types.NamespacedName{Name: name}, node); err != nil {
+					t.Fatal(err)
+				}
+				for k, v := range map[string]string{
+					"fencing/enabled":   "true",
+					"fencing/emergency": "true",
+					"fencing/state":     "started",
+				} {
+					if node.Annotations[k] != v {
+						t.Errorf("node %s has %s=%q, want %q", name, k, node.Annotations[k], v)
+					}
+				}
+			}
+			// Ready and already fenced nodes are left as is
+			for _, name := range []string{"node3", "node4"} {
+				node := &v1.Node{}
+				if err := r.client.Get(context.TODO(), types.NamespacedName{Name: name}, node); err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := node.Annotations["fencing/emergency"]; ok {
+					t.Errorf("node %s is fenced in emergency", name)
+				}
+			}
+		})
+	}
+}
+
+func TestEmergencyFenceLimits(t *testing.T) {
+	defer func(max int) {
+		MaxConcurrentFences = max
+	}(MaxConcurrentFences)
+	MaxConcurrentFences = 1
+
+	var objs []runtime.Object
+	for _, name := range []string{"node1", "node2"} {
+		node := newTestNode(name, v1.ConditionUnknown, nil)
+		node.Labels = map[string]string{"rack": "r1"}
+		objs = append(objs, node)
+	}
+	objs = append(objs, newTestTemplate("fencing", nil))
+	r := newTestReconciler(objs...)
+	if _, err := EmergencyFence(context.TODO(), r.client, labels.SelectorFromSet(labels.Set{"rack": "r1"})); err != nil {
+		t.Fatalf("emergency fence failed: %v", err)
+	}
+
+	// The first node occupies the only slot, the second one waits for it
+	if _, _, err := reconcileNode(r, "node1"); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	node, result, err := reconcileNode(r, "node2")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Errorf("emergency fencing of node2 is not deferred by concurrency limit")
+	}
+	if _, ok := node.Annotations["fencing/job-uid"]; ok {
+		t.Errorf("fencing job of node2 is created over concurrency limit")
+	}
+}
@@ -0,0 +1,64 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// defaultEscalationTimeout is the default time given to the soft fenced node to recover before the backend fences it
+const defaultEscalationTimeout = 5 * time.Minute
+
+// softFirst returns true if the node must be soft fenced before running the backend
+func softFirst(node *v1.Node, podTemplate *v1.PodTemplate) bool {
+	v, _ := getAnnotation(node, podTemplate, "fencing/escalation")
+	return v == "true" && node.Annotations["fencing/escalated"] != "true"
+}
+
+// escalationTimeout returns fencing/escalation-timeout of the node
+func escalationTimeout(node *v1.Node, podTemplate *v1.PodTemplate) time.Duration {
+	v, ok := getAnnotation(node, podTemplate, "fencing/escalation-timeout")
+	if !ok {
+		return defaultEscalationTimeout
+	}
+	timeout, err := util.ParseDuration(v)
+	if err != nil {
+		klog.Errorln("Failed to parse escalation-timeout string", v, ":", err)
+		return defaultEscalationTimeout
+	}
+	return timeout
+}
+
+// escalationRemains returns the time remaining until the soft fenced node is fenced by the backend,
+// ok is false if no escalation is scheduled
+func escalationRemains(node *v1.Node) (remain time.Duration, ok bool) {
+	v, ok := node.Annotations["fencing/escalation-deadline"]
+	if !ok {
+		return 0, false
+	}
+	deadline, _ := strconv.ParseInt(v, 10, 64)
+	return time.Until(time.Unix(deadline, 0)), true
+}
+
+// escalate restarts the fencing of the soft fenced node, this time using the configured backend
+func (r *ReconcileNode) escalate(node *v1.Node) error {
+	klog.Infoln("Node", node.Name, "did not recover after soft fencing, escalating")
+	err := util.PatchNodeAnnotations(context.TODO(), r.client, node, map[string]interface{}{
+		"fencing/state":               "started",
+		"fencing/escalated":           "true",
+		"fencing/escalation-deadline": nil,
+		"fencing/started-at":          strconv.FormatInt(time.Now().Unix(), 10),
+		"fencing/attempts":            nil,
+		"fencing/last-attempt":        nil,
+	})
+	if err != nil {
+		klog.Errorln("Failed to patch node", node.Name, ":", err)
+		return err
+	}
+	r.recorder.Event(node, v1.EventTypeWarning, "FencingEscalated", "Node did not recover after soft fencing, fencing it with the backend")
+	return nil
+}
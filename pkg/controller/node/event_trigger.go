@@ -0,0 +1,112 @@
+package node
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	// TriggerEventReason is the reason of the Events against Nodes emitted by external monitors,
+	// which mark the node failed, empty disables it
+	TriggerEventReason string
+)
+
+const (
+	// eventNodeIndex is the name of the index on the node name of the trigger Events
+	eventNodeIndex = "node"
+)
+
+// eventTrigger watches the Events with TriggerEventReason against Nodes in all namespaces
+type eventTrigger struct {
+	informer cache.SharedIndexInformer
+}
+
+// newEventTrigger returns the informer of the trigger Events
+func newEventTrigger(clientset kubernetes.Interface) *eventTrigger {
+	selector := fields.Set{
+		"involvedObject.kind": "Node",
+		"reason":              TriggerEventReason,
+	}.AsSelector().String()
+	lw := cache.NewFilteredListWatchFromClient(clientset.CoreV1().RESTClient(), "events", v1.NamespaceAll, func(options *metav1.ListOptions) {
+		options.FieldSelector = selector
+	})
+	informer := cache.NewSharedIndexInformer(lw, &v1.Event{}, 0, cache.Indexers{
+		eventNodeIndex: func(obj interface{}) ([]string, error) {
+			event, ok := obj.(*v1.Event)
+			if !ok {
+				return nil, nil
+			}
+			return []string{event.InvolvedObject.Name}, nil
+		},
+	})
+	return &eventTrigger{informer: informer}
+}
+
+// Start runs the informer until stop is closed
+func (t *eventTrigger) Start(stop <-chan struct{}) error {
+	t.informer.Run(stop)
+	return nil
+}
+
+// eventNode maps the trigger Event to its node
+func eventNode(o handler.MapObject) []reconcile.Request {
+	event, ok := o.Object.(*v1.Event)
+	if !ok {
+		return nil
+	}
+	klog.Infoln("Node", event.InvolvedObject.Name, "is reported failed by event", event.Namespace+"/"+event.Name)
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: event.InvolvedObject.Name}}}
+}
+
+// lastEvent returns the time of the latest trigger Event of the node, zero time if there is no one
+func (t *eventTrigger) lastEvent(nodeName string) time.Time {
+	var last time.Time
+	if t == nil {
+		return last
+	}
+	objs, err := t.informer.GetIndexer().ByIndex(eventNodeIndex, nodeName)
+	if err != nil {
+		klog.Errorln("Failed to get events of node", nodeName, ":", err)
+		return last
+	}
+	for _, obj := range objs {
+		event, ok := obj.(*v1.Event)
+		if !ok {
+			continue
+		}
+		ts := event.LastTimestamp.Time
+		if ts.IsZero() {
+			ts = event.EventTime.Time
+		}
+		if ts.After(last) {
+			last = ts
+		}
+	}
+	return last
+}
+
+// statusSince returns the time the Ready condition of the node or fencing/recovered-at changed last time,
+// the trigger Events older than that are reported before the node recovered
+func statusSince(node *v1.Node) time.Time {
+	var since time.Time
+	if _, c := util.GetNodeCondition(&node.Status, v1.NodeReady); c != nil {
+		since = c.LastTransitionTime.Time
+	}
+	if recoveredAt, _ := strconv.ParseInt(node.Annotations["fencing/recovered-at"], 10, 64); recoveredAt > 0 {
+		if t := time.Unix(recoveredAt, 0); t.After(since) {
+			since = t
+		}
+	}
+	return since
+}
@@ -0,0 +1,66 @@
+package node
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newTestEventTrigger returns the eventTrigger with the Event reported the given time ago
+func newTestEventTrigger(t *testing.T, ago time.Duration) *eventTrigger {
+	informer := cache.NewSharedIndexInformer(nil, &v1.Event{}, 0, cache.Indexers{
+		eventNodeIndex: func(obj interface{}) ([]string, error) {
+			return []string{obj.(*v1.Event).InvolvedObject.Name}, nil
+		},
+	})
+	if ago > 0 {
+		event := &v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "node1.failed", Namespace: "monitoring"},
+			InvolvedObject: v1.ObjectReference{Kind: "Node", Name: "node1"},
+			LastTimestamp:  metav1.NewTime(time.Now().Add(-ago)),
+		}
+		if err := informer.GetIndexer().Add(event); err != nil {
+			t.Fatalf("add event failed: %v", err)
+		}
+	}
+	return &eventTrigger{informer: informer}
+}
+
+func TestEventTrigger(t *testing.T) {
+	recoveredAt := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	tests := []struct {
+		name        string
+		ready       v1.ConditionStatus
+		annotations map[string]string
+		event       time.Duration
+		state       string
+	}{
+		{name: "no event", ready: v1.ConditionTrue},
+		{name: "event after node became ready", ready: v1.ConditionTrue, event: time.Minute, state: "started"},
+		{name: "event before node became ready", ready: v1.ConditionTrue, event: 2 * time.Hour},
+		{name: "event after node became not ready", ready: v1.ConditionFalse, event: time.Minute, state: "started"},
+		{name: "event before node became not ready", ready: v1.ConditionFalse, event: 2 * time.Hour},
+		{name: "event before node recovered", ready: v1.ConditionFalse, annotations: map[string]string{"fencing/recovered-at": recoveredAt}, event: 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			annotations := map[string]string{"fencing/enabled": "true"}
+			for k, v := range tt.annotations {
+				annotations[k] = v
+			}
+			r := newTestReconciler(newTestNode("node1", tt.ready, annotations), newTestTemplate("fencing", nil))
+			r.events = newTestEventTrigger(t, tt.event)
+			node, _, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+		})
+	}
+}
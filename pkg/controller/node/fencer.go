@@ -0,0 +1,74 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// FenceResult is the result of a fencing backend call
+type FenceResult struct {
+	// Fenced is true when the node is fenced and can be cleaned up
+	Fenced bool
+	// RequeueAfter specifies when the backend should be called again to check the progress, zero means never
+	RequeueAfter time.Duration
+	// Started is true when the call started a new fencing attempt, even if it failed.
+	// Attempts are counted in fencing/attempts annotation for the backoff.
+	Started bool
+}
+
+// Fencer is a backend executing the fencing procedure for the node
+type Fencer interface {
+	// Fence starts or continues fencing the node
+	Fence(ctx context.Context, node *v1.Node) (FenceResult, error)
+	// Cancel aborts the fencing in progress when the node recovered before it is fenced, if it is possible
+	Cancel(ctx context.Context, node *v1.Node) error
+}
+
+// Tracker is implemented by the backends fencing the node asynchronously
+type Tracker interface {
+	// InProgress returns true while the fencing attempt started by the backend is not finished,
+	// the node occupies a fencing slot meanwhile and the limits are checked only before a new attempt
+	InProgress(ctx context.Context, node *v1.Node) (bool, error)
+}
+
+// fencers is the registry of the external fencing backends
+var fencers = map[string]Fencer{}
+
+// RegisterFencer adds the fencing backend selectable by fencing/backend annotation
+func RegisterFencer(name string, f Fencer) {
+	fencers[name] = f
+}
+
+// getFencer returns the fencing backend by name, job backend is used by default
+func (r *ReconcileNode) getFencer(name string) (Fencer, bool) {
+	if name == "" {
+		name = "job"
+	}
+	if f, ok := r.fencers[name]; ok {
+		return f, true
+	}
+	f, ok := fencers[name]
+	return f, ok
+}
+
+// backends returns the built-in and external fencing backends by name
+func (r *ReconcileNode) backends() map[string]Fencer {
+	all := map[string]Fencer{}
+	for name, f := range fencers {
+		all[name] = f
+	}
+	for name, f := range r.fencers {
+		all[name] = f
+	}
+	return all
+}
+
+// attemptInProgress reports if the backend continues the fencing attempt started before
+func attemptInProgress(ctx context.Context, f Fencer, node *v1.Node) (bool, error) {
+	if t, ok := f.(Tracker); ok {
+		return t.InProgress(ctx, node)
+	}
+	return false, nil
+}
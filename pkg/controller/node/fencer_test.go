@@ -0,0 +1,121 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// fakeFencer records the nodes it is called with
+type fakeFencer struct {
+	nodes     []string
+	cancelled []string
+}
+
+func (f *fakeFencer) Fence(ctx context.Context, node *v1.Node) (FenceResult, error) {
+	f.nodes = append(f.nodes, node.Name)
+	return FenceResult{Started: true}, nil
+}
+
+func (f *fakeFencer) Cancel(ctx context.Context, node *v1.Node) error {
+	f.cancelled = append(f.cancelled, node.Name)
+	return nil
+}
+
+func TestGetFencer(t *testing.T) {
+	fake := &fakeFencer{}
+	RegisterFencer("fake", fake)
+	defer delete(fencers, "fake")
+
+	r := newTestReconciler()
+	tests := []struct {
+		backend string
+		fencer  Fencer
+	}{
+		{backend: "", fencer: r.fencers["job"]},
+		{backend: "job", fencer: r.fencers["job"]},
+		{backend: "redfish", fencer: r.fencers["redfish"]},
+		{backend: "fake", fencer: fake},
+		{backend: "snmp"},
+	}
+	for _, tt := range tests {
+		f, ok := r.getFencer(tt.backend)
+		if ok != (tt.fencer != nil) || f != tt.fencer {
+			t.Errorf("backend %q is %T, want %T", tt.backend, f, tt.fencer)
+		}
+	}
+}
+
+func TestFencerSelection(t *testing.T) {
+	fake := &fakeFencer{}
+	RegisterFencer("fake", fake)
+	defer delete(fencers, "fake")
+
+	tests := []struct {
+		name    string
+		backend string
+		nodes   []string
+		attempt bool
+	}{
+		{name: "registered backend is called with the node", backend: "fake", nodes: []string{"node1"}, attempt: true},
+		{name: "unknown backend is rejected", backend: "snmp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.nodes = nil
+			node := newTestNode("node1", v1.ConditionUnknown, map[string]string{
+				"fencing/enabled": "true",
+				"fencing/state":   "started",
+				"fencing/backend": tt.backend,
+			})
+			r := newTestReconciler(node, newTestTemplate("fencing", nil))
+			node, _, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if len(fake.nodes) != len(tt.nodes) || (len(tt.nodes) > 0 && fake.nodes[0] != tt.nodes[0]) {
+				t.Errorf("backend is called with %v, want %v", fake.nodes, tt.nodes)
+			}
+			if _, ok := node.Annotations["fencing/attempts"]; ok != tt.attempt {
+				t.Errorf("attempt is counted %v, want %v", ok, tt.attempt)
+			}
+		})
+	}
+}
+
+func TestCancelOnRecovery(t *testing.T) {
+	fake := &fakeFencer{}
+	RegisterFencer("fake", fake)
+	defer delete(fencers, "fake")
+
+	tests := []struct {
+		name      string
+		state     string
+		cancelled bool
+	}{
+		{name: "fencing in progress is cancelled", state: "started", cancelled: true},
+		{name: "finished fencing is not cancelled", state: "fenced"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.cancelled = nil
+			node := newTestNode("node1", v1.ConditionTrue, map[string]string{
+				"fencing/enabled": "true",
+				"fencing/state":   tt.state,
+				"fencing/backend": "fake",
+			})
+			r := newTestReconciler(node, newTestTemplate("fencing", nil))
+			node, _, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state, ok := node.Annotations["fencing/state"]; ok {
+				t.Errorf("state %q is not cleared", state)
+			}
+			if cancelled := len(fake.cancelled) == 1 && fake.cancelled[0] == "node1"; cancelled != tt.cancelled {
+				t.Errorf("cancelled nodes are %v, want cancelled %v", fake.cancelled, tt.cancelled)
+			}
+		})
+	}
+}
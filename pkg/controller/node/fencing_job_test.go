@@ -0,0 +1,312 @@
+package node
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// int32Value returns the value of p, nil for nil pointer
+func int32Value(p *int32) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func TestJobParallelism(t *testing.T) {
+	tests := []struct {
+		name        string
+		node        map[string]string
+		template    map[string]string
+		parallelism interface{}
+		completions interface{}
+	}{
+		{name: "single completion by default"},
+		{name: "podTemplate annotations", template: map[string]string{"fencing/parallelism": "2", "fencing/completions": "3"},
+			parallelism: int32(2), completions: int32(3)},
+		{name: "node overrides podTemplate", node: map[string]string{"fencing/parallelism": "4"},
+			template: map[string]string{"fencing/parallelism": "2", "fencing/completions": "3"}, parallelism: int32(4), completions: int32(3)},
+		{name: "invalid values are ignored", template: map[string]string{"fencing/parallelism": "two", "fencing/completions": "99999999999"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", v1.ConditionUnknown, tt.node)
+			job := newJobForNode(node, newTestTemplate("fencing", tt.template))
+			if v := int32Value(job.Spec.Parallelism); v != tt.parallelism {
+				t.Errorf("parallelism is %v, want %v", v, tt.parallelism)
+			}
+			if v := int32Value(job.Spec.Completions); v != tt.completions {
+				t.Errorf("completions is %v, want %v", v, tt.completions)
+			}
+		})
+	}
+}
+
+func TestJobPodLabels(t *testing.T) {
+	podTemplate := newTestTemplate("fencing", nil)
+	podTemplate.Template.Labels = map[string]string{"app": "fence-agents", "node": "overridden"}
+	job := newJobForNode(newTestNode("node1", v1.ConditionUnknown, nil), podTemplate)
+	want := map[string]string{"fencing": "fence", "node": "node1", "app": "fence-agents"}
+	for k, v := range want {
+		if job.Spec.Template.Labels[k] != v {
+			t.Errorf("pod label %s is %q, want %q", k, job.Spec.Template.Labels[k], v)
+		}
+	}
+	if job.Labels["fencing"] != "fence" || job.Labels["node"] != "node1" {
+		t.Errorf("job labels are %v, want the fencing labels", job.Labels)
+	}
+}
+
+func TestJobPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     map[string]string
+		template map[string]string
+		podName  string
+		jobName  string
+	}{
+		{name: "default prefix", jobName: "fence-node1"},
+		{name: "pod name", podName: "ipmi", jobName: "ipmi-node1"},
+		{name: "annotation overrides pod name", podName: "ipmi", template: map[string]string{"fencing/job-prefix": "ipmi-fence"}, jobName: "ipmi-fence-node1"},
+		{name: "node annotation", node: map[string]string{"fencing/job-prefix": "rack1"}, template: map[string]string{"fencing/job-prefix": "ipmi-fence"}, jobName: "rack1-node1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podTemplate := newTestTemplate("fencing", tt.template)
+			podTemplate.Template.Name = tt.podName
+			job, err := BuildFencingJob(newTestNode("node1", v1.ConditionUnknown, tt.node), podTemplate)
+			if err != nil {
+				t.Fatalf("build failed: %v", err)
+			}
+			if job.Name != tt.jobName {
+				t.Errorf("job name is %q, want %q", job.Name, tt.jobName)
+			}
+		})
+	}
+}
+
+func TestJobControllerLabels(t *testing.T) {
+	defer func(labels, annotations map[string]string) { JobLabels, JobAnnotations = labels, annotations }(JobLabels, JobAnnotations)
+	JobLabels = map[string]string{"cost-center": "ops", "node": "other"}
+	JobAnnotations = map[string]string{"owner": "platform", "team": "infra", "fencing/mode": "none"}
+
+	podTemplate := newTestTemplate("fencing", map[string]string{"fencing/mode": "delete"})
+	podTemplate.Template.Annotations = map[string]string{"owner": "fencing"}
+	job := newJobForNode(newTestNode("node1", v1.ConditionUnknown, nil), podTemplate)
+
+	labels := map[string]string{"cost-center": "ops", "node": "node1", "fencing": "fence"}
+	for k, v := range labels {
+		if job.Labels[k] != v {
+			t.Errorf("job label %s is %q, want %q", k, job.Labels[k], v)
+		}
+	}
+	annotations := map[string]string{"owner": "fencing", "team": "infra", "fencing/mode": "delete"}
+	for k, v := range annotations {
+		if job.Annotations[k] != v {
+			t.Errorf("job annotation %s is %q, want %q", k, job.Annotations[k], v)
+		}
+	}
+}
+
+func TestJobAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     map[string]string
+		template map[string]string
+		action   string
+	}{
+		{name: "power off by default", action: "off"},
+		{name: "reboot", template: map[string]string{"fencing/action": "reboot"}, action: "reboot"},
+		{name: "node overrides podTemplate", node: map[string]string{"fencing/action": "off"}, template: map[string]string{"fencing/action": "reboot"}, action: "off"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newJobForNode(newTestNode("node1", v1.ConditionUnknown, tt.node), newTestTemplate("fencing", tt.template))
+			if action := job.Annotations["fencing/action"]; action != tt.action {
+				t.Errorf("job action is %q, want %q", action, tt.action)
+			}
+			for _, c := range job.Spec.Template.Spec.Containers {
+				found := false
+				for _, env := range c.Env {
+					if env.Name == "FENCING_ACTION" {
+						found = true
+						if env.Value != tt.action {
+							t.Errorf("container %s action is %q, want %q", c.Name, env.Value, tt.action)
+						}
+					}
+				}
+				if !found {
+					t.Errorf("container %s has no FENCING_ACTION", c.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestJobServiceAccount(t *testing.T) {
+	tests := []struct {
+		name           string
+		node           map[string]string
+		template       map[string]string
+		podAccount     string
+		serviceAccount string
+	}{
+		{name: "default service account"},
+		{name: "podTemplate service account is kept", podAccount: "fencing", serviceAccount: "fencing"},
+		{name: "annotation overrides podTemplate", podAccount: "fencing", template: map[string]string{"fencing/service-account": "redfish"}, serviceAccount: "redfish"},
+		{name: "not taken from node", node: map[string]string{"fencing/service-account": "cloud"},
+			template: map[string]string{"fencing/service-account": "redfish"}, serviceAccount: "redfish"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podTemplate := newTestTemplate("fencing", tt.template)
+			podTemplate.Template.Spec.ServiceAccountName = tt.podAccount
+			job := newJobForNode(newTestNode("node1", v1.ConditionUnknown, tt.node), podTemplate)
+			if sa := job.Spec.Template.Spec.ServiceAccountName; sa != tt.serviceAccount {
+				t.Errorf("service account is %q, want %q", sa, tt.serviceAccount)
+			}
+		})
+	}
+}
+
+func TestJobStage(t *testing.T) {
+	tests := []struct {
+		name        string
+		template    map[string]string
+		parallelism interface{}
+		staged      string
+	}{
+		{name: "job is not staged by default"},
+		{name: "staged job runs no pods", template: map[string]string{"fencing/stage": "true"}, parallelism: int32(0), staged: "1"},
+		{name: "staged parallelism is kept", template: map[string]string{"fencing/stage": "true", "fencing/parallelism": "3"}, parallelism: int32(0), staged: "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newJobForNode(newTestNode("node1", v1.ConditionUnknown, nil), newTestTemplate("fencing", tt.template))
+			if v := int32Value(job.Spec.Parallelism); v != tt.parallelism {
+				t.Errorf("parallelism is %v, want %v", v, tt.parallelism)
+			}
+			if staged := job.Annotations["fencing/staged-parallelism"]; staged != tt.staged {
+				t.Errorf("staged parallelism is %q, want %q", staged, tt.staged)
+			}
+			if staged := jobStaged(job); staged != (tt.staged != "") {
+				t.Errorf("job is staged %v, want %v", staged, tt.staged != "")
+			}
+		})
+	}
+
+	// Resumed job is active
+	job := newJobForNode(newTestNode("node1", v1.ConditionUnknown, nil), newTestTemplate("fencing", map[string]string{"fencing/stage": "true"}))
+	resumed := int32(1)
+	job.Spec.Parallelism = &resumed
+	if jobStaged(job) {
+		t.Errorf("resumed job is staged")
+	}
+}
+
+func TestStagedJobIsNotRunning(t *testing.T) {
+	node := newTestNode("node1", v1.ConditionTrue, map[string]string{
+		"fencing/enabled": "true",
+		"fencing/state":   "started",
+	})
+	job := newJobForNode(node, newTestTemplate("fencing", map[string]string{"fencing/stage": "true"}))
+	r := newTestReconciler(node, job, newTestTemplate("fencing", nil))
+
+	// Staged job of the recovered node is removed instead of waiting for it
+	node, _, err := reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if state, ok := node.Annotations["fencing/state"]; ok {
+		t.Errorf("state %q is not cleared", state)
+	}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: job.Namespace, Name: job.Name}, &batchv1.Job{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("staged job is not deleted: %v", err)
+	}
+}
+
+func TestJobHostNetworkPrivileged(t *testing.T) {
+	tests := []struct {
+		name        string
+		node        map[string]string
+		template    map[string]string
+		hostNetwork bool
+		privileged  bool
+	}{
+		{name: "not requested"},
+		{name: "explicitly disabled", template: map[string]string{"fencing/host-network": "false", "fencing/privileged": "false"}},
+		{name: "host network", template: map[string]string{"fencing/host-network": "true"}, hostNetwork: true},
+		{name: "privileged", template: map[string]string{"fencing/privileged": "true"}, privileged: true},
+		{name: "not taken from node", node: map[string]string{"fencing/host-network": "true", "fencing/privileged": "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newJobForNode(newTestNode("node1", v1.ConditionUnknown, tt.node), newTestTemplate("fencing", tt.template))
+			spec := job.Spec.Template.Spec
+			if spec.HostNetwork != tt.hostNetwork {
+				t.Errorf("host network is %v, want %v", spec.HostNetwork, tt.hostNetwork)
+			}
+			if tt.hostNetwork && spec.DNSPolicy != v1.DNSClusterFirstWithHostNet {
+				t.Errorf("DNS policy is %q, want %q", spec.DNSPolicy, v1.DNSClusterFirstWithHostNet)
+			}
+			for _, c := range spec.Containers {
+				privileged := c.SecurityContext != nil && c.SecurityContext.Privileged != nil && *c.SecurityContext.Privileged
+				if privileged != tt.privileged {
+					t.Errorf("container %s is privileged %v, want %v", c.Name, privileged, tt.privileged)
+				}
+			}
+		})
+	}
+}
+
+func TestJobCleanupTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		template map[string]string
+		ttl      interface{}
+	}{
+		{name: "no TTL by default"},
+		{name: "no TTL with keep policy", template: map[string]string{"fencing/cleanup-policy": "keep"}},
+		{name: "default TTL", template: map[string]string{"fencing/cleanup-policy": "ttl"}, ttl: int32(3600)},
+		{name: "cleanup-ttl annotation", template: map[string]string{"fencing/cleanup-policy": "ttl", "fencing/cleanup-ttl": "10m"}, ttl: int32(600)},
+		{name: "invalid cleanup-ttl is ignored", template: map[string]string{"fencing/cleanup-policy": "ttl", "fencing/cleanup-ttl": "soon"}, ttl: int32(3600)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newJobForNode(newTestNode("node1", v1.ConditionUnknown, nil), newTestTemplate("fencing", tt.template))
+			if v := int32Value(job.Spec.TTLSecondsAfterFinished); v != tt.ttl {
+				t.Errorf("ttlSecondsAfterFinished is %v, want %v", v, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestJobImagePullSecrets(t *testing.T) {
+	defer func(v []string) { ImagePullSecrets = v }(ImagePullSecrets)
+	ImagePullSecrets = []string{"registry"}
+
+	podTemplate := newTestTemplate("fencing", map[string]string{"fencing/pull-secret": "agents,template"})
+	podTemplate.Template.Spec.ImagePullSecrets = []v1.LocalObjectReference{{Name: "template"}}
+	// The node can not attach other secrets
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/pull-secret": "other"})
+	job := newJobForNode(node, podTemplate)
+
+	var names []string
+	for _, s := range job.Spec.Template.Spec.ImagePullSecrets {
+		names = append(names, s.Name)
+	}
+	if want := []string{"template", "registry", "agents"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("image pull secrets are %v, want %v", names, want)
+	}
+	// PodTemplate is shared by all the nodes using it
+	if len(podTemplate.Template.Spec.ImagePullSecrets) != 1 {
+		t.Errorf("podTemplate image pull secrets are changed to %v", podTemplate.Template.Spec.ImagePullSecrets)
+	}
+}
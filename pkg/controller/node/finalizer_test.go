@@ -0,0 +1,93 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// failingDeleteClient fails to delete any objects
+type failingDeleteClient struct {
+	client.Client
+}
+
+func (c failingDeleteClient) DeleteAllOf(ctx context.Context, obj runtime.Object, opts ...client.DeleteAllOfOption) error {
+	return errors.New("delete is not allowed")
+}
+
+func TestFinalizer(t *testing.T) {
+	defer func(v bool) { EnableFinalizer = v }(EnableFinalizer)
+	EnableFinalizer = true
+
+	now := metav1.Now()
+	tests := []struct {
+		name       string
+		node       *v1.Node
+		failDelete bool
+		// finalizer is true if the finalizer is expected on the node after reconcile
+		finalizer  bool
+		podDeleted bool
+		fail       bool
+	}{
+		{
+			name:      "finalizer is added to fencing enabled node",
+			node:      newTestNode("node1", v1.ConditionTrue, map[string]string{"fencing/enabled": "true"}),
+			finalizer: true,
+		},
+		{
+			name: "finalizer is not added to observed node",
+			node: newTestNode("node1", v1.ConditionTrue, map[string]string{"fencing/enabled": "true", "fencing/observe": "true"}),
+		},
+		{
+			name: "finalizer is not added to node without fencing",
+			node: newTestNode("node1", v1.ConditionTrue, nil),
+		},
+		{
+			name:       "deleted node is flushed and released",
+			node:       newTestNode("node1", v1.ConditionTrue, map[string]string{"fencing/enabled": "true"}),
+			podDeleted: true,
+		},
+		{
+			name:       "deleted node is blocked until cleanup succeeds",
+			node:       newTestNode("node1", v1.ConditionTrue, map[string]string{"fencing/enabled": "true"}),
+			failDelete: true,
+			finalizer:  true,
+			fail:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.podDeleted || tt.failDelete {
+				tt.node.DeletionTimestamp = &now
+				tt.node.Finalizers = []string{finalizerName}
+			}
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default"},
+				Spec:       v1.PodSpec{NodeName: "node1"},
+			}
+			ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+			r := newTestReconciler(tt.node, pod, ns, newTestTemplate("fencing", nil))
+			if tt.failDelete {
+				r.client = failingDeleteClient{r.client}
+			}
+			node, _, err := reconcileNode(r, "node1")
+			if (err != nil) != tt.fail {
+				t.Fatalf("reconcile error is %v, want error %v", err, tt.fail)
+			}
+			if hasFinalizer(node) != tt.finalizer {
+				t.Errorf("finalizers are %v, want finalizer %v", node.Finalizers, tt.finalizer)
+			}
+			err = r.client.Get(context.TODO(), types.NamespacedName{Name: "pod1", Namespace: "default"}, &v1.Pod{})
+			if deleted := apierrors.IsNotFound(err); deleted != tt.podDeleted {
+				t.Errorf("pod is deleted %v, want %v", deleted, tt.podDeleted)
+			}
+		})
+	}
+}
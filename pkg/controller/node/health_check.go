@@ -0,0 +1,44 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// healthCheckClient is used to call external health checkers
+var healthCheckClient = &http.Client{Timeout: 10 * time.Second}
+
+// healthCheckResponse is the response of external health checker
+type healthCheckResponse struct {
+	Dead bool `json:"dead"`
+}
+
+// checkNodeDead calls the external health checker at rawURL and returns true if it reports the node dead.
+// {node} in the URL is replaced with the node name, the checker must respond with {"dead": true|false}.
+func checkNodeDead(ctx context.Context, node *v1.Node, rawURL string) (bool, error) {
+	u := strings.Replace(rawURL, "{node}", url.PathEscape(node.Name), -1)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := healthCheckClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("health checker responded with status %s", resp.Status)
+	}
+	result := healthCheckResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode health checker response: %v", err)
+	}
+	return result.Dead, nil
+}
@@ -0,0 +1,62 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestHealthCheck(t *testing.T) {
+	checker := func(dead bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/nodes/node1" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(healthCheckResponse{Dead: dead})
+		}))
+	}
+	dead, alive := checker(true), checker(false)
+	defer dead.Close()
+	defer alive.Close()
+
+	tests := []struct {
+		name     string
+		template string
+		node     string
+		state    string
+		requeue  bool
+	}{
+		{name: "dead node is fenced", template: dead.URL, state: "started"},
+		{name: "alive node is deferred", template: alive.URL, state: "", requeue: true},
+		{name: "failed check defers fencing", template: dead.URL + "/unknown", state: "", requeue: true},
+		{name: "checker is not taken from node", template: dead.URL, node: alive.URL, state: "started"},
+		{name: "node can not add checker", node: alive.URL, state: "started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := map[string]string{}
+			if tt.template != "" {
+				template["fencing/health-check-url"] = tt.template + "/nodes/{node}"
+			}
+			annotations := map[string]string{"fencing/enabled": "true"}
+			if tt.node != "" {
+				annotations["fencing/health-check-url"] = tt.node + "/nodes/{node}"
+			}
+			r := newTestReconciler(newTestNode("node1", v1.ConditionUnknown, annotations), newTestTemplate("fencing", template))
+			node, result, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			if requeue := result.RequeueAfter > 0; requeue != tt.requeue {
+				t.Errorf("requeue after %v, want requeue %v", result.RequeueAfter, tt.requeue)
+			}
+		})
+	}
+}
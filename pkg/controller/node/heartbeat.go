@@ -0,0 +1,34 @@
+package node
+
+import (
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// defaultHeartbeatThreshold is the default age of the node condition heartbeat considered as stale,
+// kubelet posts unchanged node status every 5 minutes when node Leases are used
+const defaultHeartbeatThreshold = 6 * time.Minute
+
+// heartbeatStale returns true if the condition heartbeat was not posted for fencing/heartbeat-threshold,
+// otherwise the time remaining until it becomes stale. Condition without heartbeat is not considered as stale.
+func heartbeatStale(node *v1.Node, c *v1.NodeCondition) (bool, time.Duration) {
+	threshold := defaultHeartbeatThreshold
+	if v, ok := node.Annotations["fencing/heartbeat-threshold"]; ok {
+		var err error
+		if threshold, err = util.ParseDuration(v); err != nil {
+			klog.Errorln("Failed to parse heartbeat-threshold string", v, ":", err)
+			threshold = defaultHeartbeatThreshold
+		}
+	}
+	if c.LastHeartbeatTime.IsZero() {
+		return false, 0
+	}
+	remain := time.Until(c.LastHeartbeatTime.Add(threshold))
+	if remain <= 0 {
+		return true, 0
+	}
+	return false, remain
+}
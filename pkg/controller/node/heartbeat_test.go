@@ -0,0 +1,46 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHeartbeatTrigger(t *testing.T) {
+	tests := []struct {
+		name      string
+		heartbeat time.Duration
+		state     string
+		requeue   bool
+	}{
+		{name: "stale heartbeat", heartbeat: 10 * time.Minute, state: "started"},
+		{name: "recent heartbeat", heartbeat: time.Minute, requeue: true},
+		{name: "no heartbeat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Node condition is not updated yet
+			node := newTestNode("node1", v1.ConditionTrue, map[string]string{
+				"fencing/enabled": "true",
+				"fencing/trigger": "heartbeat",
+			})
+			if tt.heartbeat > 0 {
+				node.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(time.Now().Add(-tt.heartbeat))
+			}
+			r := newTestReconciler(node, newTestTemplate("fencing", nil))
+			node, result, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			// Recent heartbeat is checked again when it becomes stale
+			if requeue := result.RequeueAfter > 0 && result.RequeueAfter <= defaultHeartbeatThreshold; requeue != tt.requeue {
+				t.Errorf("requeue after %v, want requeue %v", result.RequeueAfter, tt.requeue)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// HistoryRetention is the period after which archived fencing jobs are deleted, 0 keeps them forever
+	HistoryRetention time.Duration
+)
+
+// historyCleaner periodically deletes archived fencing jobs older than HistoryRetention
+type historyCleaner struct {
+	client client.Client
+}
+
+// Start runs the cleanup until stop is closed
+func (h *historyCleaner) Start(stop <-chan struct{}) error {
+	period := HistoryRetention / 2
+	if period > time.Hour {
+		period = time.Hour
+	}
+	wait.Until(h.cleanup, period, stop)
+	return nil
+}
+
+// cleanup deletes expired archived jobs, jobs of in-progress fencing are never archived
+func (h *historyCleaner) cleanup() {
+	for _, label := range []string{"retained", "recovered"} {
+		jobs := &batchv1.JobList{}
+		err := h.client.List(context.TODO(), jobs,
+			client.InNamespace(jobNamespace()),
+			client.MatchingLabels{"fencing": label},
+		)
+		if err != nil {
+			klog.Errorln("Failed to list", label, "jobs:", err)
+			continue
+		}
+		for i := range jobs.Items {
+			job := &jobs.Items[i]
+			archivedAt := job.CreationTimestamp.Time
+			if v, err := strconv.ParseInt(job.Annotations["fencing/"+label+"-at"], 10, 64); err == nil {
+				archivedAt = time.Unix(v, 0)
+			}
+			if time.Since(archivedAt) < HistoryRetention {
+				continue
+			}
+			klog.Infoln("Deleting expired", label, "job", job.Name)
+			err := h.client.Delete(context.TODO(), job,
+				client.PropagationPolicy(metav1.DeletePropagationBackground),
+			)
+			if err != nil {
+				klog.Errorln("Failed to delete job", job.Name, ":", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestHistoryCleanup(t *testing.T) {
+	defer func(v time.Duration) { HistoryRetention = v }(HistoryRetention)
+	HistoryRetention = 24 * time.Hour
+
+	// archivedJob returns the job archived with the label ago
+	archivedJob := func(name, label string, ago time.Duration) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         Namespace,
+				Labels:            map[string]string{"fencing": label, "node": "node1"},
+				Annotations:       map[string]string{"fencing/" + label + "-at": strconv.FormatInt(time.Now().Add(-ago).Unix(), 10)},
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-ago - time.Hour)),
+			},
+		}
+	}
+	active := archivedJob("active", "fence", 48*time.Hour)
+	active.Annotations = nil
+
+	r := newTestReconciler(
+		archivedJob("old-retained", "retained", 48*time.Hour),
+		archivedJob("old-recovered", "recovered", 25*time.Hour),
+		archivedJob("recent-retained", "retained", time.Hour),
+		archivedJob("recent-recovered", "recovered", 23*time.Hour),
+		active,
+	)
+	h := &historyCleaner{client: r.client}
+	h.cleanup()
+
+	for _, name := range []string{"old-retained", "old-recovered"} {
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: Namespace, Name: name}, &batchv1.Job{})
+		if !errors.IsNotFound(err) {
+			t.Errorf("expired job %s is not deleted: %v", name, err)
+		}
+	}
+	for _, name := range []string{"recent-retained", "recent-recovered", "active"} {
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: Namespace, Name: name}, &batchv1.Job{}); err != nil {
+			t.Errorf("job %s is not kept: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package node
+
+import (
+	"context"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// IncidentConfigMap is the name of ConfigMap in Namespace holding the incident ID in id key,
+	// so it is shared by all replicas and survives leader changes
+	IncidentConfigMap = "kube-fencing-incident"
+	// DefaultIncidentID is the incident ID used while IncidentConfigMap does not exist
+	DefaultIncidentID string
+)
+
+// IncidentID returns the incident ID stamped on the fencing jobs, or empty string if it is not set
+func IncidentID(ctx context.Context, c client.Client) (string, error) {
+	cm := &v1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: Namespace, Name: IncidentConfigMap}, cm)
+	if errors.IsNotFound(err) {
+		return DefaultIncidentID, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return cm.Data["id"], nil
+}
+
+// SetIncidentID stores the incident ID stamped on the fencing jobs, empty string clears it
+func SetIncidentID(ctx context.Context, c client.Client, id string) error {
+	cm := &v1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: Namespace, Name: IncidentConfigMap}, cm)
+	if errors.IsNotFound(err) {
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: IncidentConfigMap, Namespace: Namespace},
+			Data:       map[string]string{"id": id},
+		}
+		return c.Create(ctx, cm)
+	}
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data["id"] = id
+	return c.Update(ctx, cm)
+}
+
+// stampIncident tags the job and its pod with the incident ID for correlation,
+// the label is set only if the ID is a valid label value
+func stampIncident(job *batchv1.Job, id string) {
+	if id == "" {
+		return
+	}
+	for _, meta := range []*metav1.ObjectMeta{&job.ObjectMeta, &job.Spec.Template.ObjectMeta} {
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		meta.Annotations["fencing/incident-id"] = id
+		if len(validation.IsValidLabelValue(id)) == 0 {
+			if meta.Labels == nil {
+				meta.Labels = map[string]string{}
+			}
+			meta.Labels["fencing/incident-id"] = id
+		}
+	}
+}
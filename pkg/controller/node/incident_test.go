@@ -0,0 +1,93 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestIncidentID(t *testing.T) {
+	defer func(id string) {
+		DefaultIncidentID = id
+	}(DefaultIncidentID)
+	DefaultIncidentID = "INC-0"
+
+	tests := []struct {
+		name string
+		// set is the ID set at runtime, nil leaves the default
+		set        *string
+		annotation string
+		label      string
+	}{
+		{name: "default ID from flag", annotation: "INC-0", label: "INC-0"},
+		{name: "ID set at runtime", set: stringPtr("INC-1"), annotation: "INC-1", label: "INC-1"},
+		{name: "cleared ID overrides the default", set: stringPtr("")},
+		{name: "invalid label value is only annotated", set: stringPtr("INC 2: outage"), annotation: "INC 2: outage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestReconciler(
+				newTestNode("node1", v1.ConditionUnknown, map[string]string{
+					"fencing/enabled": "true",
+					"fencing/state":   "started",
+				}),
+				newTestTemplate("fencing", nil),
+			)
+			if tt.set != nil {
+				if err := SetIncidentID(context.TODO(), r.client, *tt.set); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, _, err := reconcileNode(r, "node1"); err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+
+			jobs := &batchv1.JobList{}
+			if err := r.client.List(context.TODO(), jobs, client.MatchingLabels{"node": "node1"}); err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs.Items) != 1 {
+				t.Fatalf("%d jobs are created, want 1", len(jobs.Items))
+			}
+			job := jobs.Items[0]
+			for _, meta := range []struct {
+				kind        string
+				annotations map[string]string
+				labels      map[string]string
+			}{
+				{"job", job.Annotations, job.Labels},
+				{"pod", job.Spec.Template.Annotations, job.Spec.Template.Labels},
+			} {
+				if v := meta.annotations["fencing/incident-id"]; v != tt.annotation {
+					t.Errorf("%s annotation is %q, want %q", meta.kind, v, tt.annotation)
+				}
+				if v := meta.labels["fencing/incident-id"]; v != tt.label {
+					t.Errorf("%s label is %q, want %q", meta.kind, v, tt.label)
+				}
+			}
+		})
+	}
+}
+
+func TestSetIncidentID(t *testing.T) {
+	r := newTestReconciler()
+	for _, id := range []string{"INC-1", "INC-2", ""} {
+		if err := SetIncidentID(context.TODO(), r.client, id); err != nil {
+			t.Fatalf("set %q failed: %v", id, err)
+		}
+		got, err := IncidentID(context.TODO(), r.client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != id {
+			t.Errorf("incident ID is %q, want %q", got, id)
+		}
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,48 @@
+package node
+
+import (
+	"sync"
+)
+
+// inflight tracks the nodes being reconciled to prevent overlapping fencing of the same node
+type inflight struct {
+	mu    sync.Mutex
+	nodes map[string]struct{}
+}
+
+// newInflight returns a new inflight registry
+func newInflight() *inflight {
+	return &inflight{nodes: map[string]struct{}{}}
+}
+
+// acquire marks the node as in progress, returns false if it is already in progress
+func (i *inflight) acquire(name string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.nodes[name]; ok {
+		return false
+	}
+	i.nodes[name] = struct{}{}
+	return true
+}
+
+// release removes the node from the registry
+func (i *inflight) release(name string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.nodes, name)
+}
+
+// snapshot returns the set of nodes in progress
+func (i *inflight) snapshot() map[string]bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	nodes := make(map[string]bool, len(i.nodes))
+	for k := range i.nodes {
+		nodes[k] = true
+	}
+	return nodes
+}
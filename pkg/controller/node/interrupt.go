@@ -0,0 +1,75 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// marker is the registered interruptMarker, nil if the controller is not added
+var marker *interruptMarker
+
+// interruptMarker annotates the nodes with in-flight fencing by fencing/interrupted=true on controller shutdown
+type interruptMarker struct {
+	client  client.Client
+	started chan struct{}
+	done    chan struct{}
+}
+
+// newInterruptMarker returns a new interruptMarker
+func newInterruptMarker(c client.Client) *interruptMarker {
+	return &interruptMarker{
+		client:  c,
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start waits for the shutdown and marks in-flight fencings as interrupted
+func (m *interruptMarker) Start(stop <-chan struct{}) error {
+	close(m.started)
+	defer close(m.done)
+	<-stop
+
+	nodes := &v1.NodeList{}
+	if err := m.client.List(context.TODO(), nodes); err != nil {
+		klog.Errorln("Failed to list nodes:", err)
+		return nil
+	}
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if node.Annotations["fencing/state"] != "started" {
+			continue
+		}
+		klog.Infoln("Marking fencing of node", node.Name, "as interrupted")
+		err := util.PatchNodeAnnotations(context.TODO(), m.client, node, map[string]interface{}{
+			"fencing/interrupted": "true",
+		})
+		if err != nil {
+			klog.Errorln("Failed to patch node", node.Name, ":", err)
+		}
+	}
+	return nil
+}
+
+// WaitShutdown waits until in-flight fencings are marked as interrupted, but not longer than timeout
+func WaitShutdown(timeout time.Duration) {
+	if marker == nil {
+		return
+	}
+	select {
+	case <-marker.started:
+	default:
+		// Not a leader, nothing to mark
+		return
+	}
+	select {
+	case <-marker.done:
+	case <-time.After(timeout):
+		klog.Errorln("Timed out marking in-flight fencings as interrupted")
+	}
+}
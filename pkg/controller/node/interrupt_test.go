@@ -0,0 +1,65 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestInterruptMarker(t *testing.T) {
+	r := newTestReconciler(
+		newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true", "fencing/state": "started"}),
+		newTestNode("node2", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true", "fencing/state": "pending"}),
+		newTestNode("node3", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true", "fencing/state": "fenced"}),
+		newTestTemplate("fencing", nil),
+	)
+	defer func(m *interruptMarker) { marker = m }(marker)
+	marker = newInterruptMarker(r.client)
+
+	stop := make(chan struct{})
+	go marker.Start(stop)
+	<-marker.started
+	close(stop)
+	WaitShutdown(time.Second)
+
+	for name, interrupted := range map[string]bool{"node1": true, "node2": false, "node3": false} {
+		node := &v1.Node{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: name}, node); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := node.Annotations["fencing/interrupted"]; ok != interrupted {
+			t.Errorf("node %s is marked interrupted %v, want %v", name, ok, interrupted)
+		}
+	}
+
+	// Interrupted fencing is resumed after restart
+	node, _, err := reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if _, ok := node.Annotations["fencing/interrupted"]; ok {
+		t.Errorf("interrupted annotation is not cleared")
+	}
+	if state := node.Annotations["fencing/state"]; state != "started" {
+		t.Errorf("state is %q, want started", state)
+	}
+}
+
+func TestWaitShutdownNotLeader(t *testing.T) {
+	defer func(m *interruptMarker) { marker = m }(marker)
+	marker = newInterruptMarker(newTestReconciler().client)
+
+	done := make(chan struct{})
+	go func() {
+		WaitShutdown(time.Minute)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("shutdown waits for the marker which is not started")
+	}
+}
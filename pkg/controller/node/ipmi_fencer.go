@@ -0,0 +1,82 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kvaps/kube-fencing/pkg/ipmi"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// ipmiFencer powers off the node via ipmitool
+type ipmiFencer struct {
+	r   *ReconcileNode
+	run ipmi.Runner
+}
+
+// Fence powers off (or power cycles) the node and confirms its power status
+func (f *ipmiFencer) Fence(ctx context.Context, node *v1.Node) (FenceResult, error) {
+	podTemplate, err := f.r.getPodTemplate(node)
+	if err != nil {
+		return FenceResult{}, err
+	}
+	annotation := func(key, def string) string {
+		if v, ok := podTemplate.Annotations[key]; ok {
+			return v
+		}
+		return def
+	}
+
+	// The address, the secret, the interface and the command are never taken from the node, so it can not
+	// obtain the BMC credentials, nor escape the power off
+	address := resolveTemplateAddress(node, podTemplate, "fencing/ipmi-address")
+	if address == "" {
+		return FenceResult{}, fmt.Errorf("fencing/ipmi-address is not specified and can not be resolved")
+	}
+	username, password, err := f.r.getCredentials(ctx, podTemplate.Namespace, podTemplate.Annotations["fencing/ipmi-secret"])
+	if err != nil {
+		return FenceResult{}, err
+	}
+	c := &ipmi.Client{
+		Address:   address,
+		Interface: annotation("fencing/ipmi-interface", "lanplus"),
+		Username:  username,
+		Password:  password,
+		Run:       f.run,
+	}
+
+	defaultCommand := "off"
+	if fencingAction(node, podTemplate) == "reboot" {
+		defaultCommand = "cycle"
+	}
+	command := annotation("fencing/ipmi-command", defaultCommand)
+	switch command {
+	case "off", "cycle", "reset":
+	default:
+		return FenceResult{}, fmt.Errorf("unsupported fencing/ipmi-command %q", command)
+	}
+
+	klog.Infoln("Fencing node", node.Name, "via IPMI", address, ":", command)
+	if _, err := c.Power(ctx, command); err != nil {
+		return FenceResult{Started: true}, err
+	}
+
+	// Confirm power status
+	if command != "off" {
+		return FenceResult{Fenced: true, Started: true}, nil
+	}
+	off, err := c.IsOff(ctx)
+	if err != nil {
+		return FenceResult{Started: true}, err
+	}
+	if !off {
+		return FenceResult{Started: true}, fmt.Errorf("node %s is still powered on", node.Name)
+	}
+	return FenceResult{Fenced: true, Started: true}, nil
+}
+
+// Cancel does nothing, the power command is issued synchronously
+func (f *ipmiFencer) Cancel(ctx context.Context, node *v1.Node) error {
+	return nil
+}
@@ -0,0 +1,123 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeIPMI records ipmitool commands and answers them with the chassis power status
+type fakeIPMI struct {
+	status   string
+	fail     bool
+	commands [][]string
+	env      []string
+}
+
+func (f *fakeIPMI) run(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+	f.commands = append(f.commands, append([]string{name}, args...))
+	f.env = env
+	command := args[len(args)-1]
+	if f.fail && command != "status" {
+		return []byte("Error: Unable to establish IPMI v2 / RMCP+ session"), fmt.Errorf("exit status 1")
+	}
+	if command == "status" {
+		return []byte("Chassis Power is " + f.status + "\n"), nil
+	}
+	return []byte("Chassis Power Control: " + command), nil
+}
+
+func TestIPMIFence(t *testing.T) {
+	tests := []struct {
+		name        string
+		template    map[string]string
+		annotations map[string]string
+		status      string
+		fail        bool
+		result      FenceResult
+		err         bool
+		commands    []string
+	}{
+		{name: "address is not specified", template: map[string]string{"fencing/ipmi-address": ""}, err: true},
+		{name: "address is not taken from node", template: map[string]string{"fencing/ipmi-address": ""}, annotations: map[string]string{"fencing/ipmi-address": "10.0.0.2"}, err: true},
+		{name: "secret is not taken from node", annotations: map[string]string{"fencing/ipmi-secret": "other"}, status: "off", result: FenceResult{Fenced: true, Started: true}, commands: []string{"off", "status"}},
+		{name: "unsupported command", template: map[string]string{"fencing/ipmi-command": "on"}, err: true},
+		{name: "interface and command are not taken from node", annotations: map[string]string{"fencing/ipmi-interface": "lan", "fencing/ipmi-command": "cycle"}, status: "off", result: FenceResult{Fenced: true, Started: true}, commands: []string{"off", "status"}},
+		{name: "power off is confirmed", status: "off", result: FenceResult{Fenced: true, Started: true}, commands: []string{"off", "status"}},
+		{name: "node is still powered on", status: "on", result: FenceResult{Started: true}, err: true, commands: []string{"off", "status"}},
+		{name: "reboot is not confirmed", annotations: map[string]string{"fencing/action": "reboot"}, result: FenceResult{Fenced: true, Started: true}, commands: []string{"cycle"}},
+		{name: "failed command counts the attempt", fail: true, result: FenceResult{Started: true}, err: true, commands: []string{"off"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := map[string]string{
+				"fencing/ipmi-address": "10.0.0.1",
+				"fencing/ipmi-secret":  "bmc",
+			}
+			for k, v := range tt.template {
+				template[k] = v
+			}
+			annotations := map[string]string{"fencing/backend": "ipmi"}
+			for k, v := range tt.annotations {
+				annotations[k] = v
+			}
+			node := newTestNode("node1", v1.ConditionUnknown, annotations)
+			secret := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "bmc", Namespace: Namespace},
+				Data:       map[string][]byte{"username": []byte("admin"), "password": []byte("secret")},
+			}
+			other := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: Namespace},
+				Data:       map[string][]byte{"username": []byte("other"), "password": []byte("other")},
+			}
+			r := newTestReconciler(node, secret, other, newTestTemplate("fencing", template))
+			bmc := &fakeIPMI{status: tt.status, fail: tt.fail}
+			f := &ipmiFencer{r: r, run: bmc.run}
+
+			result, err := f.Fence(context.TODO(), node)
+			if (err != nil) != tt.err {
+				t.Errorf("fence error is %v, want error %v", err, tt.err)
+			}
+			if result != tt.result {
+				t.Errorf("result is %+v, want %+v", result, tt.result)
+			}
+			var commands []string
+			for _, c := range bmc.commands {
+				commands = append(commands, c[len(c)-1])
+			}
+			if !reflect.DeepEqual(commands, tt.commands) {
+				t.Errorf("commands are %v, want %v", commands, tt.commands)
+			}
+			if len(bmc.commands) == 0 {
+				return
+			}
+			// Password is passed by environment only
+			args := strings.Join(bmc.commands[0], " ")
+			if want := "ipmitool -I lanplus -H 10.0.0.1 -U admin -E chassis power"; !strings.HasPrefix(args, want) {
+				t.Errorf("command is %q, want %q", args, want)
+			}
+			if strings.Contains(args, "secret") || !reflect.DeepEqual(bmc.env, []string{"IPMI_PASSWORD=secret"}) {
+				t.Errorf("password is passed as %q with environment %v", args, bmc.env)
+			}
+		})
+	}
+}
+
+func TestIPMICancel(t *testing.T) {
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/backend": "ipmi"})
+	r := newTestReconciler(node, newTestTemplate("fencing", map[string]string{"fencing/ipmi-address": "10.0.0.1"}))
+	bmc := &fakeIPMI{status: "on"}
+	f := &ipmiFencer{r: r, run: bmc.run}
+	if err := f.Cancel(context.TODO(), node); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	// Power command is issued synchronously, there is nothing to abort
+	if len(bmc.commands) != 0 {
+		t.Errorf("commands %v are issued by cancel, want none", bmc.commands)
+	}
+}
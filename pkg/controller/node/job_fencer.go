@@ -0,0 +1,211 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog"
+)
+
+// jobCacheRecheckInterval is the interval of rechecking the job created but not seen by the cache yet
+const jobCacheRecheckInterval = 5 * time.Second
+
+// jobFencer is the default fencing backend, it runs fencing Job created from the PodTemplate.
+// The Job Controller completes the fencing when the job succeeded.
+type jobFencer struct {
+	r *ReconcileNode
+}
+
+// Fence creates the fencing job for the node
+func (f *jobFencer) Fence(ctx context.Context, node *v1.Node) (FenceResult, error) {
+
+	// Job-based fencing is not possible, other backends are still available
+	if JobsDisabled {
+		klog.V(1).Infoln("Skip fencing", node.Name, ": job-based fencing is disabled")
+		return FenceResult{}, nil
+	}
+
+	// Find PodTemplate
+	podTemplate, err := f.r.getPodTemplate(node)
+	if err != nil {
+		return FenceResult{}, err
+	}
+
+	// Define a new Job object
+	job, err := BuildFencingJob(node, podTemplate)
+	if err != nil {
+		klog.Errorln("Invalid podTemplate", podTemplate.Name, ":", err)
+		f.r.recorder.Event(node, v1.EventTypeWarning, "InvalidTemplate", "Invalid podTemplate "+podTemplate.Name+": "+err.Error())
+		return FenceResult{}, nil
+	}
+
+	// Check if this Job already exists
+	found, err := f.r.findJob(node)
+	if err != nil {
+		return FenceResult{}, err
+	}
+
+	if found == nil {
+		// Previous job may be removed by the failed confirm job, don't retry it beyond fencing/max-attempts
+		if node.Annotations["fencing/attempts"] != "" && attemptsExhausted(node, podTemplate, "job") {
+			// The cache may not have seen the job just created yet
+			removed, err := f.jobRemoved(node)
+			if err != nil {
+				return FenceResult{}, err
+			}
+			if !removed {
+				klog.Infoln("Job of node", node.Name, "is not in cache yet")
+				return FenceResult{RequeueAfter: jobCacheRecheckInterval}, nil
+			}
+			reason := node.Annotations["fencing/last-error"]
+			if reason == "" {
+				reason = "fencing job is removed"
+			}
+			return FenceResult{}, f.r.failAttempts(node, podTemplate, reason)
+		}
+		// Previus job is not found
+		klog.Infoln("Starting fencing", node.Name)
+	} else {
+		// Previus job is found
+		klog.Infoln("Continue fencing", node.Name)
+
+		// Check is job finished
+		_, jf := util.GetJobCondition(&found.Status, batchv1.JobFailed)
+		if jf != nil {
+			// Job Controller completes the fencing if the job exited with success code
+			succeeded, err := util.JobSucceededByExitCode(ctx, f.r.client, found)
+			if err != nil {
+				return FenceResult{}, err
+			}
+			if succeeded {
+				klog.Infoln("Job", found.Name, "exited with success code")
+				return FenceResult{}, nil
+			}
+		}
+		if jf != nil && attemptsExhausted(node, podTemplate, "job") {
+			// Job Controller marks the fencing failed
+			klog.Infoln("Job", found.Name, "failed:", util.GetJobFailureReason(&found.Status))
+			return FenceResult{}, nil
+		}
+		_, jc := util.GetJobCondition(&found.Status, batchv1.JobComplete)
+		if jc != nil {
+			// Job is completed, Job Controller or the confirm job declares the node fenced - don't requeue
+			klog.Infoln("Job", found.Name, "completed, waiting for job controller or confirm job")
+			if found.Annotations["fencing/confirm-template"] != "" {
+				// Confirm job may fail and remove this job, recheck later
+				return FenceResult{RequeueAfter: 30 * time.Second}, nil
+			}
+			return FenceResult{}, nil
+		}
+
+		if jf == nil {
+			// Job is still running, node annotation updates must not restart it
+			klog.Infoln("Job", found.Name, "is still running")
+			return FenceResult{}, nil
+		}
+
+		if keepFailedJobs(node, podTemplate) {
+			// Old job failed - retain it and start a new attempt with distinct name
+			err = f.r.retainJob(node, found)
+		} else {
+			// Old job failed - remove it and start a new attempt
+			klog.Infoln("Deleting failed job", found.Name)
+			err = f.r.deleteJob(ctx, node.Name, found)
+		}
+		if err != nil && !errors.IsNotFound(err) {
+			klog.Errorln("Failed to cleanup job", found.Name, ":", err)
+			return FenceResult{}, err
+		}
+	}
+
+	// Use distinct name if the name is occupied by the retained job
+	exists := &batchv1.Job{}
+	err = f.r.client.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, exists)
+	if err != nil && !errors.IsNotFound(err) {
+		return FenceResult{}, err
+	}
+	if err == nil {
+		suffix := "-" + strconv.FormatInt(time.Now().Unix(), 10)
+		if len(job.Name)+len(suffix) > validation.DNS1123LabelMaxLength {
+			job.Name = strings.TrimRight(job.Name[:validation.DNS1123LabelMaxLength-len(suffix)], "-")
+		}
+		job.Name = job.Name + suffix
+	}
+
+	if _, overridden := util.JobRestartPolicy(podTemplate); overridden {
+		klog.Infoln("PodTemplate", podTemplate.Name, "has restartPolicy Always, job", job.Name, "uses Never")
+		f.r.recorder.Event(node, v1.EventTypeWarning, "RestartPolicyOverridden", "PodTemplate "+podTemplate.Name+" has restartPolicy Always, fencing job uses Never")
+	}
+	// Tag the job with the current incident for correlation, fencing is not delayed by the failed lookup
+	incidentID, err := IncidentID(ctx, f.r.client)
+	if err != nil {
+		klog.Errorln("Failed to get incident ID for job", job.Name, ":", err)
+	}
+	stampIncident(job, incidentID)
+
+	klog.Infoln("Creating a new job", job.Name)
+	err = f.r.createJob(ctx, node.Name, job)
+	if err != nil {
+		klog.Errorln("Failed to create new job", job.Name, ":", err)
+		return FenceResult{}, err
+	}
+
+	// Record job UID for traceability
+	err = util.PatchNodeAnnotations(ctx, f.r.client, node, map[string]interface{}{
+		"fencing/job-uid": string(job.UID),
+	})
+	if err != nil {
+		klog.Errorln("Failed to patch node", node.Name, ":", err)
+		return FenceResult{Started: true}, err
+	}
+
+	// Job created successfully - don't requeue
+	return FenceResult{Started: true}, nil
+}
+
+// jobRemoved confirms by the API server that the node has no fencing job, the cache is bypassed
+func (f *jobFencer) jobRemoved(node *v1.Node) (bool, error) {
+	jobs, err := f.r.clientset.BatchV1().Jobs(jobNamespace()).List(metav1.ListOptions{
+		LabelSelector: labels.Set{"fencing": "fence", "node": node.Name}.String(),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(jobs.Items) == 0, nil
+}
+
+// InProgress returns true if the fencing job of the node is running or staged, or it is finished
+// and the Job Controller completes the fencing, i.e. the failed job is not retried anymore
+func (f *jobFencer) InProgress(ctx context.Context, node *v1.Node) (bool, error) {
+	found, err := f.r.findJob(node)
+	if err != nil || found == nil {
+		return false, err
+	}
+	_, jf := util.GetJobCondition(&found.Status, batchv1.JobFailed)
+	if jf == nil {
+		return true, nil
+	}
+	podTemplate, err := f.r.getPodTemplate(node)
+	if err != nil {
+		return false, err
+	}
+	if attemptsExhausted(node, podTemplate, "job") {
+		return true, nil
+	}
+	return util.JobSucceededByExitCode(ctx, f.r.client, found)
+}
+
+// Cancel leaves the running job to finish, it is removed by the recovery cleanup
+func (f *jobFencer) Cancel(ctx context.Context, node *v1.Node) error {
+	return nil
+}
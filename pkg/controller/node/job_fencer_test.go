@@ -0,0 +1,258 @@
+package node
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// uidClient assigns UIDs to the created objects like the API server
+type uidClient struct {
+	client.Client
+}
+
+func (c uidClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	accessor.SetUID(types.UID("uid-" + accessor.GetName()))
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestJobFence(t *testing.T) {
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/state": "started"})
+	r := newTestReconciler(node, newTestTemplate("fencing", nil))
+	r.client = uidClient{r.client}
+
+	result, err := r.fencers["job"].Fence(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("fence failed: %v", err)
+	}
+	if result != (FenceResult{Started: true}) {
+		t.Errorf("result is %+v, want started attempt", result)
+	}
+	job, err := r.findJob(node)
+	if err != nil || job == nil {
+		t.Fatalf("fencing job is not created: %v", err)
+	}
+	if job.Labels["fencing"] != "fence" || job.Annotations["fencing/node"] != "node1" {
+		t.Errorf("job is labeled %v and annotated %v", job.Labels, job.Annotations)
+	}
+	stored := &v1.Node{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "node1"}, stored); err != nil {
+		t.Fatalf("get node failed: %v", err)
+	}
+	if uid := stored.Annotations["fencing/job-uid"]; uid == "" || uid != string(job.UID) {
+		t.Errorf("job UID is recorded as %q, want %q", uid, job.UID)
+	}
+	if inProgress, err := attemptInProgress(context.TODO(), r.fencers["job"], stored); err != nil || !inProgress {
+		t.Errorf("running job attempt in progress is %v: %v", inProgress, err)
+	}
+
+	// Node annotation updates must not restart the running job
+	if _, err := r.fencers["job"].Fence(context.TODO(), stored); err != nil {
+		t.Fatalf("fence failed: %v", err)
+	}
+	jobs := &batchv1.JobList{}
+	if err := r.client.List(context.TODO(), jobs); err != nil {
+		t.Fatalf("list jobs failed: %v", err)
+	}
+	if len(jobs.Items) != 1 {
+		t.Errorf("%d jobs are created, want 1", len(jobs.Items))
+	}
+}
+
+func TestJobsDisabled(t *testing.T) {
+	defer func(disabled bool) {
+		JobsDisabled = disabled
+	}(JobsDisabled)
+	JobsDisabled = true
+
+	webhook := &fakeWebhook{code: http.StatusOK}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		backend string
+		state   string
+	}{
+		{name: "job backend is skipped", backend: "job", state: "started"},
+		{name: "other backends fence the node", backend: "webhook", state: "fenced"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestReconciler(
+				newTestNode("node1", v1.ConditionUnknown, map[string]string{
+					"fencing/enabled": "true",
+					"fencing/state":   "started",
+					"fencing/mode":    "none",
+					"fencing/backend": tt.backend,
+				}),
+				newTestTemplate("fencing", map[string]string{"fencing/webhook-url": server.URL + "/fence"}),
+			)
+			node, _, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			jobs := &batchv1.JobList{}
+			if err := r.client.List(context.TODO(), jobs); err != nil {
+				t.Fatalf("list jobs failed: %v", err)
+			}
+			if len(jobs.Items) != 0 {
+				t.Errorf("%d jobs are created with batch/v1 API unavailable", len(jobs.Items))
+			}
+		})
+	}
+}
+
+func TestJobOwnerReference(t *testing.T) {
+	defer func(block bool) {
+		BlockOwnerDeletion = block
+	}(BlockOwnerDeletion)
+
+	for _, block := range []bool{true, false} {
+		BlockOwnerDeletion = block
+		node := newTestNode("node1", v1.ConditionUnknown, nil)
+		node.UID = "node-uid"
+		job, err := BuildFencingJob(node, newTestTemplate("fencing", nil))
+		if err != nil {
+			t.Fatalf("build job failed: %v", err)
+		}
+		if len(job.OwnerReferences) != 1 {
+			t.Fatalf("job has %d owner references, want 1", len(job.OwnerReferences))
+		}
+		ref := job.OwnerReferences[0]
+		if ref.UID != node.UID || ref.Controller == nil || !*ref.Controller {
+			t.Errorf("job is owned by %+v, want controller node %s", ref, node.UID)
+		}
+		if ref.BlockOwnerDeletion == nil || *ref.BlockOwnerDeletion != block {
+			t.Errorf("blockOwnerDeletion is %v, want %v", ref.BlockOwnerDeletion, block)
+		}
+	}
+}
+
+// blockingClient holds the first node read until released, so the other reconcile of the node overlaps it
+type blockingClient struct {
+	client.Client
+	once    sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if _, ok := obj.(*v1.Node); ok {
+		first := false
+		c.once.Do(func() { first = true })
+		if first {
+			close(c.entered)
+			<-c.release
+		}
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func TestOverlappingReconciles(t *testing.T) {
+	r := newTestReconciler(
+		newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true", "fencing/state": "started"}),
+		newTestTemplate("fencing", nil),
+	)
+	c := &blockingClient{Client: r.client, entered: make(chan struct{}), release: make(chan struct{})}
+	r.client = c
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "node1"}})
+	}()
+	<-c.entered
+
+	// The overlapping reconcile short-circuits and is retried later
+	result, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "node1"}})
+	if err != nil || result.RequeueAfter != time.Second {
+		t.Errorf("overlapping reconcile result is %+v (error %v), want requeue after 1s", result, err)
+	}
+	close(c.release)
+	wg.Wait()
+
+	jobs := &batchv1.JobList{}
+	if err := r.client.List(context.TODO(), jobs, client.MatchingLabels{"node": "node1"}); err != nil {
+		t.Fatalf("list jobs failed: %v", err)
+	}
+	if len(jobs.Items) != 1 {
+		t.Errorf("%d jobs are created, want 1", len(jobs.Items))
+	}
+	// The node is released when the reconcile is done
+	if nodes := r.inflight.snapshot(); len(nodes) != 0 {
+		t.Errorf("nodes %v are left in flight", nodes)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/state": "started"})
+	r := newTestReconciler(node, newTestTemplate("fencing", nil))
+	if _, err := r.fencers["job"].Fence(context.TODO(), node); err != nil {
+		t.Fatalf("fence failed: %v", err)
+	}
+	if err := r.fencers["job"].Cancel(context.TODO(), node); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	// Running job is left to the recovery cleanup
+	if job, err := r.findJob(node); err != nil || job == nil {
+		t.Errorf("fencing job is removed by cancel: %v", err)
+	}
+}
+
+func TestJobRemovedByConfirm(t *testing.T) {
+	tests := []struct {
+		name   string
+		inAPI  bool
+		failed bool
+	}{
+		{name: "job removed by failed confirm exhausts attempts", failed: true},
+		{name: "job not in cache yet is waited for", inAPI: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/state": "started", "fencing/attempts": "1"})
+			r := newTestReconciler(node, newTestTemplate("fencing", nil))
+			if tt.inAPI {
+				job := newJobForNode(node, newTestTemplate("fencing", nil))
+				if _, err := r.clientset.BatchV1().Jobs(job.Namespace).Create(job); err != nil {
+					t.Fatalf("create job failed: %v", err)
+				}
+			}
+
+			result, err := r.fencers["job"].Fence(context.TODO(), node)
+			if err != nil {
+				t.Fatalf("fence failed: %v", err)
+			}
+			stored := &v1.Node{}
+			if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "node1"}, stored); err != nil {
+				t.Fatalf("get node failed: %v", err)
+			}
+			if failed := stored.Annotations["fencing/state"] == "failed"; failed != tt.failed {
+				t.Errorf("node is failed %v, want %v", failed, tt.failed)
+			}
+			if !tt.failed && result.RequeueAfter != jobCacheRecheckInterval {
+				t.Errorf("result is %+v, want requeue after %v", result, jobCacheRecheckInterval)
+			}
+		})
+	}
+}
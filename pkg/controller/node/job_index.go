@@ -0,0 +1,42 @@
+package node
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// jobNodeIndex is the name of the cache index on the node label of the fencing jobs
+	jobNodeIndex = "fencing.node"
+)
+
+// addJobNodeIndex registers cache index on the node label of the jobs,
+// so the jobs of the node are found regardless of their names
+func addJobNodeIndex(mgr manager.Manager) error {
+	return mgr.GetFieldIndexer().IndexField(&batchv1.Job{}, jobNodeIndex, indexJobNode)
+}
+
+// indexJobNode returns the node label of the job
+func indexJobNode(obj runtime.Object) []string {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return nil
+	}
+	if node, ok := job.Labels["node"]; ok {
+		return []string{node}
+	}
+	return nil
+}
+
+// jobNode maps the fencing job to its node
+func jobNode(o handler.MapObject) []reconcile.Request {
+	labels := o.Meta.GetLabels()
+	if labels["fencing"] != "fence" || labels["node"] == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: labels["node"]}}}
+}
@@ -0,0 +1,88 @@
+package node
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestFindJob(t *testing.T) {
+	older := newTestJob("fence-node1-old", "node1", "fence")
+	older.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	newer := newTestJob("renamed-node1", "node1", "fence")
+	newer.CreationTimestamp = metav1.NewTime(time.Now())
+
+	tests := []struct {
+		name     string
+		jobs     []*batchv1.Job
+		disabled bool
+		found    string
+	}{
+		{name: "no jobs"},
+		{name: "job found by node label regardless of name", jobs: []*batchv1.Job{newer}, found: "renamed-node1"},
+		{name: "newest job is returned", jobs: []*batchv1.Job{older, newer}, found: "renamed-node1"},
+		{name: "jobs of other nodes are ignored", jobs: []*batchv1.Job{newTestJob("fence-node2", "node2", "fence")}},
+		{name: "archived jobs are ignored", jobs: []*batchv1.Job{newTestJob("fence-node1", "node1", "recovered")}},
+		{name: "no jobs without batch/v1 API", jobs: []*batchv1.Job{newer}, disabled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(disabled bool) {
+				JobsDisabled = disabled
+			}(JobsDisabled)
+			JobsDisabled = tt.disabled
+
+			node := newTestNode("node1", v1.ConditionUnknown, nil)
+			objs := []runtime.Object{node}
+			for _, job := range tt.jobs {
+				objs = append(objs, job)
+			}
+			r := newTestReconciler(objs...)
+			found, err := r.findJob(node)
+			if err != nil {
+				t.Fatalf("find job failed: %v", err)
+			}
+			name := ""
+			if found != nil {
+				name = found.Name
+			}
+			if name != tt.found {
+				t.Errorf("found job %q, want %q", name, tt.found)
+			}
+		})
+	}
+}
+
+func TestJobNode(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		requests []reconcile.Request
+	}{
+		{
+			name:     "fencing job",
+			labels:   map[string]string{"fencing": "fence", "node": "node1"},
+			requests: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "node1"}}},
+		},
+		{name: "archived job", labels: map[string]string{"fencing": "recovered", "node": "node1"}},
+		{name: "job without node", labels: map[string]string{"fencing": "fence"}},
+		{name: "other job"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "job", Labels: tt.labels}}
+			requests := jobNode(handler.MapObject{Meta: job, Object: job})
+			if !reflect.DeepEqual(requests, tt.requests) {
+				t.Errorf("requests %v, want %v", requests, tt.requests)
+			}
+		})
+	}
+}
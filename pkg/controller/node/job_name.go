@@ -0,0 +1,43 @@
+package node
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// invalidNameChars matches characters not allowed in DNS-1123 labels
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// renderJobName renders fencing/job-name-template against the node and makes the result DNS-safe,
+// empty string is returned if the template is not specified
+func renderJobName(node *v1.Node, podTemplate *v1.PodTemplate) (string, error) {
+	text, ok := getAnnotation(node, podTemplate, "fencing/job-name-template")
+	if !ok || text == "" {
+		return "", nil
+	}
+	tpl, err := template.New("job-name").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse fencing/job-name-template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, node); err != nil {
+		return "", fmt.Errorf("failed to render fencing/job-name-template: %v", err)
+	}
+
+	// Make the name DNS-safe
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(buf.String()), "-")
+	if len(name) > validation.DNS1123LabelMaxLength {
+		name = name[:validation.DNS1123LabelMaxLength]
+	}
+	name = strings.Trim(name, "-")
+	if name == "" {
+		return "", fmt.Errorf("fencing/job-name-template %q rendered to empty name", text)
+	}
+	return name, nil
+}
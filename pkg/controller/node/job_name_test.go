@@ -0,0 +1,50 @@
+package node
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestRenderJobName(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		jobName  string
+		invalid  bool
+	}{
+		{name: "no template"},
+		{name: "node name", template: "fence-{{ .Name }}", jobName: "fence-node1-example-com"},
+		{name: "node label", template: `fence-{{ index .Labels "rack" }}-{{ .Name }}`, jobName: "fence-r1-node1-example-com"},
+		{name: "missing label", template: `fence-{{ index .Labels "zone" }}-{{ .Name }}`, jobName: "fence--node1-example-com"},
+		{name: "uppercase and invalid characters", template: "Fence_{{ .Name }}!", jobName: "fence-node1-example-com"},
+		{name: "long name is truncated", template: strings.Repeat("a", 70) + "-{{ .Name }}", jobName: strings.Repeat("a", 63)},
+		{name: "invalid template", template: "fence-{{ .Name", invalid: true},
+		{name: "unknown field", template: "fence-{{ .Unknown }}", invalid: true},
+		{name: "empty name", template: "{{ .Namespace }}", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1.example.com", v1.ConditionUnknown, nil)
+			node.Labels = map[string]string{"rack": "r1"}
+			var annotations map[string]string
+			if tt.template != "" {
+				annotations = map[string]string{"fencing/job-name-template": tt.template}
+			}
+			jobName, err := renderJobName(node, newTestTemplate("fencing", annotations))
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("invalid template is rendered to %q", jobName)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("render failed: %v", err)
+			}
+			if jobName != tt.jobName {
+				t.Errorf("job name is %q, want %q", jobName, tt.jobName)
+			}
+		})
+	}
+}
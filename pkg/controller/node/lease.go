@@ -0,0 +1,47 @@
+package node
+
+import (
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// nodeLeaseNamespace is the namespace with the heartbeat Leases of the nodes
+	nodeLeaseNamespace = "kube-node-lease"
+	// defaultLeaseThreshold is the default age of the node Lease renewal considered as expired
+	defaultLeaseThreshold = 40 * time.Second
+)
+
+// leaseExpired returns true if the node Lease was not renewed for fencing/lease-threshold,
+// otherwise the time remaining until it expires. Missing Lease is not considered as expired.
+func (r *ReconcileNode) leaseExpired(node *v1.Node) (bool, time.Duration, error) {
+	threshold := defaultLeaseThreshold
+	if v, ok := node.Annotations["fencing/lease-threshold"]; ok {
+		var err error
+		if threshold, err = util.ParseDuration(v); err != nil {
+			klog.Errorln("Failed to parse lease-threshold string", v, ":", err)
+			threshold = defaultLeaseThreshold
+		}
+	}
+
+	lease, err := r.clientset.CoordinationV1().Leases(nodeLeaseNamespace).Get(node.Name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, 0, nil
+		}
+		return false, 0, err
+	}
+	if lease.Spec.RenewTime == nil {
+		return false, threshold, nil
+	}
+	remain := time.Until(lease.Spec.RenewTime.Add(threshold))
+	if remain <= 0 {
+		return true, 0, nil
+	}
+	return false, remain, nil
+}
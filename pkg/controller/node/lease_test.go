@@ -0,0 +1,53 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLeaseTrigger(t *testing.T) {
+	tests := []struct {
+		name    string
+		renewed time.Duration
+		lease   bool
+		state   string
+		requeue bool
+	}{
+		{name: "expired lease", renewed: time.Minute, lease: true, state: "started"},
+		{name: "renewed lease", renewed: 10 * time.Second, lease: true, requeue: true},
+		{name: "missing lease"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Node condition is not updated yet
+			node := newTestNode("node1", v1.ConditionTrue, map[string]string{
+				"fencing/enabled": "true",
+				"fencing/trigger": "lease",
+			})
+			r := newTestReconciler(node, newTestTemplate("fencing", nil))
+			if tt.lease {
+				renewTime := metav1.NewMicroTime(time.Now().Add(-tt.renewed))
+				r.clientset = k8sfake.NewSimpleClientset(&coordinationv1.Lease{
+					ObjectMeta: metav1.ObjectMeta{Name: "node1", Namespace: nodeLeaseNamespace},
+					Spec:       coordinationv1.LeaseSpec{RenewTime: &renewTime},
+				})
+			}
+			node, result, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			// Renewed lease is checked again when it expires
+			if requeue := result.RequeueAfter > 0 && result.RequeueAfter <= defaultLeaseThreshold; requeue != tt.requeue {
+				t.Errorf("requeue after %v, want requeue %v", result.RequeueAfter, tt.requeue)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/metrics"
+	"github.com/kvaps/kube-fencing/pkg/util"
+	"golang.org/x/time/rate"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	// MaxConcurrentFences is the maximum number of nodes being fenced at the same time, 0 means unlimited
+	MaxConcurrentFences int
+	// MinHealthyNodes is the minimum number of Ready nodes required to start fencing, 0 disables the check
+	MinHealthyNodes int
+	// FenceRate is the maximum number of fencing attempts started per minute, 0 means unlimited
+	FenceRate float64
+	// FenceBurst is the number of fencing attempts which can be started at once within FenceRate
+	FenceBurst = 1
+	// RecoveryRate is the maximum number of recovered nodes cleaned up per minute, 0 means unlimited
+	RecoveryRate float64
+	// RecoveryBurst is the number of recovered nodes which can be cleaned up at once within RecoveryRate
+	RecoveryBurst = 10
+)
+
+// newRateLimiter returns the token bucket limiting the rate of new fencings, or nil if FenceRate is not set
+func newRateLimiter() *rate.Limiter {
+	if FenceRate <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(FenceRate/60), FenceBurst)
+}
+
+// newRecoveryLimiter returns the token bucket limiting the rate of recovery cleanups, or nil if RecoveryRate is not set
+func newRecoveryLimiter() *rate.Limiter {
+	if RecoveryRate <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(RecoveryRate/60), RecoveryBurst)
+}
+
+// reserveFence takes a token for a new fencing, returns the delay until a token is available if there is no one
+func (r *ReconcileNode) reserveFence() time.Duration {
+	return reserve(r.limiter)
+}
+
+// reserveRecovery takes a token for a recovery cleanup, returns the delay until a token is available if there is no one
+func (r *ReconcileNode) reserveRecovery() time.Duration {
+	return reserve(r.recoveryLimiter)
+}
+
+// reserve takes a token from the limiter, returns the delay until a token is available if there is no one
+func reserve(limiter *rate.Limiter) time.Duration {
+	if limiter == nil {
+		return 0
+	}
+	res := limiter.Reserve()
+	if !res.OK() {
+		return time.Minute
+	}
+	if delay := res.Delay(); delay > 0 {
+		res.Cancel()
+		return delay
+	}
+	return 0
+}
+
+// checkLimits returns the name of the safety limit (template, concurrency, priority or quorum) which defers
+// the fencing of the node, or empty string if fencing can be started
+func (r *ReconcileNode) checkLimits(ctx context.Context, node *v1.Node, podTemplate *v1.PodTemplate) (string, error) {
+	if max, _ := strconv.Atoi(podTemplate.Annotations["fencing/max-concurrent"]); max > 0 {
+		running, err := r.countTemplateJobs(ctx, podTemplate)
+		if err != nil {
+			return "", err
+		}
+		if running >= max {
+			return "template", nil
+		}
+	}
+	if MaxConcurrentFences > 0 {
+		active, err := r.activeNodes(ctx)
+		if err != nil {
+			return "", err
+		}
+		running := 0
+		for _, ok := range active {
+			if ok {
+				running++
+			}
+		}
+		now := time.Now()
+		priority := nodePriority(node, podTemplate)
+		if running >= MaxConcurrentFences {
+			r.waiting.wait(node.Name, priority, now)
+			return "concurrency", nil
+		}
+		// Leave free slots for the waiting nodes with higher priority
+		if running+r.waiting.countPrior(node.Name, priority, active, now) >= MaxConcurrentFences {
+			r.waiting.wait(node.Name, priority, now)
+			return "priority", nil
+		}
+		r.waiting.leave(node.Name)
+	}
+	if MinHealthyNodes > 0 {
+		ready, err := r.countReadyNodes(ctx)
+		if err != nil {
+			return "", err
+		}
+		if ready < MinHealthyNodes {
+			return "quorum", nil
+		}
+	}
+	return "", nil
+}
+
+// deferFencing checks the backoff, the safety limits and the rate limit before a new fencing attempt of the node with any backend,
+// deferred is true with the result requeueing the node if the attempt can not be started now
+func (r *ReconcileNode) deferFencing(ctx context.Context, node *v1.Node, podTemplate *v1.PodTemplate) (result reconcile.Result, deferred bool, err error) {
+	// Wait before the next attempt
+	if delay := nextReconcileAfter(node, podTemplate, time.Now()); delay > 0 {
+		klog.Infoln("Next fencing attempt of", node.Name, "is in", delay)
+		return reconcile.Result{RequeueAfter: delay}, true, nil
+	}
+
+	limit, err := r.checkLimits(ctx, node, podTemplate)
+	if err != nil {
+		return reconcile.Result{}, true, err
+	}
+	if limit != "" {
+		klog.Infoln("Fencing", node.Name, "is deferred by", limit, "limit")
+		r.recorder.Event(node, v1.EventTypeWarning, "FencingThrottled", "Fencing is deferred by "+limit+" limit")
+		metrics.Throttled.WithLabelValues(limit).Inc()
+		return reconcile.Result{RequeueAfter: 30 * time.Second}, true, nil
+	}
+	if delay := r.reserveFence(); delay > 0 {
+		klog.Infoln("Fencing", node.Name, "is deferred by rate limit for", delay)
+		r.recorder.Event(node, v1.EventTypeWarning, "FencingThrottled", "Fencing is deferred by rate limit")
+		metrics.Throttled.WithLabelValues("rate").Inc()
+		return reconcile.Result{RequeueAfter: delay}, true, nil
+	}
+	return reconcile.Result{}, false, nil
+}
+
+// activeNodes returns the names of the nodes occupying fencing slots: the nodes with running fencing jobs
+// and the fencing nodes with attempts of other backends in progress, the nodes with staged jobs are mapped to false
+func (r *ReconcileNode) activeNodes(ctx context.Context) (map[string]bool, error) {
+	active, err := r.activeJobNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes := &v1.NodeList{}
+	if err := r.client.List(ctx, nodes); err != nil {
+		return nil, err
+	}
+	backends := r.backends()
+	for i := range nodes.Items {
+		n := &nodes.Items[i]
+		if _, ok := active[n.Name]; ok || n.Annotations["fencing/state"] != "started" {
+			continue
+		}
+		// Backends track their attempts in the node annotations, so the backend of the node need not be resolved
+		for name, f := range backends {
+			if name == "job" {
+				continue
+			}
+			inProgress, err := attemptInProgress(ctx, f, n)
+			if err != nil {
+				return nil, err
+			}
+			if inProgress {
+				active[n.Name] = true
+				break
+			}
+		}
+	}
+	return active, nil
+}
+
+// activeJobNodes returns the names of the nodes with fencing jobs which are not finished yet,
+// the nodes with staged jobs are mapped to false as they don't occupy fencing slot
+func (r *ReconcileNode) activeJobNodes(ctx context.Context) (map[string]bool, error) {
+	active := map[string]bool{}
+	if JobsDisabled {
+		return active, nil
+	}
+	jobs := &batchv1.JobList{}
+	err := r.client.List(ctx, jobs,
+		client.InNamespace(jobNamespace()),
+		client.MatchingLabels{"fencing": "fence"},
+	)
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs.Items {
+		_, jc := util.GetJobCondition(&jobs.Items[i].Status, batchv1.JobComplete)
+		_, jf := util.GetJobCondition(&jobs.Items[i].Status, batchv1.JobFailed)
+		if jc == nil && jf == nil {
+			active[jobs.Items[i].Labels["node"]] = !jobStaged(&jobs.Items[i])
+		}
+	}
+	return active, nil
+}
+
+// countTemplateJobs returns the number of running fencing jobs created from the podTemplate, staged jobs are not counted
+func (r *ReconcileNode) countTemplateJobs(ctx context.Context, podTemplate *v1.PodTemplate) (int, error) {
+	if JobsDisabled {
+		return 0, nil
+	}
+	jobs := &batchv1.JobList{}
+	err := r.client.List(ctx, jobs,
+		client.InNamespace(podTemplate.Namespace),
+		client.MatchingLabels{"fencing": "fence", "fencing/template": podTemplate.Name},
+	)
+	if err != nil {
+		return 0, err
+	}
+	running := 0
+	for i := range jobs.Items {
+		_, jc := util.GetJobCondition(&jobs.Items[i].Status, batchv1.JobComplete)
+		_, jf := util.GetJobCondition(&jobs.Items[i].Status, batchv1.JobFailed)
+		if jc == nil && jf == nil && !jobStaged(&jobs.Items[i]) {
+			running++
+		}
+	}
+	return running, nil
+}
+
+// nodePriority returns fencing/priority of the node or its podTemplate, 0 by default
+func nodePriority(node *v1.Node, podTemplate *v1.PodTemplate) int {
+	v, _ := getAnnotation(node, podTemplate, "fencing/priority")
+	priority, err := strconv.Atoi(v)
+	if err != nil {
+		return 0
+	}
+	return priority
+}
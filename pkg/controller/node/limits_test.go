@@ -0,0 +1,235 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// finishedJob returns the fencing job of the node with the finished condition
+func finishedJob(name, node string, condition batchv1.JobConditionType) *batchv1.Job {
+	job := newTestJob(name, node, "fence")
+	job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: v1.ConditionTrue}}
+	return job
+}
+
+func TestCheckLimits(t *testing.T) {
+	webhookStarted := newTestNode("node3", v1.ConditionUnknown, map[string]string{
+		"fencing/state":              "started",
+		"fencing/backend":            "webhook",
+		"fencing/webhook-status-url": "http://fencer/status/node3",
+	})
+	webhookFinished := newTestNode("node3", v1.ConditionUnknown, map[string]string{
+		"fencing/state":   "started",
+		"fencing/backend": "webhook",
+	})
+	staged := newTestJob("fence-node2", "node2", "fence")
+	staged.Annotations = map[string]string{"fencing/staged-parallelism": "1"}
+	staged.Spec.Parallelism = new(int32)
+
+	tests := []struct {
+		name          string
+		maxConcurrent int
+		minHealthy    int
+		objs          []runtime.Object
+		limit         string
+	}{
+		{name: "no limits", objs: []runtime.Object{newTestJob("fence-node2", "node2", "fence")}},
+		{name: "free slot", maxConcurrent: 2, objs: []runtime.Object{newTestJob("fence-node2", "node2", "fence")}},
+		{name: "running job occupies the slot", maxConcurrent: 1, objs: []runtime.Object{newTestJob("fence-node2", "node2", "fence")}, limit: "concurrency"},
+		{name: "finished jobs free their slots", maxConcurrent: 1, objs: []runtime.Object{
+			finishedJob("fence-node2", "node2", batchv1.JobComplete),
+			finishedJob("fence-node3", "node3", batchv1.JobFailed),
+		}},
+		{name: "staged job does not occupy the slot", maxConcurrent: 1, objs: []runtime.Object{staged}},
+		{name: "attempt of other backend occupies the slot", maxConcurrent: 1, objs: []runtime.Object{webhookStarted}, limit: "concurrency"},
+		{name: "finished attempt of other backend frees the slot", maxConcurrent: 1, objs: []runtime.Object{webhookFinished}},
+		{name: "quorum is met", minHealthy: 1, objs: []runtime.Object{newTestNode("node2", v1.ConditionTrue, nil)}},
+		{name: "quorum is lost", minHealthy: 2, objs: []runtime.Object{newTestNode("node2", v1.ConditionTrue, nil)}, limit: "quorum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(maxConcurrent, minHealthy int) {
+				MaxConcurrentFences, MinHealthyNodes = maxConcurrent, minHealthy
+			}(MaxConcurrentFences, MinHealthyNodes)
+			MaxConcurrentFences, MinHealthyNodes = tt.maxConcurrent, tt.minHealthy
+
+			node := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/state": "started"})
+			podTemplate := newTestTemplate("fencing", map[string]string{"fencing/webhook-url": "http://fencer/fence"})
+			r := newTestReconciler(append(tt.objs, node, podTemplate)...)
+			limit, err := r.checkLimits(context.TODO(), node, podTemplate)
+			if err != nil {
+				t.Fatalf("check limits failed: %v", err)
+			}
+			if limit != tt.limit {
+				t.Errorf("limit is %q, want %q", limit, tt.limit)
+			}
+		})
+	}
+}
+
+func TestLimitsApplyToEveryBackend(t *testing.T) {
+	defer func(maxConcurrent int) {
+		MaxConcurrentFences = maxConcurrent
+	}(MaxConcurrentFences)
+	MaxConcurrentFences = 1
+
+	for _, backend := range []string{"job", "webhook", "redfish"} {
+		t.Run(backend, func(t *testing.T) {
+			r := newTestReconciler(
+				newTestNode("node1", v1.ConditionUnknown, map[string]string{
+					"fencing/enabled": "true",
+					"fencing/state":   "started",
+					"fencing/backend": backend,
+				}),
+				newTestJob("fence-node2", "node2", "fence"),
+				newTestTemplate("fencing", nil),
+			)
+			node, result, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if result.RequeueAfter == 0 {
+				t.Errorf("fencing is not deferred")
+			}
+			if _, ok := node.Annotations["fencing/attempts"]; ok {
+				t.Errorf("fencing attempt is started over concurrency limit")
+			}
+		})
+	}
+}
+
+func TestReserve(t *testing.T) {
+	defer func(fenceRate float64, fenceBurst int) {
+		FenceRate, FenceBurst = fenceRate, fenceBurst
+	}(FenceRate, FenceBurst)
+
+	FenceRate = 0
+	if limiter := newRateLimiter(); limiter != nil {
+		t.Fatalf("rate limiter is created without --fence-rate")
+	}
+	if delay := reserve(nil); delay != 0 {
+		t.Errorf("unlimited fencing is deferred for %v", delay)
+	}
+
+	FenceRate, FenceBurst = 1, 2
+	limiter := newRateLimiter()
+	for i := 0; i < FenceBurst; i++ {
+		if delay := reserve(limiter); delay != 0 {
+			t.Fatalf("fencing %d within burst is deferred for %v", i, delay)
+		}
+	}
+	delay := reserve(limiter)
+	if delay <= 0 || delay > time.Minute {
+		t.Fatalf("fencing over burst is deferred for %v, want up to a minute", delay)
+	}
+	// The deferred fencing must not hold the token, otherwise every retry would push the next one further
+	if again := reserve(limiter); again > delay {
+		t.Errorf("retry is deferred for %v, longer than %v", again, delay)
+	}
+}
+
+func TestDeferFencingRate(t *testing.T) {
+	defer func(fenceRate float64, fenceBurst int) {
+		FenceRate, FenceBurst = fenceRate, fenceBurst
+	}(FenceRate, FenceBurst)
+	FenceRate, FenceBurst = 1, 1
+
+	node1 := newTestNode("node1", v1.ConditionUnknown, nil)
+	node2 := newTestNode("node2", v1.ConditionUnknown, nil)
+	podTemplate := newTestTemplate("fencing", nil)
+	r := newTestReconciler(node1, node2, podTemplate)
+
+	if _, deferred, err := r.deferFencing(context.TODO(), node1, podTemplate); err != nil || deferred {
+		t.Fatalf("first fencing is deferred: %v", err)
+	}
+	result, deferred, err := r.deferFencing(context.TODO(), node2, podTemplate)
+	if err != nil {
+		t.Fatalf("defer fencing failed: %v", err)
+	}
+	if !deferred || result.RequeueAfter <= 0 {
+		t.Errorf("fencing over rate limit is not deferred")
+	}
+}
+
+func TestCheckLimitsTemplate(t *testing.T) {
+	templateJob := func(name, node, template string) *batchv1.Job {
+		job := newTestJob(name, node, "fence")
+		job.Labels["fencing/template"] = template
+		return job
+	}
+	staged := templateJob("fence-node3", "node3", "fencing")
+	staged.Annotations = map[string]string{"fencing/staged-parallelism": "1"}
+	staged.Spec.Parallelism = new(int32)
+	finished := templateJob("fence-node3", "node3", "fencing")
+	finished.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1.ConditionTrue}}
+
+	tests := []struct {
+		name          string
+		maxConcurrent string
+		jobs          []runtime.Object
+		limit         string
+	}{
+		{name: "no template limit", jobs: []runtime.Object{templateJob("fence-node2", "node2", "fencing")}},
+		{name: "invalid template limit is ignored", maxConcurrent: "one", jobs: []runtime.Object{templateJob("fence-node2", "node2", "fencing")}},
+		{name: "free template slot", maxConcurrent: "2", jobs: []runtime.Object{templateJob("fence-node2", "node2", "fencing")}},
+		{name: "template slots are taken", maxConcurrent: "1", jobs: []runtime.Object{templateJob("fence-node2", "node2", "fencing")}, limit: "template"},
+		{name: "jobs of other templates are not counted", maxConcurrent: "1", jobs: []runtime.Object{templateJob("fence-node2", "node2", "other")}},
+		{name: "staged jobs are not counted", maxConcurrent: "1", jobs: []runtime.Object{staged}},
+		{name: "finished jobs are not counted", maxConcurrent: "1", jobs: []runtime.Object{finished}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", v1.ConditionUnknown, nil)
+			podTemplate := newTestTemplate("fencing", nil)
+			if tt.maxConcurrent != "" {
+				podTemplate.Annotations = map[string]string{"fencing/max-concurrent": tt.maxConcurrent}
+			}
+			r := newTestReconciler(append(tt.jobs, node, podTemplate)...)
+			limit, err := r.checkLimits(context.TODO(), node, podTemplate)
+			if err != nil {
+				t.Fatalf("check limits failed: %v", err)
+			}
+			if limit != tt.limit {
+				t.Errorf("limit is %q, want %q", limit, tt.limit)
+			}
+		})
+	}
+}
+
+func TestRecoveryRate(t *testing.T) {
+	defer func(recoveryRate float64, recoveryBurst int) {
+		RecoveryRate, RecoveryBurst = recoveryRate, recoveryBurst
+	}(RecoveryRate, RecoveryBurst)
+	RecoveryRate, RecoveryBurst = 1, 1
+
+	recovered := func(name string) *v1.Node {
+		return newTestNode(name, v1.ConditionTrue, map[string]string{
+			"fencing/enabled": "true",
+			"fencing/state":   "fenced",
+		})
+	}
+	r := newTestReconciler(recovered("node1"), recovered("node2"), newTestTemplate("fencing", nil))
+
+	node, _, err := reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if state := node.Annotations["fencing/state"]; state != "" {
+		t.Errorf("first recovered node is not cleaned up, state is %q", state)
+	}
+	node, result, err := reconcileNode(r, "node2")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if result.RequeueAfter <= 0 {
+		t.Errorf("cleanup over rate limit is not deferred")
+	}
+	if state := node.Annotations["fencing/state"]; state != "fenced" {
+		t.Errorf("deferred node state is %q, want fenced", state)
+	}
+}
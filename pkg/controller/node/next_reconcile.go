@@ -0,0 +1,98 @@
+package node
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// NextReconcileAfter returns when the controller should next act on the node according to its fencing annotations:
+// the remaining fencing/timeout of not started fencing, the remaining backoff of started fencing, or 0 to act immediately.
+// Options defined only in PodTemplate are not taken into account.
+func NextReconcileAfter(node *v1.Node, now time.Time) time.Duration {
+	return nextReconcileAfter(node, &v1.PodTemplate{}, now)
+}
+
+// nextReconcileAfter returns when the controller should next act on the node according to
+// the fencing annotations of the node and podTemplate
+func nextReconcileAfter(node *v1.Node, podTemplate *v1.PodTemplate, now time.Time) time.Duration {
+	var remain time.Duration
+	switch node.Annotations["fencing/state"] {
+	case "", "pending":
+		remain = timeoutRemains(node, podTemplate, now)
+	case "started":
+		remain = backoffRemains(node, podTemplate, now)
+	}
+	if remain < 0 {
+		return 0
+	}
+	return remain
+}
+
+// timeoutRemains returns the remaining time the failed node is given to come back online,
+// counted from fencing/timestamp or from the unreachable taint with fencing/trigger=taint
+func timeoutRemains(node *v1.Node, podTemplate *v1.PodTemplate, now time.Time) time.Duration {
+	timeout, err := util.ParseDuration(timeoutOption(node, podTemplate))
+	if err != nil || timeout <= 0 {
+		return 0
+	}
+	since, _ := strconv.ParseInt(node.Annotations["fencing/timestamp"], 10, 64)
+	if node.Annotations["fencing/trigger"] == "taint" {
+		// Taint records the exact time when the node became unreachable
+		if taint := getUnreachableTaint(node); taint != nil && taint.TimeAdded != nil {
+			since = taint.TimeAdded.Unix()
+		}
+	}
+	if since == 0 {
+		return 0
+	}
+	return time.Unix(since, 0).Add(timeout).Sub(now)
+}
+
+// backoffRemains returns the remaining time until the next fencing attempt is allowed.
+// The delay starts with fencing/backoff and doubles with every attempt up to fencing/backoff-max,
+// attempts are counted in fencing/attempts annotation which is reset on recovery and when fencing is started.
+func backoffRemains(node *v1.Node, podTemplate *v1.PodTemplate, now time.Time) time.Duration {
+	attempts, _ := strconv.Atoi(node.Annotations["fencing/attempts"])
+	lastAttempt, err := strconv.ParseInt(node.Annotations["fencing/last-attempt"], 10, 64)
+	if attempts == 0 || err != nil {
+		return 0
+	}
+	v, ok := getAnnotation(node, podTemplate, "fencing/backoff")
+	if !ok {
+		return 0
+	}
+	delay, err := util.ParseDuration(v)
+	if err != nil {
+		klog.Errorln("Failed to parse backoff string", v, ":", err)
+		return 0
+	}
+	max := defaultBackoffMax
+	if v, ok := getAnnotation(node, podTemplate, "fencing/backoff-max"); ok {
+		if max, err = util.ParseDuration(v); err != nil {
+			klog.Errorln("Failed to parse backoff-max string", v, ":", err)
+			max = defaultBackoffMax
+		}
+	}
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return time.Unix(lastAttempt, 0).Add(delay).Sub(now)
+}
+
+// timeoutOption returns fencing/timeout of the node or podTemplate, or DefaultTimeout if it is not specified
+func timeoutOption(node *v1.Node, podTemplate *v1.PodTemplate) string {
+	if v, ok := getAnnotation(node, podTemplate, "fencing/timeout"); ok {
+		return v
+	}
+	if DefaultTimeout > 0 {
+		return DefaultTimeout.String()
+	}
+	return "0"
+}
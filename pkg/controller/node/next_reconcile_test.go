@@ -0,0 +1,108 @@
+package node
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBackoffRemains(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(-d).Unix(), 10)
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		template    map[string]string
+		remain      time.Duration
+	}{
+		{name: "no attempts", annotations: map[string]string{"fencing/backoff": "1m"}},
+		{name: "no backoff", annotations: map[string]string{"fencing/attempts": "1", "fencing/last-attempt": ago(0)}},
+		{name: "first attempt", annotations: map[string]string{"fencing/backoff": "1m", "fencing/attempts": "1", "fencing/last-attempt": ago(0)}, remain: time.Minute},
+		{name: "delay doubles", annotations: map[string]string{"fencing/backoff": "1m", "fencing/attempts": "3", "fencing/last-attempt": ago(0)}, remain: 4 * time.Minute},
+		{name: "delay is capped by default", annotations: map[string]string{"fencing/backoff": "1m", "fencing/attempts": "10", "fencing/last-attempt": ago(0)}, remain: defaultBackoffMax},
+		{name: "delay is capped by backoff-max", annotations: map[string]string{"fencing/backoff": "1m", "fencing/backoff-max": "3m", "fencing/attempts": "3", "fencing/last-attempt": ago(0)}, remain: 3 * time.Minute},
+		{name: "elapsed time is subtracted", annotations: map[string]string{"fencing/backoff": "1m", "fencing/attempts": "2", "fencing/last-attempt": ago(30 * time.Second)}, remain: 90 * time.Second},
+		{name: "backoff from podTemplate", annotations: map[string]string{"fencing/attempts": "1", "fencing/last-attempt": ago(0)}, template: map[string]string{"fencing/backoff": "2m"}, remain: 2 * time.Minute},
+		{name: "invalid backoff", annotations: map[string]string{"fencing/backoff": "soon", "fencing/attempts": "1", "fencing/last-attempt": ago(0)}},
+		{name: "invalid backoff-max falls back to default", annotations: map[string]string{"fencing/backoff": "1m", "fencing/backoff-max": "never", "fencing/attempts": "10", "fencing/last-attempt": ago(0)}, remain: defaultBackoffMax},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", v1.ConditionUnknown, tt.annotations)
+			remain := backoffRemains(node, newTestTemplate("fencing", tt.template), now)
+			// Attempt timestamps have second precision
+			if diff := remain - tt.remain; diff > time.Second || diff < -time.Second {
+				t.Errorf("backoff remains %v, want %v", remain, tt.remain)
+			}
+		})
+	}
+}
+
+func TestNextReconcileAfter(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(-d).Unix(), 10)
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		taintedAgo  time.Duration
+		remain      time.Duration
+	}{
+		{name: "no timeout", annotations: map[string]string{"fencing/timestamp": ago(0)}},
+		{name: "timeout of new failure", annotations: map[string]string{"fencing/timeout": "5m", "fencing/timestamp": ago(time.Minute)}, remain: 4 * time.Minute},
+		{name: "timeout of pending fencing", annotations: map[string]string{"fencing/state": "pending", "fencing/timeout": "5m", "fencing/timestamp": ago(time.Minute)}, remain: 4 * time.Minute},
+		{name: "timeout is over", annotations: map[string]string{"fencing/timeout": "5m", "fencing/timestamp": ago(10 * time.Minute)}},
+		{name: "timeout without timestamp", annotations: map[string]string{"fencing/timeout": "5m"}},
+		{name: "invalid timeout", annotations: map[string]string{"fencing/timeout": "later", "fencing/timestamp": ago(0)}},
+		{name: "timeout from unreachable taint", annotations: map[string]string{"fencing/trigger": "taint", "fencing/timeout": "5m", "fencing/timestamp": ago(0)}, taintedAgo: 2 * time.Minute, remain: 3 * time.Minute},
+		{name: "backoff of started fencing", annotations: map[string]string{"fencing/state": "started", "fencing/timeout": "5m", "fencing/backoff": "1m", "fencing/attempts": "1", "fencing/last-attempt": ago(0)}, remain: time.Minute},
+		{name: "fenced node", annotations: map[string]string{"fencing/state": "fenced", "fencing/timeout": "5m", "fencing/timestamp": ago(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", v1.ConditionUnknown, tt.annotations)
+			if tt.taintedAgo > 0 {
+				added := metav1.NewTime(now.Add(-tt.taintedAgo))
+				node.Spec.Taints = []v1.Taint{{Key: taintNodeUnreachable, Effect: v1.TaintEffectNoExecute, TimeAdded: &added}}
+			}
+			remain := NextReconcileAfter(node, now)
+			if diff := remain - tt.remain; diff > time.Second || diff < -time.Second {
+				t.Errorf("next reconcile is after %v, want %v", remain, tt.remain)
+			}
+		})
+	}
+}
+
+func TestTimeoutOption(t *testing.T) {
+	tests := []struct {
+		name           string
+		defaultTimeout time.Duration
+		node           map[string]string
+		template       map[string]string
+		timeout        string
+	}{
+		{name: "no timeout", timeout: "0"},
+		{name: "default timeout", defaultTimeout: 5 * time.Minute, timeout: "5m0s"},
+		{name: "podTemplate overrides default", defaultTimeout: 5 * time.Minute, template: map[string]string{"fencing/timeout": "1m"}, timeout: "1m"},
+		{name: "node overrides podTemplate", defaultTimeout: 5 * time.Minute, node: map[string]string{"fencing/timeout": "30s"}, template: map[string]string{"fencing/timeout": "1m"}, timeout: "30s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(defaultTimeout time.Duration) {
+				DefaultTimeout = defaultTimeout
+			}(DefaultTimeout)
+			DefaultTimeout = tt.defaultTimeout
+
+			node := newTestNode("node1", v1.ConditionUnknown, tt.node)
+			if timeout := timeoutOption(node, newTestTemplate("fencing", tt.template)); timeout != tt.timeout {
+				t.Errorf("timeout is %q, want %q", timeout, tt.timeout)
+			}
+		})
+	}
+}
@@ -3,16 +3,27 @@ package node
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
 	"time"
 
+	"github.com/kvaps/kube-fencing/pkg/audit"
+	"github.com/kvaps/kube-fencing/pkg/ipmi"
+	"github.com/kvaps/kube-fencing/pkg/metrics"
 	"github.com/kvaps/kube-fencing/pkg/util"
+	"golang.org/x/time/rate"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -24,34 +35,211 @@ import (
 
 var (
 	Namespace string
+	// TemplateNamespaces are additional namespaces searched for PodTemplates after Namespace
+	TemplateNamespaces []string
+	// ConditionType is the node condition used to detect failed nodes when
+	// fencing/condition-type annotation is not specified
+	ConditionType = v1.NodeReady
+	// IncludeNodes is a list of patterns, if not empty only nodes matching any of them are fenced
+	IncludeNodes []*regexp.Regexp
+	// ExcludeNodes is a list of patterns, nodes matching any of them are never fenced
+	ExcludeNodes []*regexp.Regexp
+	// KeepFailedJobsLimit is the maximum number of failed jobs retained for every node
+	KeepFailedJobsLimit = 3
+	// JobLabels are added to every fencing job unless overridden
+	JobLabels map[string]string
+	// JobAnnotations are added to every fencing job unless overridden by node or podTemplate
+	JobAnnotations map[string]string
+	// MinNodeAge is the age of the node before which it is not fenced, 0 disables the check
+	MinNodeAge time.Duration
+	// ImagePullSecrets are added to the pods of every fencing job
+	ImagePullSecrets []string
+	// DefaultTimeout is used when fencing/timeout is not specified for the node and podTemplate
+	DefaultTimeout time.Duration
+	// BlockOwnerDeletion sets blockOwnerDeletion of the node owner reference of fencing jobs,
+	// so the node deletion waits for the jobs removal by garbage collector
+	BlockOwnerDeletion = true
+	// JobsDisabled disables job-based fencing when batch/v1 API is not available
+	JobsDisabled bool
+	// ManualRecovery leaves the cleanup after node recovery to operator by default
+	ManualRecovery bool
+	// EnableFinalizer enables the finalizer which flushes the node before its deletion
+	EnableFinalizer bool
 )
 
+const (
+	// finalizerName is the finalizer added to the fencing enabled nodes
+	finalizerName = "fencing/cleanup"
+)
+
+// propagatedAnnotations are passed from the node or podTemplate to the fencing job
+var propagatedAnnotations = []string{
+	"fencing/complete-on-pod-success",
+	"fencing/confirm-template",
+	"fencing/drain",
+	"fencing/drain-timeout",
+	"fencing/max-attempts",
+	"fencing/out-of-service",
+	"fencing/pod-grace-period",
+	"fencing/post-fence-wait",
+	"fencing/reschedule-timeout",
+	"fencing/success-exit-codes",
+}
+
+// stateAnnotations record the progress of the node fencing, they are removed when the node recovers
+var stateAnnotations = []string{
+	"fencing/state",
+	"fencing/timestamp",
+	"fencing/last-error",
+	"fencing/job-uid",
+	"fencing/fenced-at",
+	"fencing/reschedule-owners",
+	"fencing/reschedule-deadline",
+	"fencing/attempts",
+	"fencing/last-attempt",
+	"fencing/started-at",
+	"fencing/webhook-status-url",
+	"fencing/redfish-reset-at",
+	"fencing/drain-started",
+	"fencing/first-timestamp",
+	"fencing/escalated",
+	"fencing/escalation-deadline",
+	"fencing/emergency",
+}
+
+// clearedStateAnnotations returns the patch removing stateAnnotations
+func clearedStateAnnotations() map[string]interface{} {
+	annotations := map[string]interface{}{}
+	for _, k := range stateAnnotations {
+		annotations[k] = nil
+	}
+	return annotations
+}
+
 // Add creates a new Node Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+	if Namespace == "" {
+		return fmt.Errorf("fencing namespace is not specified")
+	}
+	r := newReconciler(mgr)
+
+	// Dump the controller state for debugging
+	if StateConfigMap != "" {
+		if err := mgr.Add(&stateDumper{r: r.(*ReconcileNode)}); err != nil {
+			return err
+		}
+	}
+	return add(mgr, r)
 }
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileNode{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	r := &ReconcileNode{
+		client:    mgr.GetClient(),
+		clientset: kubernetes.NewForConfigOrDie(mgr.GetConfig()),
+		scheme:    mgr.GetScheme(),
+		recorder:  mgr.GetEventRecorderFor("fencing-controller"),
+		states:    newStateTracker(),
+		inflight:  newInflight(),
+		spans:     newSpanTracker(),
+		limiter:   newRateLimiter(),
+		batch:     newFailureBatch(),
+		waiting:   newWaitQueue(),
+		safeMode:  newSafeMode(),
+
+		recoveryLimiter: newRecoveryLimiter(),
+	}
+	r.fencers = map[string]Fencer{
+		"job":     &jobFencer{r: r},
+		"redfish": &redfishFencer{r: r},
+		"ipmi":    &ipmiFencer{r: r, run: ipmi.ExecRunner},
+		"webhook": &webhookFencer{r: r, client: &http.Client{Timeout: 30 * time.Second}},
+	}
+	return r
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 
+	// Index nodes by Ready status for counting healthy nodes
+	if err := addReadyIndex(mgr); err != nil {
+		return err
+	}
+
+	// Index jobs by node for finding the fencing jobs of the node, jobs are not watched without batch/v1 API
+	if !JobsDisabled {
+		if err := addJobNodeIndex(mgr); err != nil {
+			return err
+		}
+	}
+
 	// Create a new controller
 	c, err := controller.New("node-controller", mgr, controller.Options{Reconciler: r})
 	if err != nil {
 		return err
 	}
 
-	// Watch for changes to primary resource Node
-	err = c.Watch(&source.Kind{Type: &v1.Node{}}, &handler.EnqueueRequestForObject{})
+	// Watch for changes to primary resource Node, ignoring heartbeat-only updates
+	err = c.Watch(&source.Kind{Type: &v1.Node{}}, &handler.EnqueueRequestForObject{}, nodeChangedPredicate)
+	if err != nil {
+		return err
+	}
+
+	// Re-examine the node when its fencing job is finished, the failed job is retried while attempts remain
+	if !JobsDisabled {
+		err = c.Watch(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(jobNode),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Re-examine the nodes when their PodTemplate is changed
+	err = c.Watch(&source.Kind{Type: &v1.PodTemplate{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.(*ReconcileNode).templateNodes),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Re-examine the nodes when the ConfigMap referenced by their fencing/config-ref is changed
+	err = c.Watch(&source.Kind{Type: &v1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.(*ReconcileNode).configNodes),
+	})
 	if err != nil {
 		return err
 	}
 
+	// Watch the Events reporting failed nodes
+	if TriggerEventReason != "" {
+		rn := r.(*ReconcileNode)
+		rn.events = newEventTrigger(rn.clientset)
+		if err := mgr.Add(rn.events); err != nil {
+			return err
+		}
+		err = c.Watch(&source.Informer{Informer: rn.events.informer}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(eventNode),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Mark in-flight fencings as interrupted on shutdown
+	marker = newInterruptMarker(mgr.GetClient())
+	if err := mgr.Add(marker); err != nil {
+		return err
+	}
+
+	// Delete expired archived jobs
+	if HistoryRetention > 0 && !JobsDisabled {
+		if err := mgr.Add(&historyCleaner{client: mgr.GetClient()}); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -63,7 +251,29 @@ type ReconcileNode struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
 	client client.Client
-	scheme *runtime.Scheme
+	// clientset is used for the subresources unsupported by client, e.g. pods/eviction
+	clientset kubernetes.Interface
+	scheme    *runtime.Scheme
+	recorder  record.EventRecorder
+	states    *stateTracker
+	// inflight are the nodes being reconciled right now
+	inflight *inflight
+	// spans are the reconcile spans of the nodes being reconciled
+	spans *spanTracker
+	// limiter limits the rate of new fencings, nil if unlimited
+	limiter *rate.Limiter
+	// recoveryLimiter limits the rate of recovery cleanups, nil if unlimited
+	recoveryLimiter *rate.Limiter
+	// events are the Events reporting failed nodes, nil if disabled
+	events *eventTrigger
+	// batch gathers simultaneously failed nodes
+	batch *failureBatch
+	// waiting are the nodes deferred by concurrency limit
+	waiting *waitQueue
+	// safeMode suspends fencing while the control plane seems to be unavailable
+	safeMode *safeMode
+	// fencers are the built-in fencing backends
+	fencers map[string]Fencer
 }
 
 // Reconcile reads that state of the cluster for a Node object and makes changes based on the state read
@@ -71,7 +281,41 @@ type ReconcileNode struct {
 // Note:
 // The Controller will requeue the Request to be processed again if the returned error is non-nil or
 // Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
-func (r *ReconcileNode) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+func (r *ReconcileNode) Reconcile(request reconcile.Request) (result reconcile.Result, err error) {
+	// Record reconciliation duration and errors, runs after panic recovery
+	start := time.Now()
+	defer func() {
+		metrics.ObserveReconcile("node", start, err)
+	}()
+
+	// Don't let a single malformed object to crash the whole controller
+	defer func() {
+		if p := recover(); p != nil {
+			klog.Errorln("Recovered from panic while reconciling node", request.Name, ":", p)
+			metrics.ReconcilePanics.WithLabelValues("node").Inc()
+			result = reconcile.Result{}
+			err = fmt.Errorf("panic while reconciling node %s: %v", request.Name, p)
+		}
+	}()
+
+	// Short-circuit overlapping reconcile of the same node
+	if !r.inflight.acquire(request.Name) {
+		klog.V(1).Infoln("Node", request.Name, "is already being reconciled")
+		return reconcile.Result{RequeueAfter: time.Second}, nil
+	}
+	defer r.inflight.release(request.Name)
+
+	// Trace the reconcile with the decision made for the node
+	r.spans.start(request.Name)
+	defer func() {
+		r.spans.end(request.Name, err)
+	}()
+
+	return r.reconcile(request)
+}
+
+// reconcile contains the Reconcile logic
+func (r *ReconcileNode) reconcile(request reconcile.Request) (reconcile.Result, error) {
 
 	// Fetch the Node instance
 	node := &v1.Node{}
@@ -79,70 +323,257 @@ func (r *ReconcileNode) Reconcile(request reconcile.Request) (reconcile.Result,
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found
+			r.states.set(request.Name, "")
+			r.waiting.leave(request.Name)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
 
-	// Get fencing status of the node
+	// Get fencing status of the node, the metric follows the state patched by this reconcile
 	fencingState := node.Annotations["fencing/state"]
+	defer func() {
+		r.states.set(node.Name, node.Annotations["fencing/state"])
+	}()
+	if fencingState != "started" {
+		r.waiting.leave(node.Name)
+	}
+
+	// Resume fencing interrupted by controller shutdown
+	if _, ok := node.Annotations["fencing/interrupted"]; ok {
+		klog.Infoln("Resuming interrupted fencing of node", node.Name)
+		err = util.PatchNodeAnnotations(context.TODO(), r.client, node, map[string]interface{}{
+			"fencing/interrupted": nil,
+		})
+		if err != nil {
+			klog.Errorln("Failed to patch node", node.Name, ":", err)
+			return reconcile.Result{}, err
+		}
+	}
+
+	// Flush the node before deletion
+	if node.DeletionTimestamp != nil {
+		if !hasFinalizer(node) {
+			return reconcile.Result{}, nil
+		}
+		klog.Infoln("Flushing deleted node", node.Name)
+		if err := util.FlushNode(context.TODO(), r.client, node.Name, 0); err != nil {
+			klog.Errorln("Failed to flush node", node.Name, ":", err)
+			return reconcile.Result{}, err
+		}
+		patch := client.MergeFrom(node.DeepCopy())
+		node.Finalizers = removeFinalizer(node.Finalizers)
+		err = r.client.Patch(context.TODO(), node, patch)
+		if err != nil {
+			klog.Errorln("Failed to remove finalizer from node", node.Name, ":", err)
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, nil
+	}
+
+	// Add finalizer to the fencing enabled nodes
+	if EnableFinalizer && !hasFinalizer(node) && node.Annotations["fencing/observe"] != "true" && r.fencingEnabled(node) {
+		patch := client.MergeFrom(node.DeepCopy())
+		node.Finalizers = append(node.Finalizers, finalizerName)
+		err = r.client.Patch(context.TODO(), node, patch)
+		if err != nil {
+			klog.Errorln("Failed to add finalizer to node", node.Name, ":", err)
+			return reconcile.Result{}, err
+		}
+	}
 
-	// Get node condition
-	_, c := util.GetNodeCondition(&node.Status, v1.NodeReady)
-	if c == nil {
+	// Skip nodes filtered out by name
+	if !nodeNameAllowed(node.Name) {
+		klog.V(1).Infoln("Node", node.Name, "is excluded from fencing")
 		return reconcile.Result{}, nil
 	}
 
+	var healthy, failed bool
+	var healthySince *metav1.Time
+	// triggerRemains is the time until the node lease or heartbeat expires
+	var triggerRemains time.Duration
+	if node.Annotations["fencing/trigger"] == "taint" {
+		// Use unreachable taint set by node lifecycle controller
+		taint := getUnreachableTaint(node)
+		healthy = taint == nil
+		failed = taint != nil
+	} else {
+		// Get condition type
+		conditionType := ConditionType
+		if t, ok := node.Annotations["fencing/condition-type"]; ok && t != "" {
+			conditionType = v1.NodeConditionType(t)
+		}
+
+		// Get node condition
+		// In-flight fencing should progress even if the node lost its conditions
+		_, c := util.GetNodeCondition(&node.Status, conditionType)
+		if c == nil && fencingState != "started" {
+			return reconcile.Result{}, nil
+		}
+		healthy = c != nil && conditionHealthy(c)
+		failed = c == nil || conditionFailed(c)
+		if healthy {
+			healthySince = &c.LastTransitionTime
+		}
+
+		// Kubelet may stop posting the status before the condition is updated
+		if node.Annotations["fencing/trigger"] == "heartbeat" && c != nil && !failed {
+			stale, remain := heartbeatStale(node, c)
+			if stale {
+				healthy, failed, healthySince = false, true, nil
+			}
+			triggerRemains = remain
+		}
+	}
+
+	// Node lease may expire before the condition is updated
+	if node.Annotations["fencing/trigger"] == "lease" && !failed {
+		expired, remain, err := r.leaseExpired(node)
+		if err != nil {
+			klog.Errorln("Failed to get lease of node", node.Name, ":", err)
+			return reconcile.Result{}, err
+		}
+		if expired {
+			healthy, failed, healthySince = false, true, nil
+		}
+		triggerRemains = remain
+	}
+
+	// External monitor reported the node failed after its status changed last time
+	if !failed {
+		if last := r.events.lastEvent(node.Name); !last.IsZero() && last.After(statusSince(node)) {
+			healthy, failed, healthySince = false, true, nil
+		}
+	}
+
+	// Emergency fencing treats any NotReady node as failed
+	if node.Annotations["fencing/emergency"] == "true" && !healthy {
+		failed = true
+	}
+
 	// Node is Ready
-	if c.Status == v1.ConditionTrue {
+	if healthy {
+		r.batch.leave(node.Name)
 		switch fencingState {
-		case "pending", "fenced", "started", "failed":
+		case "pending", "awaiting-approval", "fenced", "started", "failed":
+			// Fenced node is not expected to return, e.g. it was powered off intentionally
+			if fencingState == "fenced" && !r.expectRecovery(node) {
+				klog.V(1).Infoln("Node", node.Name, "is ready, but its recovery is not expected")
+				return reconcile.Result{}, nil
+			}
+			// Ignore brief Ready blips, e.g. during reboot loop
+			if remainTime := r.recoveryStabilityRemains(node, healthySince); remainTime > 0 {
+				klog.Infoln("Node", node.Name, "must be stably ready for", remainTime, "to recover")
+				return reconcile.Result{RequeueAfter: remainTime}, nil
+			}
 			fencingState = "recovered"
 		}
 	}
 
+	// Fence the soft fenced node with the backend if it did not recover in time
+	escalateAfter, escalating := escalationRemains(node)
+	escalating = escalating && fencingState == "fenced"
+	if escalating && escalateAfter <= 0 {
+		return reconcile.Result{}, r.escalate(node)
+	}
+
+	// Confirm the workloads are rescheduled from the fenced node
+	if _, ok := node.Annotations["fencing/reschedule-owners"]; ok && fencingState == "fenced" {
+		result, err := r.checkRescheduled(node)
+		if escalating && (result.RequeueAfter == 0 || escalateAfter < result.RequeueAfter) {
+			result.RequeueAfter = escalateAfter
+		}
+		return result, err
+	}
+
 	// Ignore already fenced nodes
+	if escalating {
+		return reconcile.Result{RequeueAfter: escalateAfter}, nil
+	}
 	if fencingState == "fenced" || fencingState == "failed" {
 		return reconcile.Result{}, nil
 	}
 
-	// We need only nodes with Unknown status
-	if fencingState != "recovered" && c.Reason != "NodeStatusUnknown" {
-		return reconcile.Result{}, nil
+	// We need only nodes with Unknown status, lease and heartbeat are checked again when they expire
+	if fencingState != "recovered" && !failed {
+		return reconcile.Result{RequeueAfter: triggerRemains}, nil
 	}
 
-	// Get fencing template name
-	templateName, ok := node.Annotations["fencing/template"]
-	if !ok {
-		templateName = "fencing"
+	// Find PodTemplate
+	podTemplate, err := r.getPodTemplate(node)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			klog.Errorln("Failed to find podTemplate for node", node.Name, ":", err)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
 	}
 
-	// Find PodTemplate
-	podTemplate := &v1.PodTemplate{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: templateName, Namespace: Namespace}, podTemplate)
-	if err != nil && errors.IsNotFound(err) {
-		klog.Errorln("Failed to find podTemplate", templateName, ":", err)
-		return reconcile.Result{}, nil
+	// Recovered node must not evict its pods anymore
+	if fencingState == "recovered" && util.HasOutOfServiceTaint(node) {
+		klog.Infoln("Removing out-of-service taint from node", node.Name)
+		if err := util.RemoveOutOfServiceTaint(context.TODO(), r.client, node); err != nil {
+			klog.Errorln("Failed to untaint node", node.Name, ":", err)
+			return reconcile.Result{}, err
+		}
 	}
 
-	// Define a new Job object
-	job := newJobForNode(node, podTemplate)
+	// Let the backend abort the fencing interrupted by the recovery
+	if fencingState == "recovered" && node.Annotations["fencing/state"] == "started" {
+		backend, _ := getAnnotation(node, podTemplate, "fencing/backend")
+		if fencer, ok := r.getFencer(backend); ok {
+			if err := fencer.Cancel(context.TODO(), node); err != nil {
+				klog.Errorln("Failed to cancel fencing of node", node.Name, ":", err)
+				return reconcile.Result{}, err
+			}
+		}
+	}
+
+	if fencingState == "recovered" && manualRecovery(node, podTemplate) {
+		// Leave the cleanup to operator
+		if node.Annotations["fencing/state"] == "recovered" {
+			return reconcile.Result{}, nil
+		}
+		err = util.PatchNodeAnnotations(context.TODO(), r.client, node, map[string]interface{}{
+			"fencing/state": "recovered",
+		})
+		if err != nil {
+			klog.Errorln("Failed to patch node", node.Name, ":", err)
+			return reconcile.Result{}, err
+		}
+		recordRecovery(node, podTemplate)
+		klog.Infoln("Node", node.Name, "recovered, waiting for manual cleanup")
+		r.audit(node, podTemplate, "recovered", "manual cleanup")
+		r.recorder.Event(node, v1.EventTypeNormal, "NodeRecovered", "Node recovered, fencing annotations and jobs are left for manual cleanup")
+		return reconcile.Result{}, nil
+	}
 
 	if fencingState == "recovered" {
 		recovered := false
 
+		// Spread cleanups of the nodes recovered at once, e.g. on the whole rack power on
+		if delay := r.reserveRecovery(); delay > 0 {
+			klog.V(1).Infoln("Cleanup of recovered node", node.Name, "is deferred by rate limit for", delay)
+			metrics.RecoveryDeferred.Inc()
+			return reconcile.Result{RequeueAfter: delay}, nil
+		}
+
 		// Node recovered
 		klog.Infoln("Node", node.Name, "return online")
 
+		// Powered off node is not expected to return
+		if node.Annotations["fencing/state"] == "fenced" && fencingAction(node, podTemplate) == "off" {
+			r.recorder.Event(node, v1.EventTypeWarning, "UnexpectedRecovery", "Node returned online after it was powered off by fencing")
+		}
+
 		// Check if fencing job is exists
-		found := &batchv1.Job{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
-		if err != nil && !errors.IsNotFound(err) {
+		found, err := r.findJob(node)
+		if err != nil {
 			return reconcile.Result{}, err
 		}
 
-		if err != nil {
+		if found == nil {
 			// Fencing job is not found
 			recovered = true
 		} else {
@@ -151,20 +582,28 @@ func (r *ReconcileNode) Reconcile(request reconcile.Request) (reconcile.Result,
 			// Check is job finished
 			_, jc := util.GetJobCondition(&found.Status, batchv1.JobComplete)
 			_, jf := util.GetJobCondition(&found.Status, batchv1.JobFailed)
-			if jc == nil && jf == nil {
+			if jc == nil && jf == nil && !jobStaged(found) {
 				// Job is still running - don't requeue
-				klog.Infoln("Job", job.Name, "is still running")
+				klog.Infoln("Job", found.Name, "is still running")
 				return reconcile.Result{}, nil
 			}
 
-			// Old job finished already - remove it
-			klog.Infoln("Deleting fencing job", job.Name)
-			err = r.client.Delete(context.TODO(), found,
-				client.GracePeriodSeconds(0),
-				client.PropagationPolicy(metav1.DeletePropagationBackground),
-			)
-			if err != nil {
-				klog.Errorln("Failed to delete job", job.Name, ":", err)
+			if jf != nil && keepFailedJobs(node, podTemplate) {
+				// Old job failed - retain it for debugging
+				err = r.retainJob(node, found)
+			} else if cleanupPolicy(node, podTemplate) != "on-recovery" {
+				// Keep the job for audit or TTL controller, but don't consider it as active anymore
+				klog.Infoln("Keeping fencing job", found.Name)
+				err = r.archiveJob(found, "recovered")
+			} else {
+				// Old job finished already - remove it
+				klog.Infoln("Deleting fencing job", found.Name)
+				err = r.deleteJob(context.TODO(), node.Name, found)
+			}
+			if err != nil && !errors.IsNotFound(err) {
+				// Keep the state, so the cleanup is retried
+				klog.Errorln("Failed to cleanup job", found.Name, ":", err)
+				metrics.CleanupErrors.Inc()
 				return reconcile.Result{}, err
 			}
 			recovered = true
@@ -172,43 +611,86 @@ func (r *ReconcileNode) Reconcile(request reconcile.Request) (reconcile.Result,
 
 		if recovered {
 			//  remove fencing/state annotation
-			mergePatch, _ := json.Marshal(map[string]interface{}{
-				"metadata": map[string]interface{}{
-					"annotations": map[string]interface{}{
-						"fencing/state":     nil,
-						"fencing/timestamp": nil,
-					},
-				},
-			})
-			err = r.client.Patch(context.TODO(), node, client.RawPatch(types.MergePatchType, mergePatch))
+			annotations := clearedStateAnnotations()
+			annotations["fencing/recovered-at"] = strconv.FormatInt(time.Now().Unix(), 10)
+			// Recovery duration is counted from fencing/started-at removed by the patch
+			fenced := node.DeepCopy()
+			err = util.PatchNodeAnnotations(context.TODO(), r.client, node, annotations)
 			if err != nil {
 				klog.Errorln("Failed to patch node", node.Name, ":", err)
+				metrics.CleanupErrors.Inc()
+				return reconcile.Result{}, err
 			}
 			klog.Infoln("Node", node.Name, "recovered")
+			r.audit(node, podTemplate, "recovered", "")
+			r.recorder.Event(node, v1.EventTypeNormal, "NodeRecovered", "Node recovered")
+			recordRecovery(fenced, podTemplate)
+		}
+		return reconcile.Result{}, nil
+	}
+
+	// Handle only nodes with fencing/enabled=true annotation on node or podTemplate.
+	// This is the only way to the branches starting fencing and running the backends,
+	// so manually set fencing/state does not start fencing of the node which is not enabled.
+	if v, _ := getAnnotation(node, podTemplate, "fencing/enabled"); v != "true" {
+		if fencingState != "" {
+			klog.Infoln("Ignoring fencing state", fencingState, "of node", node.Name, ": fencing is not enabled")
 		}
 		return reconcile.Result{}, nil
 	}
 
-	// Handle only nodes with fencing/enabled=true annotation
-	if node.Annotations["fencing/enabled"] != "true" {
+	// Only report what would be done for the node on trial
+	if v, _ := getAnnotation(node, podTemplate, "fencing/observe"); v == "true" {
+		r.observe(node, podTemplate)
 		return reconcile.Result{}, nil
 	}
 
+	// Suspend fencing while control plane seems to be unavailable
+	safe, err := r.inSafeMode(context.TODO())
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if safe {
+		r.audit(node, podTemplate, "suspended", "safe mode")
+		r.recorder.Event(node, v1.EventTypeWarning, "FencingSuspended", "Fencing is suspended by safe mode, too many nodes have unknown status")
+		return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	// Give up the fencing taking too long
+	if remain, ok := deadlineRemains(node, podTemplate); ok && remain <= 0 {
+		r.audit(node, podTemplate, "failed", "overall deadline exceeded")
+		return reconcile.Result{}, r.failOnDeadline(node)
+	}
+
 	// ======================================
 	// Fencing procedure is not started yet
 	// ======================================
 
 	if fencingState != "started" {
 
-		// Get timeout period from annotation
-		timeoutStr, ok := node.Annotations["fencing/timeout"]
-		if !ok {
-			timeoutStr, ok = podTemplate.Annotations["fencing/timeout"]
-			if !ok {
-				timeoutStr = "0"
+		// Don't fence the node which may be still initializing, e.g. recreated after deletion
+		if remainTime := time.Until(node.CreationTimestamp.Add(MinNodeAge)); MinNodeAge > 0 && remainTime > 0 {
+			klog.Infoln("Node", node.Name, "is created recently, min-node-age remains", remainTime)
+			return reconcile.Result{RequeueAfter: remainTime}, nil
+		}
+
+		// Don't fence flapping node during cooldown period after recovery
+		if cooldownStr, ok := getAnnotation(node, podTemplate, "fencing/cooldown"); ok && fencingState == "" {
+			cooldown, err := util.ParseDuration(cooldownStr)
+			if err != nil {
+				klog.Errorln("Failed to parse cooldown string", cooldownStr, ":", err)
+				return reconcile.Result{}, nil
+			}
+			recoveredAt, _ := strconv.ParseInt(node.Annotations["fencing/recovered-at"], 10, 64)
+			if remainTime := time.Until(time.Unix(recoveredAt, 0).Add(cooldown)); recoveredAt > 0 && remainTime > 0 {
+				klog.Infoln("Node", node.Name, "recovered recently, cooldown remains", remainTime)
+				return reconcile.Result{RequeueAfter: remainTime}, nil
 			}
 		}
-		timeout, err := strconv.Atoi(timeoutStr)
+
+		// Get timeout period from annotation
+		timeoutStr := timeoutOption(node, podTemplate)
+		timeout, err := util.ParseDuration(timeoutStr)
 		if err != nil {
 			klog.Errorln("Failed to parse timeout string", timeoutStr, ":", err)
 			return reconcile.Result{}, nil
@@ -225,56 +707,117 @@ func (r *ReconcileNode) Reconcile(request reconcile.Request) (reconcile.Result,
 				fencingTimestamp = time.Now().Unix()
 				fencingTimestampStr := strconv.FormatInt(fencingTimestamp, 10)
 
-				mergePatch, _ := json.Marshal(map[string]interface{}{
-					"metadata": map[string]interface{}{
-						"annotations": map[string]interface{}{
-							"fencing/state":     "pending",
-							"fencing/timestamp": fencingTimestampStr,
-						},
-					},
+				err = util.PatchNodeAnnotations(context.TODO(), r.client, node, map[string]interface{}{
+					"fencing/state":           "pending",
+					"fencing/timestamp":       fencingTimestampStr,
+					"fencing/first-timestamp": fencingTimestampStr,
 				})
-
-				err = r.client.Patch(context.TODO(), node, client.RawPatch(types.MergePatchType, mergePatch))
 				if err != nil {
 					klog.Errorln("Failed to patch node", node.Name, ":", err)
 					return reconcile.Result{}, err
 				}
+				r.audit(node, podTemplate, "pending", "timeout "+timeout.String())
 			}
 
 			// Check remainTime
-			remainTime := int64(timeout) - (time.Now().Unix() - fencingTimestamp)
-			if remainTime > 0 {
-				go func() {
-					klog.Infoln("Waiting", remainTime, "seconds, if", node.Name, "comes back online")
-					time.Sleep(time.Duration(remainTime) * time.Second)
-					// remove annotation after timeout expired
-					mergePatch, _ := json.Marshal(map[string]interface{}{
-						"metadata": map[string]interface{}{
-							"annotations": map[string]interface{}{
-								"fencing/timestamp": nil,
-							},
-						},
-					})
-					_ = r.client.Patch(context.TODO(), node, client.RawPatch(types.MergePatchType, mergePatch))
-				}()
+			if remainTime := nextReconcileAfter(node, podTemplate, time.Now()); remainTime > 0 {
+				// Requeue when timeout expired to advance the node to started state
+				klog.Infoln("Waiting", remainTime, "if", node.Name, "comes back online")
+				return reconcile.Result{RequeueAfter: remainTime}, nil
+			}
+		}
+
+		// Wait until the burst of correlated failures is over, then check the quorum for the whole batch
+		if BatchWindow > 0 {
+			if remainTime := r.batch.join(node.Name, time.Now()); remainTime > 0 {
+				klog.Infoln("Gathering failed nodes for", remainTime, "before fencing", node.Name)
+				return reconcile.Result{RequeueAfter: remainTime}, nil
+			}
+			if MinHealthyNodes > 0 {
+				admitted, err := r.batch.evaluate(func(size int) (bool, error) {
+					ready, err := r.countReadyNodes(context.TODO())
+					// Healthy nodes must also outnumber the batch, otherwise the controller
+					// may be on the minority side of a network partition
+					return ready >= MinHealthyNodes && ready > size, err
+				})
+				if err != nil {
+					return reconcile.Result{}, err
+				}
+				if !admitted {
+					klog.Infoln("Fencing", node.Name, "is deferred by quorum limit")
+					r.recorder.Event(node, v1.EventTypeWarning, "FencingThrottled", "Fencing is deferred by quorum limit")
+					metrics.Throttled.WithLabelValues("quorum").Inc()
+					return reconcile.Result{RequeueAfter: batchRecheckInterval}, nil
+				}
+			}
+		}
+
+		// Ask external health checker if the node is really dead
+		// The checker is never taken from the node, so the node can not prevent its fencing
+		if u := podTemplate.Annotations["fencing/health-check-url"]; u != "" {
+			dead, err := checkNodeDead(context.TODO(), node, u)
+			if err != nil {
+				klog.Errorln("Failed to check health of node", node.Name, ":", err)
+				return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+			}
+			if !dead {
+				klog.Infoln("Health checker reports node", node.Name, "alive, fencing is deferred")
+				r.audit(node, podTemplate, "deferred", "health checker reports node alive")
+				return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+			}
+		}
 
+		// Fencing the node without workloads has no impact
+		if v, _ := getAnnotation(node, podTemplate, "fencing/skip-if-empty"); v == "true" {
+			count, err := util.CountWorkloadPods(r.clientset, node.Name)
+			if err != nil {
+				klog.Errorln("Failed to list pods on node", node.Name, ":", err)
+				return reconcile.Result{}, err
+			}
+			if count == 0 {
+				klog.Infoln("Node", node.Name, "has no workload pods, skipping fencing: no impact")
+				r.audit(node, podTemplate, "skipped", "no impact")
+				return reconcile.Result{RequeueAfter: time.Minute}, nil
+			}
+		}
+
+		// Wait for operator approval
+		if v, _ := getAnnotation(node, podTemplate, "fencing/require-approval"); v == "true" && node.Annotations["fencing/approved"] != "true" {
+			if fencingState == "awaiting-approval" {
 				return reconcile.Result{}, nil
 			}
+			err = util.PatchNodeAnnotations(context.TODO(), r.client, node, map[string]interface{}{
+				"fencing/state": "awaiting-approval",
+			})
+			if err != nil {
+				klog.Errorln("Failed to patch node", node.Name, ":", err)
+				return reconcile.Result{}, err
+			}
+			klog.Infoln("Fencing", node.Name, "is awaiting approval")
+			r.audit(node, podTemplate, "awaiting-approval", "")
+			r.recorder.Event(node, v1.EventTypeWarning, "FencingAwaitingApproval", "Fencing is awaiting approval, set fencing/approved=true annotation to proceed")
+			return reconcile.Result{}, nil
 		}
 
-		mergePatch, _ := json.Marshal(map[string]interface{}{
-			"metadata": map[string]interface{}{
-				"annotations": map[string]interface{}{
-					"fencing/state":     "started",
-					"fencing/timestamp": nil,
-				},
-			},
-		})
-		err = r.client.Patch(context.TODO(), node, client.RawPatch(types.MergePatchType, mergePatch))
+		// New fencing starts from the first attempt, approval is consumed
+		startAnnotations := map[string]interface{}{
+			"fencing/state":        "started",
+			"fencing/started-at":   strconv.FormatInt(time.Now().Unix(), 10),
+			"fencing/timestamp":    nil,
+			"fencing/attempts":     nil,
+			"fencing/last-attempt": nil,
+			"fencing/approved":     nil,
+		}
+		if _, ok := node.Annotations["fencing/first-timestamp"]; !ok {
+			startAnnotations["fencing/first-timestamp"] = startAnnotations["fencing/started-at"]
+		}
+		err = util.PatchNodeAnnotations(context.TODO(), r.client, node, startAnnotations)
 		if err != nil {
 			klog.Errorln("Failed to patch node", node.Name, ":", err)
 			return reconcile.Result{}, err
 		}
+		r.audit(node, podTemplate, "start", fencingAction(node, podTemplate))
+		r.batch.leave(node.Name)
 		return reconcile.Result{}, nil
 	}
 
@@ -282,56 +825,444 @@ func (r *ReconcileNode) Reconcile(request reconcile.Request) (reconcile.Result,
 	// Fencing procedure started
 	// ======================================
 
-	// Check if this Job already exists
-	found := &batchv1.Job{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
-	if err != nil && !errors.IsNotFound(err) {
-		return reconcile.Result{}, err
+	// Backend already fenced the node, waiting if it rejoins
+	if _, ok := node.Annotations["fencing/fenced-at"]; ok {
+		return r.completeFencing(node, podTemplate, false)
 	}
 
-	if err != nil {
-		// Previus job is not found
-		klog.Infoln("Starting fencing", node.Name)
-	} else {
-		// Previus job is found
-		klog.Infoln("Continue fencing", node.Name)
-
-		// Check is job finished
-		_, jf := util.GetJobCondition(&found.Status, batchv1.JobFailed)
-		if jf != nil {
-			// Job is still running - don't requeue
-			klog.Infoln("Job", job.Name, "failed")
+	// Soft fencing does not need any power action, it is tried first on escalation
+	soft := softFirst(node, podTemplate)
+	mode, _ := getAnnotation(node, podTemplate, "fencing/mode")
+
+	// Fence the node using the configured backend
+	var fencer Fencer
+	inProgress := false
+	backend, _ := getAnnotation(node, podTemplate, "fencing/backend")
+	if !soft && mode != "soft" {
+		var ok bool
+		fencer, ok = r.getFencer(backend)
+		if !ok {
+			klog.Errorln("Unknown fencing backend", backend, "for node", node.Name)
 			return reconcile.Result{}, nil
 		}
-		_, jc := util.GetJobCondition(&found.Status, batchv1.JobComplete)
-		if jc != nil {
-			// Job is still running - don't requeue
-			klog.Infoln("Job", job.Name, "is still running")
-			return reconcile.Result{}, nil
+		inProgress, err = attemptInProgress(context.TODO(), fencer, node)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// Safety limits apply to every backend, the attempt in progress is not deferred
+	if !inProgress {
+		if result, deferred, err := r.deferFencing(context.TODO(), node, podTemplate); deferred {
+			return result, err
+		}
+	}
+
+	if fencer == nil {
+		return r.completeFencing(node, podTemplate, soft)
+	}
+	result, err := fencer.Fence(context.TODO(), node)
+	if result.Started {
+		r.spans.setAction(node.Name, "fence")
+
+		// Count the attempt for the backoff
+		annotations := attemptAnnotations(node)
+		if err != nil {
+			annotations["fencing/last-error"] = err.Error()
 		}
+		if err := util.PatchNodeAnnotations(context.TODO(), r.client, node, annotations); err != nil {
+			klog.Errorln("Failed to patch node", node.Name, ":", err)
+			return reconcile.Result{}, err
+		}
+	}
+	if err != nil {
+		// Give up when the attempts are exhausted
+		if attemptsExhausted(node, podTemplate, backend) {
+			return reconcile.Result{}, r.failAttempts(node, podTemplate, err.Error())
+		}
+		// Retry the failed attempt after the backoff, if it is specified
+		if delay := nextReconcileAfter(node, podTemplate, time.Now()); delay > 0 {
+			klog.Errorln("Failed to fence node", node.Name, ", next attempt is in", delay, ":", err)
+			return reconcile.Result{RequeueAfter: delay}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if !result.Fenced {
+		// Recheck the overall deadline even if the backend waits for events
+		if remain, ok := deadlineRemains(node, podTemplate); ok && (result.RequeueAfter == 0 || remain < result.RequeueAfter) {
+			result.RequeueAfter = remain
+		}
+		return reconcile.Result{RequeueAfter: result.RequeueAfter}, nil
+	}
+
+	// Backend fenced the node synchronously
+	return r.completeFencing(node, podTemplate, false)
+}
+
+// getPodTemplate returns the PodTemplate used to fence the node,
+// namespaces are searched in order and the first found PodTemplate is returned.
+// Its annotations are overlaid with the options from the ConfigMap referenced by fencing/config-ref.
+func (r *ReconcileNode) getPodTemplate(node *v1.Node) (*v1.PodTemplate, error) {
+	config := r.nodeConfig(node)
+	var err error
+	for _, namespace := range templateNamespaces(node) {
+		var podTemplate *v1.PodTemplate
+		podTemplate, err = r.getPodTemplateInNamespace(node, namespace, config)
+		if err == nil {
+			layerConfig(podTemplate, config)
+		}
+		if err == nil || !errors.IsNotFound(err) {
+			return podTemplate, err
+		}
+	}
+	return nil, err
+}
+
+// getPodTemplateInNamespace returns the PodTemplate used to fence the node from the namespace
+func (r *ReconcileNode) getPodTemplateInNamespace(node *v1.Node, namespace string, config map[string]string) (*v1.PodTemplate, error) {
+
+	// Get fencing template name
+	templateName, ok := node.Annotations["fencing/template"]
+	if !ok {
+		templateName, ok = config["fencing/template"]
+	}
+	if !ok {
+		var err error
+		templateName, err = r.selectTemplate(node, namespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if templateName == "" {
+		templateName = "fencing"
+	}
+
+	podTemplate := &v1.PodTemplate{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: templateName, Namespace: namespace}, podTemplate)
+	return podTemplate, err
+}
+
+// templateNamespaces returns the namespaces searched for the PodTemplate of the node
+func templateNamespaces(node *v1.Node) []string {
+	namespaces := append([]string{Namespace}, TemplateNamespaces...)
+	// Other namespaces are watched only if multiple namespaces are used,
+	// the node can not make the controller use any namespace outside of them
+	if namespace, ok := node.Annotations["fencing/namespace"]; ok && namespace != "" && len(TemplateNamespaces) > 0 {
+		for _, n := range namespaces {
+			if n == namespace {
+				return []string{namespace}
+			}
+		}
+		klog.Errorln("Ignoring fencing/namespace", namespace, "of node", node.Name, ": it is not one of the template namespaces")
+	}
+	return namespaces
+}
 
-		// Old job finished already - remove it
-		klog.Infoln("Deleting previous job", job.Name)
-		err = r.client.Delete(context.TODO(), found,
-			client.GracePeriodSeconds(0),
-			client.PropagationPolicy(metav1.DeletePropagationBackground),
-		)
+// jobNamespace returns the namespace to list fencing jobs in, all namespaces if multiple namespaces are used
+func jobNamespace() string {
+	if len(TemplateNamespaces) > 0 {
+		return v1.NamespaceAll
+	}
+	return Namespace
+}
+
+// completeFencing cleans up the node fenced by the backend and declares it fenced,
+// soft cleans up the node in soft mode and schedules the escalation to the backend
+func (r *ReconcileNode) completeFencing(node *v1.Node, podTemplate *v1.PodTemplate, soft bool) (reconcile.Result, error) {
+	// Give the restarted node a chance to rejoin before declaring it fenced
+	if v, ok := getAnnotation(node, podTemplate, "fencing/post-fence-wait"); ok && !soft {
+		wait, err := util.ParseDuration(v)
+		if err != nil {
+			klog.Errorln("Failed to parse post-fence-wait string", v, ":", err)
+		}
+		remainTime, err := util.PostFenceWait(context.TODO(), r.client, node, wait)
 		if err != nil {
-			klog.Errorln("Failed to delete job", job.Name, ":", err)
+			klog.Errorln("Failed to patch node", node.Name, ":", err)
 			return reconcile.Result{}, err
 		}
+		if remainTime > 0 {
+			klog.Infoln("Waiting", remainTime, "if", node.Name, "rejoins after fencing")
+			return reconcile.Result{RequeueAfter: remainTime}, nil
+		}
+	}
+
+	// Collect cleanup options
+	annotations := map[string]string{
+		"fencing/mode": "flush",
+	}
+	for _, k := range []string{"fencing/mode", "fencing/drain", "fencing/drain-timeout", "fencing/soft-detach-volumes", "fencing/pod-grace-period", "fencing/reschedule-timeout", "fencing/out-of-service"} {
+		if v, ok := getAnnotation(node, podTemplate, k); ok {
+			annotations[k] = v
+		}
+	}
+	if soft {
+		annotations["fencing/mode"] = "soft"
+	}
+
+	// Remember the workloads to confirm their rescheduling
+	fencedAnnotations, err := util.RescheduleAnnotations(r.clientset, node.Name, annotations)
+	if err != nil {
+		klog.Errorln("Failed to list workloads of node", node.Name, ":", err)
+	}
+	if fencedAnnotations == nil {
+		fencedAnnotations = map[string]interface{}{}
 	}
 
-	klog.Infoln("Creating a new job", job.Name)
-	err = r.client.Create(context.TODO(), job)
+	requeueAfter, err := util.CleanupNode(context.TODO(), r.client, r.clientset, node, annotations)
 	if err != nil {
-		klog.Errorln("Failed to create new job", job.Name, ":", err)
+		klog.Errorln("Failed to cleanup node", node.Name, ":", err)
 		return reconcile.Result{}, err
 	}
+	if requeueAfter > 0 {
+		return reconcile.Result{RequeueAfter: requeueAfter}, nil
+	}
+	klog.Infoln("Succesful fencing node", node.Name)
+	r.audit(node, podTemplate, "fenced", "")
+	if annotations["fencing/mode"] == "delete" {
+		return reconcile.Result{}, nil
+	}
+
+	// Setting fencing status annotation
+	fencedAnnotations["fencing/state"] = "fenced"
+	fencedAnnotations["fencing/timestamp"] = nil
+	fencedAnnotations["fencing/fenced-at"] = nil
+	fencedAnnotations["fencing/last-error"] = nil
+	var escalateAfter time.Duration
+	if soft {
+		escalateAfter = escalationTimeout(node, podTemplate)
+		fencedAnnotations["fencing/escalation-deadline"] = strconv.FormatInt(time.Now().Add(escalateAfter).Unix(), 10)
+	}
+	err = util.PatchNodeAnnotations(context.TODO(), r.client, node, fencedAnnotations)
+	if err != nil {
+		klog.Errorln("Failed to patch node", node.Name, ":", err)
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: escalateAfter}, nil
+}
+
+// observe logs and reports the fencing which would be done for the node without acting
+func (r *ReconcileNode) observe(node *v1.Node, podTemplate *v1.PodTemplate) {
+	backend, _ := getAnnotation(node, podTemplate, "fencing/backend")
+	if backend == "" {
+		backend = "job"
+	}
+	mode, _ := getAnnotation(node, podTemplate, "fencing/mode")
+	if mode == "" {
+		mode = "flush"
+	}
+	timeout := timeoutOption(node, podTemplate)
+	message := fmt.Sprintf("Node would be fenced by %s backend with %s action and %s cleanup after timeout %s",
+		backend, fencingAction(node, podTemplate), mode, timeout)
+	klog.Infoln("Observing node", node.Name, ":", message)
+	r.recorder.Event(node, v1.EventTypeNormal, "FencingObserved", message)
+	r.audit(node, podTemplate, "observed", message)
+}
+
+// audit records the fencing decision made for the node
+func (r *ReconcileNode) audit(node *v1.Node, podTemplate *v1.PodTemplate, decision, reason string) {
+	annotations := map[string]string{}
+	for k, v := range podTemplate.Annotations {
+		annotations[k] = v
+	}
+	for k, v := range node.Annotations {
+		annotations[k] = v
+	}
+	audit.Emit(node, annotations, decision, reason)
+	r.spans.setAction(node.Name, decision)
+}
+
+// findJob returns the active fencing job for the node, or nil if there is no one
+func (r *ReconcileNode) findJob(node *v1.Node) (*batchv1.Job, error) {
+	// There are no jobs without batch/v1 API
+	if JobsDisabled {
+		return nil, nil
+	}
+	jobs := &batchv1.JobList{}
+	err := r.client.List(context.TODO(), jobs,
+		client.InNamespace(jobNamespace()),
+		client.MatchingLabels{"fencing": "fence"},
+		client.MatchingFields{jobNodeIndex: node.Name},
+	)
+	if err != nil {
+		return nil, err
+	}
+	var found *batchv1.Job
+	for i := range jobs.Items {
+		if found == nil || found.CreationTimestamp.Before(&jobs.Items[i].CreationTimestamp) {
+			found = &jobs.Items[i]
+		}
+	}
+	return found, nil
+}
+
+// jobStaged reports if the fencing job was created with fencing/stage=true and is not resumed yet
+func jobStaged(job *batchv1.Job) bool {
+	_, ok := job.Annotations["fencing/staged-parallelism"]
+	return ok && job.Spec.Parallelism != nil && *job.Spec.Parallelism == 0 && job.Status.Active == 0
+}
+
+// retainJob marks the failed job as retained, so it will not be considered as active anymore,
+// and removes the oldest retained jobs for the node over KeepFailedJobsLimit
+func (r *ReconcileNode) retainJob(node *v1.Node, job *batchv1.Job) error {
+	klog.Infoln("Retaining failed job", job.Name)
+	err := r.archiveJob(job, "retained")
+	if err != nil {
+		return err
+	}
+
+	// Remove the oldest retained jobs
+	jobs := &batchv1.JobList{}
+	err = r.client.List(context.TODO(), jobs,
+		client.InNamespace(jobNamespace()),
+		client.MatchingLabels{"fencing": "retained"},
+		client.MatchingFields{jobNodeIndex: node.Name},
+	)
+	if err != nil {
+		return err
+	}
+	retained := jobs.Items
+	if !containsJob(retained, job.Name) {
+		// The cache is not updated yet
+		retained = append(retained, *job)
+	}
+	sort.Slice(retained, func(i, j int) bool {
+		return retained[i].CreationTimestamp.Before(&retained[j].CreationTimestamp)
+	})
+	for len(retained) > KeepFailedJobsLimit {
+		klog.Infoln("Deleting retained job", retained[0].Name)
+		err = r.deleteJob(context.TODO(), node.Name, &retained[0])
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		retained = retained[1:]
+	}
+	return nil
+}
+
+// archiveJob replaces fencing label of the job, so it will not be considered as active anymore
+func (r *ReconcileNode) archiveJob(job *batchv1.Job, label string) error {
+	mergePatch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{
+				"fencing": label,
+			},
+			"annotations": map[string]interface{}{
+				"fencing/" + label + "-at": strconv.FormatInt(time.Now().Unix(), 10),
+			},
+		},
+	})
+	return r.client.Patch(context.TODO(), job, client.RawPatch(types.MergePatchType, mergePatch))
+}
+
+// containsJob returns true if the list contains the job with specified name
+func containsJob(jobs []batchv1.Job, name string) bool {
+	for _, j := range jobs {
+		if j.Name == name {
+			return true
+		}
+	}
+	return false
+}
 
-	// Job created successfully - don't requeue
-	return reconcile.Result{}, nil
+// defaultCleanupTTL is the default time finished fencing job is kept with fencing/cleanup-policy=ttl
+const defaultCleanupTTL = time.Hour
 
+// keepFailedJobs returns true if failed jobs should be retained for debugging
+func keepFailedJobs(node *v1.Node, podTemplate *v1.PodTemplate) bool {
+	v, _ := getAnnotation(node, podTemplate, "fencing/keep-failed-jobs")
+	return v == "true"
+}
+
+// cleanupPolicy returns fencing/cleanup-policy of finished fencing jobs: on-recovery, ttl or keep,
+// deprecated fencing/delete-job-on-recovery=false means keep
+func cleanupPolicy(node *v1.Node, podTemplate *v1.PodTemplate) string {
+	if v, ok := getAnnotation(node, podTemplate, "fencing/cleanup-policy"); ok && v != "" {
+		return v
+	}
+	if v, _ := getAnnotation(node, podTemplate, "fencing/delete-job-on-recovery"); v == "false" {
+		return "keep"
+	}
+	return "on-recovery"
+}
+
+// hasFinalizer returns true if the node has fencing finalizer
+func hasFinalizer(node *v1.Node) bool {
+	for _, f := range node.Finalizers {
+		if f == finalizerName {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFinalizer returns finalizers list without fencing finalizer
+func removeFinalizer(finalizers []string) []string {
+	var res []string
+	for _, f := range finalizers {
+		if f != finalizerName {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// nodeNameAllowed returns true if the node name passes IncludeNodes and ExcludeNodes patterns
+func nodeNameAllowed(name string) bool {
+	for _, re := range ExcludeNodes {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	if len(IncludeNodes) == 0 {
+		return true
+	}
+	for _, re := range IncludeNodes {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionHealthy returns true if the condition reports the node as healthy.
+// NodeReady is healthy when True, any other condition is healthy when False.
+func conditionHealthy(c *v1.NodeCondition) bool {
+	if c.Type == v1.NodeReady {
+		return c.Status == v1.ConditionTrue
+	}
+	return c.Status == v1.ConditionFalse
+}
+
+// conditionFailed returns true if the condition reports the node as failed.
+// NodeReady is failed when kubelet stopped posting the status, any other condition is failed when True.
+// Soft fenced node keeps the NodeFenced reason until kubelet posts the status, so it is failed on escalation.
+func conditionFailed(c *v1.NodeCondition) bool {
+	if c.Type == v1.NodeReady {
+		return c.Reason == "NodeStatusUnknown" || (c.Status == v1.ConditionUnknown && c.Reason == "NodeFenced")
+	}
+	return c.Status == v1.ConditionTrue
+}
+
+// taintNodeUnreachable is the taint added by node lifecycle controller to unreachable nodes
+const taintNodeUnreachable = "node.kubernetes.io/unreachable"
+
+// getUnreachableTaint returns the NoExecute unreachable taint of the node or nil
+func getUnreachableTaint(node *v1.Node) *v1.Taint {
+	for i := range node.Spec.Taints {
+		t := &node.Spec.Taints[i]
+		if t.Key == taintNodeUnreachable && t.Effect == v1.TaintEffectNoExecute {
+			return t
+		}
+	}
+	return nil
+}
+
+// BuildFencingJob validates the podTemplate and returns a Job to fence the node
+func BuildFencingJob(node *v1.Node, podTemplate *v1.PodTemplate) (*batchv1.Job, error) {
+	if err := ValidateOptions(node, podTemplate); err != nil {
+		return nil, err
+	}
+	return newJobForNode(node, podTemplate), nil
 }
 
 // newJobForNode returns a Job to fence the node
@@ -340,11 +1271,15 @@ func newJobForNode(node *v1.Node, podTemplate *v1.PodTemplate) *batchv1.Job {
 		"node":    node.Name,
 		"fencing": "fence",
 	}
+	// Jobs are counted per template for fencing/max-concurrent
+	if len(podTemplate.Name) <= validation.LabelValueMaxLength {
+		labels["fencing/template"] = podTemplate.Name
+	}
 	// Default annotations
 	annotations := map[string]string{
 		"fencing/mode":     "flush",
 		"fencing/template": "fencing",
-		"fencing/timeout":  "0",
+		"fencing/timeout":  timeoutOption(node, podTemplate),
 	}
 
 	// Override default annotations with podTemplate annotations
@@ -358,7 +1293,7 @@ func newJobForNode(node *v1.Node, podTemplate *v1.PodTemplate) *batchv1.Job {
 	}
 
 	// Create new pod from podTemplate
-	pod := podTemplate.Template
+	pod := *podTemplate.Template.DeepCopy()
 
 	// Append pod annotations with podTemplate.Template annotations
 	if pod.Annotations != nil {
@@ -376,6 +1311,14 @@ func newJobForNode(node *v1.Node, podTemplate *v1.PodTemplate) *batchv1.Job {
 	} else {
 		annotations["fencing/id"] = node.Name
 	}
+	if address := resolveAddress(node, podTemplate, "fencing/address"); address != "" {
+		annotations["fencing/address"] = address
+	}
+	for _, k := range propagatedAnnotations {
+		if v, ok := getAnnotation(node, podTemplate, k); ok {
+			annotations[k] = v
+		}
+	}
 	if afterHook, ok := node.Annotations["fencing/after-hook"]; ok {
 		annotations["fencing/after-hook"] = afterHook
 	}
@@ -383,21 +1326,97 @@ func newJobForNode(node *v1.Node, podTemplate *v1.PodTemplate) *batchv1.Job {
 		annotations["fencing/after-hook"] = afterHook
 	}
 
+	// Append controller-wide labels and annotations, node and podTemplate ones take precedence
+	for k, v := range JobAnnotations {
+		if _, ok := annotations[k]; !ok {
+			annotations[k] = v
+		}
+	}
+	for k, v := range JobLabels {
+		if _, ok := labels[k]; !ok {
+			labels[k] = v
+		}
+	}
+
 	// Apply annotations to the pod
 	pod.ObjectMeta.Annotations = annotations
 
+	// Pass fencing action to the containers
+	action := fencingAction(node, podTemplate)
+	annotations["fencing/action"] = action
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].Env = append(pod.Spec.Containers[i].Env, v1.EnvVar{Name: "FENCING_ACTION", Value: action})
+	}
+
+	// Override restart policy and add image pull secrets, the same way as for the confirm and after-hook jobs
+	util.SetJobPodSpec(&pod.Spec, podTemplate, ImagePullSecrets)
+
+	// Override service account of the pod, the podTemplate one is kept otherwise,
+	// the node can not pick the service account of its fencing pod
+	if serviceAccount := podTemplate.Annotations["fencing/service-account"]; serviceAccount != "" {
+		pod.Spec.ServiceAccountName = serviceAccount
+	}
+
+	// Host network and privileged containers are granted only on explicit request of the podTemplate,
+	// the node can not escalate the privileges of its fencing pod
+	if podTemplate.Annotations["fencing/host-network"] == "true" {
+		pod.Spec.HostNetwork = true
+		pod.Spec.DNSPolicy = v1.DNSClusterFirstWithHostNet
+	}
+	if podTemplate.Annotations["fencing/privileged"] == "true" {
+		privileged := true
+		for i := range pod.Spec.Containers {
+			if pod.Spec.Containers[i].SecurityContext == nil {
+				pod.Spec.Containers[i].SecurityContext = &v1.SecurityContext{}
+			}
+			pod.Spec.Containers[i].SecurityContext.Privileged = &privileged
+		}
+	}
+
+	// Apply fencing labels to the pod, so they can be selected by NetworkPolicies
+	podLabels := map[string]string{}
+	for k, v := range JobLabels {
+		podLabels[k] = v
+	}
+	for k, v := range pod.Labels {
+		podLabels[k] = v
+	}
+	for k, v := range labels {
+		podLabels[k] = v
+	}
+	pod.ObjectMeta.Labels = podLabels
+
 	// Set prefix name
-	prefix := pod.Name
+	prefix, ok := getAnnotation(node, podTemplate, "fencing/job-prefix")
+	if !ok {
+		prefix = pod.Name
+	}
 	if prefix == "" {
 		prefix = "fence"
 	}
 
-	// Creating new Job
-	tr := true
-	return &batchv1.Job{
+	// Render job name from the template if specified
+	name, err := renderJobName(node, podTemplate)
+	if err != nil {
+		klog.Errorln("Failed to render job name for node", node.Name, ":", err)
+	}
+	if name == "" {
+		name = prefix + "-" + node.Name
+	}
+
+	// Job is created in the namespace of PodTemplate
+	namespace := podTemplate.Namespace
+	if namespace == "" {
+		namespace = Namespace
+	}
+
+	// Creating new Job, the node is its controller owner
+	isController := true
+	blockOwnerDeletion := BlockOwnerDeletion
+	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        prefix + "-" + node.Name,
-			Namespace:   Namespace,
+			Name:        name,
+			Namespace:   namespace,
 			Labels:      labels,
 			Annotations: annotations,
 			OwnerReferences: []metav1.OwnerReference{
@@ -406,12 +1425,143 @@ func newJobForNode(node *v1.Node, podTemplate *v1.PodTemplate) *batchv1.Job {
 					Kind:               node.Kind,
 					Name:               node.Name,
 					UID:                node.UID,
-					Controller:         &tr,
-					BlockOwnerDeletion: &tr,
+					Controller:         &isController,
+					BlockOwnerDeletion: &blockOwnerDeletion,
 				},
 			},
 		},
 		Spec: batchv1.JobSpec{
 			Template: pod},
 	}
+
+	// Set parallelism and completions for multi-path fencing
+	if v, ok := getAnnotation(node, podTemplate, "fencing/parallelism"); ok {
+		parallelism, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			klog.Errorln("Failed to parse parallelism string", v, ":", err)
+		} else {
+			p := int32(parallelism)
+			job.Spec.Parallelism = &p
+		}
+	}
+	if v, ok := getAnnotation(node, podTemplate, "fencing/completions"); ok {
+		completions, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			klog.Errorln("Failed to parse completions string", v, ":", err)
+		} else {
+			c := int32(completions)
+			job.Spec.Completions = &c
+		}
+	}
+
+	// Finished job is removed by TTL controller
+	if cleanupPolicy(node, podTemplate) == "ttl" {
+		ttl := defaultCleanupTTL
+		if v, ok := getAnnotation(node, podTemplate, "fencing/cleanup-ttl"); ok {
+			var err error
+			if ttl, err = util.ParseDuration(v); err != nil {
+				klog.Errorln("Failed to parse cleanup-ttl string", v, ":", err)
+				ttl = defaultCleanupTTL
+			}
+		}
+		seconds := int32(ttl.Seconds())
+		job.Spec.TTLSecondsAfterFinished = &seconds
+	}
+
+	// Staged job runs no pods until parallelism is restored by the approval process
+	if v, _ := getAnnotation(node, podTemplate, "fencing/stage"); v == "true" {
+		parallelism := int32(1)
+		if job.Spec.Parallelism != nil {
+			parallelism = *job.Spec.Parallelism
+		}
+		job.Annotations["fencing/staged-parallelism"] = strconv.FormatInt(int64(parallelism), 10)
+		staged := int32(0)
+		job.Spec.Parallelism = &staged
+	}
+
+	return job
+}
+
+// expectRecovery reports if the fenced node should be recovered when it becomes healthy,
+// it is disabled by fencing/expect-recovery=false annotation on node or podTemplate
+func (r *ReconcileNode) expectRecovery(node *v1.Node) bool {
+	v, ok := node.Annotations["fencing/expect-recovery"]
+	if !ok {
+		podTemplate, err := r.getPodTemplate(node)
+		if err != nil {
+			return true
+		}
+		v = podTemplate.Annotations["fencing/expect-recovery"]
+	}
+	return v != "false"
+}
+
+// recoveryStabilityRemains returns the remaining time the node must be stably healthy to declare it recovered
+func (r *ReconcileNode) recoveryStabilityRemains(node *v1.Node, healthySince *metav1.Time) time.Duration {
+	if healthySince == nil || healthySince.IsZero() {
+		return 0
+	}
+	v, ok := node.Annotations["fencing/recovery-stability"]
+	if !ok {
+		podTemplate, err := r.getPodTemplate(node)
+		if err != nil {
+			return 0
+		}
+		if v, ok = podTemplate.Annotations["fencing/recovery-stability"]; !ok {
+			return 0
+		}
+	}
+	stability, err := util.ParseDuration(v)
+	if err != nil {
+		klog.Errorln("Failed to parse recovery-stability string", v, ":", err)
+		return 0
+	}
+	return time.Until(healthySince.Add(stability))
+}
+
+// fencingAction returns fencing/action of the node: off (fence-and-stay-down) or reboot (fence-and-return)
+func fencingAction(node *v1.Node, podTemplate *v1.PodTemplate) string {
+	if v, ok := getAnnotation(node, podTemplate, "fencing/action"); ok && v == "reboot" {
+		return "reboot"
+	}
+	return "off"
+}
+
+// recordRecovery updates recovery metrics for the node which fencing was started
+func recordRecovery(node *v1.Node, podTemplate *v1.PodTemplate) {
+	startedAt, err := strconv.ParseInt(node.Annotations["fencing/started-at"], 10, 64)
+	if err != nil {
+		return
+	}
+	metrics.Recovered.WithLabelValues(podTemplate.Name).Inc()
+	metrics.RecoveryDuration.WithLabelValues(podTemplate.Name).Observe(time.Since(time.Unix(startedAt, 0)).Seconds())
+}
+
+// manualRecovery returns true if the cleanup after node recovery is left to operator
+func manualRecovery(node *v1.Node, podTemplate *v1.PodTemplate) bool {
+	if v, ok := getAnnotation(node, podTemplate, "fencing/manual-recovery"); ok {
+		return v == "true"
+	}
+	return ManualRecovery
+}
+
+// fencingEnabled returns true if fencing is enabled for the node by its annotation or by its podTemplate
+func (r *ReconcileNode) fencingEnabled(node *v1.Node) bool {
+	if v, ok := node.Annotations["fencing/enabled"]; ok {
+		return v == "true"
+	}
+	podTemplate, err := r.getPodTemplate(node)
+	if err != nil {
+		return false
+	}
+	return podTemplate.Annotations["fencing/enabled"] == "true"
+}
+
+// getAnnotation returns the annotation from the node, or from the podTemplate if node does not have it
+func getAnnotation(node *v1.Node, podTemplate *v1.PodTemplate, key string) (string, bool) {
+	if v, ok := node.Annotations[key]; ok {
+		return v, true
+	}
+	v, ok := podTemplate.Annotations[key]
+	return v, ok
 }
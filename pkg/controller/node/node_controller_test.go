@@ -0,0 +1,646 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func init() {
+	Namespace = "fencing"
+}
+
+// newTestReconciler returns the ReconcileNode backed by the fake clients with the objects
+func newTestReconciler(objs ...runtime.Object) *ReconcileNode {
+	r := &ReconcileNode{
+		client:    indexedClient{fake.NewFakeClientWithScheme(scheme.Scheme, objs...)},
+		clientset: k8sfake.NewSimpleClientset(),
+		scheme:    scheme.Scheme,
+		recorder:  record.NewFakeRecorder(100),
+		states:    newStateTracker(),
+		inflight:  newInflight(),
+		spans:     newSpanTracker(),
+		limiter:   newRateLimiter(),
+		batch:     newFailureBatch(),
+		waiting:   newWaitQueue(),
+		safeMode:  newSafeMode(),
+
+		recoveryLimiter: newRecoveryLimiter(),
+	}
+	r.fencers = map[string]Fencer{
+		"job":     &jobFencer{r: r},
+		"redfish": &redfishFencer{r: r},
+		"webhook": &webhookFencer{r: r, client: &http.Client{Timeout: time.Second}},
+	}
+	return r
+}
+
+// testIndexes are the cache indexes registered by the controller
+var testIndexes = map[string]client.IndexerFunc{
+	jobNodeIndex: indexJobNode,
+	readyIndex:   indexNodeReady,
+}
+
+// indexedClient filters the listed objects by the cache indexes, which are ignored by the fake client
+type indexedClient struct {
+	client.Client
+}
+
+// List lists the objects matching the options and the indexed fields
+func (c indexedClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if err := c.Client.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if listOpts.FieldSelector == nil || listOpts.FieldSelector.Empty() {
+		return nil
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	var filtered []runtime.Object
+	for _, item := range items {
+		if indexMatches(item, listOpts.FieldSelector.Requirements()) {
+			filtered = append(filtered, item)
+		}
+	}
+	return meta.SetList(list, filtered)
+}
+
+// indexMatches reports if the indexed values of the object match the field selector requirements
+func indexMatches(obj runtime.Object, requirements fields.Requirements) bool {
+	for _, req := range requirements {
+		indexer, ok := testIndexes[req.Field]
+		if !ok {
+			continue
+		}
+		found := false
+		for _, v := range indexer(obj) {
+			found = found || v == req.Value
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// newTestNode returns the node with the Ready condition status and the annotations,
+// Unknown status is reported as posted by node lifecycle controller
+func newTestNode(name string, ready v1.ConditionStatus, annotations map[string]string) *v1.Node {
+	reason := ""
+	if ready == v1.ConditionUnknown {
+		reason = "NodeStatusUnknown"
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Annotations:       annotations,
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+		},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{
+				Type:               v1.NodeReady,
+				Status:             ready,
+				Reason:             reason,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+			}},
+		},
+	}
+}
+
+// newTestTemplate returns the PodTemplate in Namespace with the annotations
+func newTestTemplate(name string, annotations map[string]string) *v1.PodTemplate {
+	return &v1.PodTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   Namespace,
+			Annotations: annotations,
+		},
+		Template: v1.PodTemplateSpec{
+			Spec: v1.PodSpec{
+				Containers:    []v1.Container{{Name: "fence", Image: "fence-agents"}},
+				RestartPolicy: v1.RestartPolicyNever,
+			},
+		},
+	}
+}
+
+// newTestJob returns the job of the node with the fencing label
+func newTestJob(name, node, fencing string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: Namespace,
+			Labels:    map[string]string{"fencing": fencing, "node": node},
+		},
+	}
+}
+
+// reconcileNode reconciles the node and returns it as updated by the reconcile
+func reconcileNode(r *ReconcileNode, name string) (*v1.Node, reconcile.Result, error) {
+	result, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: name}})
+	node := &v1.Node{}
+	if getErr := r.client.Get(context.TODO(), types.NamespacedName{Name: name}, node); getErr != nil {
+		return nil, result, getErr
+	}
+	return node, result, err
+}
+
+func TestReconcileStates(t *testing.T) {
+	recentlyRecovered := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	recentlyFenced := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	diskPressure := newTestNode("node1", v1.ConditionTrue, map[string]string{
+		"fencing/enabled":        "true",
+		"fencing/condition-type": "DiskPressure",
+	})
+	diskPressure.Status.Conditions = append(diskPressure.Status.Conditions, v1.NodeCondition{
+		Type:   v1.NodeDiskPressure,
+		Status: v1.ConditionTrue,
+	})
+	noCondition := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true"})
+	noCondition.Status.Conditions = nil
+	startedNoCondition := newTestNode("node1", v1.ConditionUnknown, map[string]string{
+		"fencing/enabled":    "true",
+		"fencing/state":      "started",
+		"fencing/started-at": strconv.FormatInt(time.Now().Unix(), 10),
+	})
+	startedNoCondition.Status.Conditions = nil
+
+	tests := []struct {
+		name     string
+		node     *v1.Node
+		template map[string]string
+		// state is the expected fencing/state, empty if it is removed
+		state   string
+		requeue bool
+		// present and absent are the annotations expected to be set or removed
+		present []string
+		absent  []string
+	}{
+		{
+			name:  "fencing is not enabled",
+			node:  newTestNode("node1", v1.ConditionUnknown, nil),
+			state: "",
+		},
+		{
+			name:     "fencing is enabled by podTemplate",
+			node:     newTestNode("node1", v1.ConditionUnknown, nil),
+			template: map[string]string{"fencing/enabled": "true"},
+			state:    "started",
+			present:  []string{"fencing/started-at", "fencing/first-timestamp"},
+		},
+		{
+			name:  "healthy node is not fenced",
+			node:  newTestNode("node1", v1.ConditionTrue, map[string]string{"fencing/enabled": "true"}),
+			state: "",
+		},
+		{
+			name:    "failed node without timeout is started",
+			node:    newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true"}),
+			state:   "started",
+			present: []string{"fencing/started-at"},
+		},
+		{
+			name: "failed node with duration timeout is pending",
+			node: newTestNode("node1", v1.ConditionUnknown, map[string]string{
+				"fencing/enabled": "true",
+				"fencing/timeout": "5m",
+			}),
+			state:   "pending",
+			requeue: true,
+			present: []string{"fencing/timestamp", "fencing/first-timestamp"},
+		},
+		{
+			name: "pending node is started after timeout",
+			node: newTestNode("node1", v1.ConditionUnknown, map[string]string{
+				"fencing/enabled":   "true",
+				"fencing/timeout":   "60",
+				"fencing/state":     "pending",
+				"fencing/timestamp": strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10),
+			}),
+			state:  "started",
+			absent: []string{"fencing/timestamp"},
+		},
+		{
+			name:  "node without condition is ignored",
+			node:  noCondition,
+			state: "",
+		},
+		{
+			name:    "started node without condition progresses its job",
+			node:    startedNoCondition,
+			state:   "started",
+			present: []string{"fencing/attempts"},
+		},
+		{
+			name:  "custom condition type reports the node failed",
+			node:  diskPressure,
+			state: "started",
+		},
+		{
+			name: "observed node is not fenced",
+			node: newTestNode("node1", v1.ConditionUnknown, map[string]string{
+				"fencing/enabled": "true",
+				"fencing/observe": "true",
+			}),
+			state: "",
+		},
+		{
+			name: "node is not fenced during cooldown",
+			node: newTestNode("node1", v1.ConditionUnknown, map[string]string{
+				"fencing/enabled":      "true",
+				"fencing/cooldown":     "1h",
+				"fencing/recovered-at": recentlyRecovered,
+			}),
+			state:   "",
+			requeue: true,
+		},
+		{
+			name: "recovered node is cleaned up",
+			node: newTestNode("node1", v1.ConditionTrue, map[string]string{
+				"fencing/enabled":    "true",
+				"fencing/state":      "fenced",
+				"fencing/started-at": "1",
+				"fencing/attempts":   "1",
+			}),
+			state:   "",
+			present: []string{"fencing/enabled", "fencing/recovered-at"},
+			absent:  []string{"fencing/started-at", "fencing/attempts"},
+		},
+		{
+			name: "node rejoined during post-fence wait is recovered",
+			node: newTestNode("node1", v1.ConditionTrue, map[string]string{
+				"fencing/enabled":   "true",
+				"fencing/state":     "started",
+				"fencing/fenced-at": recentlyFenced,
+			}),
+			state:   "",
+			present: []string{"fencing/recovered-at"},
+			absent:  []string{"fencing/fenced-at"},
+		},
+		{
+			name: "fenced node is kept when its recovery is not expected",
+			node: newTestNode("node1", v1.ConditionTrue, map[string]string{
+				"fencing/enabled":  "true",
+				"fencing/state":    "fenced",
+				"fencing/attempts": "1",
+			}),
+			template: map[string]string{"fencing/expect-recovery": "false"},
+			state:    "fenced",
+			present:  []string{"fencing/attempts"},
+			absent:   []string{"fencing/recovered-at"},
+		},
+		{
+			name: "recovered node is left for manual cleanup",
+			node: newTestNode("node1", v1.ConditionTrue, map[string]string{
+				"fencing/enabled":         "true",
+				"fencing/state":           "fenced",
+				"fencing/manual-recovery": "true",
+				"fencing/attempts":        "1",
+			}),
+			state:   "recovered",
+			present: []string{"fencing/attempts"},
+		},
+		{
+			name: "fenced node stays fenced while it is failed",
+			node: newTestNode("node1", v1.ConditionUnknown, map[string]string{
+				"fencing/enabled": "true",
+				"fencing/state":   "fenced",
+			}),
+			state: "fenced",
+		},
+		{
+			name: "failed state is kept until recovery",
+			node: newTestNode("node1", v1.ConditionUnknown, map[string]string{
+				"fencing/enabled": "true",
+				"fencing/state":   "failed",
+			}),
+			state: "failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestReconciler(tt.node, newTestTemplate("fencing", tt.template))
+			node, result, err := reconcileNode(r, tt.node.Name)
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			if requeue := result.RequeueAfter > 0; requeue != tt.requeue {
+				t.Errorf("requeue after %v, want requeue %v", result.RequeueAfter, tt.requeue)
+			}
+			for _, k := range tt.present {
+				if _, ok := node.Annotations[k]; !ok {
+					t.Errorf("annotation %s is not set", k)
+				}
+			}
+			for _, k := range tt.absent {
+				if v, ok := node.Annotations[k]; ok {
+					t.Errorf("annotation %s=%s is not removed", k, v)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileNodeNames(t *testing.T) {
+	defer func(include, exclude []*regexp.Regexp) { IncludeNodes, ExcludeNodes = include, exclude }(IncludeNodes, ExcludeNodes)
+	tests := []struct {
+		name    string
+		node    string
+		include string
+		exclude string
+		state   string
+	}{
+		{name: "no patterns", node: "worker-1", state: "started"},
+		{name: "denied node is skipped", node: "cp-1", exclude: "^cp-", state: ""},
+		{name: "node not denied is processed", node: "worker-1", exclude: "^cp-", state: "started"},
+		{name: "allowed node is processed", node: "worker-1", include: "^worker-", state: "started"},
+		{name: "node not allowed is skipped", node: "cp-1", include: "^worker-", state: ""},
+		{name: "deny takes precedence", node: "worker-1", include: "^worker-", exclude: "-1$", state: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			IncludeNodes, ExcludeNodes = nil, nil
+			if tt.include != "" {
+				IncludeNodes = []*regexp.Regexp{regexp.MustCompile(tt.include)}
+			}
+			if tt.exclude != "" {
+				ExcludeNodes = []*regexp.Regexp{regexp.MustCompile(tt.exclude)}
+			}
+			r := newTestReconciler(newTestNode(tt.node, v1.ConditionUnknown, map[string]string{"fencing/enabled": "true"}), newTestTemplate("fencing", nil))
+			node, _, err := reconcileNode(r, tt.node)
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+		})
+	}
+}
+
+// panicClient panics on reading any PodTemplate
+type panicClient struct {
+	client.Client
+}
+
+func (c panicClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if _, ok := obj.(*v1.PodTemplate); ok {
+		panic("malformed podTemplate")
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func TestReconcilePanic(t *testing.T) {
+	r := newTestReconciler(newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true"}), newTestTemplate("fencing", nil))
+	r.client = panicClient{r.client}
+	panics := testutil.ToFloat64(metrics.ReconcilePanics.WithLabelValues("node"))
+
+	_, result, err := reconcileNode(r, "node1")
+	if err == nil {
+		t.Errorf("panic is not reported as error, result %+v", result)
+	}
+	if v := testutil.ToFloat64(metrics.ReconcilePanics.WithLabelValues("node")); v != panics+1 {
+		t.Errorf("panics metric is %v, want %v", v, panics+1)
+	}
+
+	// The controller keeps reconciling after the panic
+	r.client = r.client.(panicClient).Client
+	node, _, err := reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if state := node.Annotations["fencing/state"]; state != "started" {
+		t.Errorf("state is %q, want started", state)
+	}
+}
+
+// failingGetClient fails to read any object
+type failingGetClient struct {
+	client.Client
+}
+
+func (c failingGetClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	return errors.New("apiserver is unavailable")
+}
+
+// reconcileCount returns the number of observed node reconciles
+func reconcileCount(t *testing.T) uint64 {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.ReconcileDuration)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "controller" && label.GetValue() == "node" {
+					return m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestReconcileMetrics(t *testing.T) {
+	r := newTestReconciler(newTestNode("node1", v1.ConditionTrue, nil))
+	count := reconcileCount(t)
+	errs := testutil.ToFloat64(metrics.ReconcileErrors.WithLabelValues("node"))
+
+	if _, _, err := reconcileNode(r, "node1"); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if c := reconcileCount(t); c != count+1 {
+		t.Errorf("reconcile duration is observed %d times, want %d", c, count+1)
+	}
+	if v := testutil.ToFloat64(metrics.ReconcileErrors.WithLabelValues("node")); v != errs {
+		t.Errorf("errors metric is %v, want %v", v, errs)
+	}
+
+	r.client = failingGetClient{r.client}
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "node1"}}); err == nil {
+		t.Errorf("reconcile error is not returned")
+	}
+	if c := reconcileCount(t); c != count+2 {
+		t.Errorf("reconcile duration is observed %d times, want %d", c, count+2)
+	}
+	if v := testutil.ToFloat64(metrics.ReconcileErrors.WithLabelValues("node")); v != errs+1 {
+		t.Errorf("errors metric is %v, want %v", v, errs+1)
+	}
+}
+
+func TestReconcileTaintTrigger(t *testing.T) {
+	tests := []struct {
+		name       string
+		taintedAgo time.Duration
+		tainted    bool
+		state      string
+		requeue    bool
+	}{
+		{name: "node without taint is healthy", state: ""},
+		{name: "taint within timeout", tainted: true, taintedAgo: time.Minute, state: "pending", requeue: true},
+		{name: "taint older than timeout", tainted: true, taintedAgo: 10 * time.Minute, state: "started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The condition is not updated yet, only the taint reports the node unreachable
+			node := newTestNode("node1", v1.ConditionTrue, map[string]string{
+				"fencing/enabled": "true",
+				"fencing/trigger": "taint",
+				"fencing/timeout": "5m",
+			})
+			if tt.tainted {
+				added := metav1.NewTime(time.Now().Add(-tt.taintedAgo))
+				node.Spec.Taints = []v1.Taint{{Key: taintNodeUnreachable, Effect: v1.TaintEffectNoExecute, TimeAdded: &added}}
+			}
+			r := newTestReconciler(node, newTestTemplate("fencing", nil))
+			node, result, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			if requeue := result.RequeueAfter > 0; requeue != tt.requeue {
+				t.Errorf("requeue after %v, want requeue %v", result.RequeueAfter, tt.requeue)
+			}
+			if tt.requeue && result.RequeueAfter > 4*time.Minute+time.Second {
+				t.Errorf("requeue after %v is not counted from the taint", result.RequeueAfter)
+			}
+		})
+	}
+}
+
+func TestReconcileSkipIfEmpty(t *testing.T) {
+	controller := true
+	tests := []struct {
+		name  string
+		owner string
+		state string
+	}{
+		{name: "node with only daemon pods is skipped", owner: "DaemonSet", state: ""},
+		{name: "node with workload pods is fenced", owner: "ReplicaSet", state: "started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestReconciler(
+				newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true"}),
+				newTestTemplate("fencing", map[string]string{"fencing/skip-if-empty": "true"}),
+			)
+			r.clientset = k8sfake.NewSimpleClientset(&v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "pod1",
+					Namespace:       "default",
+					OwnerReferences: []metav1.OwnerReference{{Kind: tt.owner, Name: "owner", Controller: &controller}},
+				},
+				Spec: v1.PodSpec{NodeName: "node1"},
+			})
+			node, _, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+		})
+	}
+}
+
+func TestReconcileStartedNotEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  map[string]string
+		template map[string]string
+	}{
+		{name: "fencing is not enabled", enabled: map[string]string{}},
+		{name: "node opts out of podTemplate", enabled: map[string]string{"fencing/enabled": "false"}, template: map[string]string{"fencing/enabled": "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// State is set manually
+			annotations := map[string]string{"fencing/state": "started"}
+			for k, v := range tt.enabled {
+				annotations[k] = v
+			}
+			r := newTestReconciler(newTestNode("node1", v1.ConditionUnknown, annotations), newTestTemplate("fencing", tt.template))
+			for i := 0; i < 2; i++ {
+				node, _, err := reconcileNode(r, "node1")
+				if err != nil {
+					t.Fatalf("reconcile failed: %v", err)
+				}
+				if state := node.Annotations["fencing/state"]; state != "started" {
+					t.Errorf("state is %q, want started to be left untouched", state)
+				}
+			}
+			jobs := &batchv1.JobList{}
+			if err := r.client.List(context.TODO(), jobs); err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs.Items) != 0 {
+				t.Errorf("%d fencing jobs are created, want none", len(jobs.Items))
+			}
+		})
+	}
+}
+
+func TestReconcileMinNodeAge(t *testing.T) {
+	defer func(v time.Duration) { MinNodeAge = v }(MinNodeAge)
+	MinNodeAge = 10 * time.Minute
+
+	tests := []struct {
+		name    string
+		age     time.Duration
+		state   string
+		requeue bool
+	}{
+		{name: "young node is not fenced", age: time.Minute, requeue: true},
+		{name: "old node is fenced", age: time.Hour, state: "started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true"})
+			node.CreationTimestamp = metav1.NewTime(time.Now().Add(-tt.age))
+			r := newTestReconciler(node, newTestTemplate("fencing", nil))
+			node, result, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			// Young node is checked again when it reaches the age
+			if requeue := result.RequeueAfter > 8*time.Minute && result.RequeueAfter <= 9*time.Minute; requeue != tt.requeue {
+				t.Errorf("requeue after %v, want requeue %v", result.RequeueAfter, tt.requeue)
+			}
+		})
+	}
+}
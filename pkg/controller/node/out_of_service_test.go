@@ -0,0 +1,46 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestOutOfServiceTaint(t *testing.T) {
+	// Backend already fenced the node
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{
+		"fencing/enabled":   "true",
+		"fencing/state":     "started",
+		"fencing/fenced-at": "1",
+	})
+	r := newTestReconciler(node, newTestTemplate("fencing", map[string]string{"fencing/out-of-service": "true"}))
+	node, _, err := reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if state := node.Annotations["fencing/state"]; state != "fenced" {
+		t.Errorf("state is %q, want fenced", state)
+	}
+	if !util.HasOutOfServiceTaint(node) {
+		t.Errorf("fenced node is not tainted out of service: %v", node.Spec.Taints)
+	}
+
+	// Node recovered
+	node.Status.Conditions[0].Status = v1.ConditionTrue
+	node.Status.Conditions[0].Reason = ""
+	if err := r.client.Status().Update(context.TODO(), node); err != nil {
+		t.Fatal(err)
+	}
+	node, _, err = reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if state, ok := node.Annotations["fencing/state"]; ok {
+		t.Errorf("state %q is not cleared", state)
+	}
+	if util.HasOutOfServiceTaint(node) {
+		t.Errorf("recovered node is still tainted out of service")
+	}
+}
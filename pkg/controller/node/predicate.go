@@ -0,0 +1,50 @@
+package node
+
+import (
+	"reflect"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// nodeChangedPredicate drops heartbeat-only node updates, create, delete and generic events are passed
+var nodeChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNode, ok := e.ObjectOld.(*v1.Node)
+		if !ok {
+			return true
+		}
+		newNode, ok := e.ObjectNew.(*v1.Node)
+		if !ok {
+			return true
+		}
+		return nodeChanged(oldNode, newNode)
+	},
+}
+
+// nodeChanged returns true if the fields used for fencing differ between the nodes
+func nodeChanged(oldNode, newNode *v1.Node) bool {
+	// Periodic resync delivers the same object version
+	if oldNode.ResourceVersion == newNode.ResourceVersion {
+		return true
+	}
+	if !reflect.DeepEqual(oldNode.Annotations, newNode.Annotations) ||
+		!reflect.DeepEqual(oldNode.Labels, newNode.Labels) ||
+		!reflect.DeepEqual(oldNode.Finalizers, newNode.Finalizers) ||
+		!reflect.DeepEqual(oldNode.Spec.Taints, newNode.Spec.Taints) ||
+		!oldNode.DeletionTimestamp.Equal(newNode.DeletionTimestamp) {
+		return true
+	}
+	if len(oldNode.Status.Conditions) != len(newNode.Status.Conditions) {
+		return true
+	}
+	// Compare conditions ignoring heartbeat and transition times
+	for i := range oldNode.Status.Conditions {
+		o, n := oldNode.Status.Conditions[i], newNode.Status.Conditions[i]
+		if o.Type != n.Type || o.Status != n.Status || o.Reason != n.Reason {
+			return true
+		}
+	}
+	return false
+}
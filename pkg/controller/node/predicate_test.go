@@ -0,0 +1,64 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestNodeChangedPredicate(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  func(n *v1.Node)
+		changed bool
+	}{
+		{name: "resync", changed: true},
+		{name: "heartbeat", update: func(n *v1.Node) {
+			n.ResourceVersion = "2"
+			n.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(time.Now().Add(time.Minute))
+		}},
+		{name: "ready condition", update: func(n *v1.Node) {
+			n.ResourceVersion = "2"
+			n.Status.Conditions[0].Status = v1.ConditionUnknown
+			n.Status.Conditions[0].Reason = "NodeStatusUnknown"
+		}, changed: true},
+		{name: "new condition", update: func(n *v1.Node) {
+			n.ResourceVersion = "2"
+			n.Status.Conditions = append(n.Status.Conditions, v1.NodeCondition{Type: v1.NodeMemoryPressure, Status: v1.ConditionFalse})
+		}, changed: true},
+		{name: "annotations", update: func(n *v1.Node) {
+			n.ResourceVersion = "2"
+			n.Annotations = map[string]string{"fencing/enabled": "true"}
+		}, changed: true},
+		{name: "labels", update: func(n *v1.Node) {
+			n.ResourceVersion = "2"
+			n.Labels = map[string]string{"zone": "a"}
+		}, changed: true},
+		{name: "taints", update: func(n *v1.Node) {
+			n.ResourceVersion = "2"
+			n.Spec.Taints = []v1.Taint{{Key: taintNodeUnreachable, Effect: v1.TaintEffectNoExecute}}
+		}, changed: true},
+		{name: "deletion", update: func(n *v1.Node) {
+			n.ResourceVersion = "2"
+			now := metav1.Now()
+			n.DeletionTimestamp = &now
+		}, changed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldNode := newTestNode("node1", v1.ConditionTrue, nil)
+			oldNode.ResourceVersion = "1"
+			newNode := oldNode.DeepCopy()
+			if tt.update != nil {
+				tt.update(newNode)
+			}
+			e := event.UpdateEvent{MetaOld: oldNode, ObjectOld: oldNode, MetaNew: newNode, ObjectNew: newNode}
+			if changed := nodeChangedPredicate.Update(e); changed != tt.changed {
+				t.Errorf("update passed is %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package node
+
+import (
+	"context"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	// readyIndex is the name of the cache index on the node Ready condition status
+	readyIndex = "fencing.ready"
+)
+
+// addReadyIndex registers cache index on the node Ready condition status
+func addReadyIndex(mgr manager.Manager) error {
+	return mgr.GetFieldIndexer().IndexField(&v1.Node{}, readyIndex, indexNodeReady)
+}
+
+// indexNodeReady returns the Ready condition status of the node
+func indexNodeReady(obj runtime.Object) []string {
+	node, ok := obj.(*v1.Node)
+	if !ok {
+		return nil
+	}
+	_, c := util.GetNodeCondition(&node.Status, v1.NodeReady)
+	if c != nil && c.Status == v1.ConditionTrue {
+		return []string{"true"}
+	}
+	return []string{"false"}
+}
+
+// countReadyNodes returns the number of nodes with Ready condition using the cached index
+func (r *ReconcileNode) countReadyNodes(ctx context.Context) (int, error) {
+	nodes := &v1.NodeList{}
+	err := r.client.List(ctx, nodes, client.MatchingFields{readyIndex: "true"})
+	if err != nil {
+		return 0, err
+	}
+	return len(nodes.Items), nil
+}
@@ -0,0 +1,27 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCountReadyNodes(t *testing.T) {
+	noCondition := newTestNode("node4", v1.ConditionTrue, nil)
+	noCondition.Status.Conditions = nil
+	r := newTestReconciler(
+		newTestNode("node1", v1.ConditionTrue, nil),
+		newTestNode("node2", v1.ConditionTrue, nil),
+		newTestNode("node3", v1.ConditionUnknown, nil),
+		noCondition,
+		newTestNode("node5", v1.ConditionFalse, nil),
+	)
+	count, err := r.countReadyNodes(context.TODO())
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("ready nodes count is %d, want 2", count)
+	}
+}
@@ -0,0 +1,243 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestRecoveryJobCleanup(t *testing.T) {
+	tests := []struct {
+		name     string
+		template map[string]string
+		// label is the expected fencing label of the kept job, empty if the job is deleted
+		label string
+	}{
+		{name: "job is deleted by default"},
+		{name: "job is deleted on recovery", template: map[string]string{"fencing/delete-job-on-recovery": "true"}},
+		{name: "job is kept", template: map[string]string{"fencing/delete-job-on-recovery": "false"}, label: "recovered"},
+		{name: "on-recovery policy deletes job", template: map[string]string{"fencing/cleanup-policy": "on-recovery"}},
+		{name: "ttl policy leaves job to TTL controller", template: map[string]string{"fencing/cleanup-policy": "ttl"}, label: "recovered"},
+		{name: "keep policy archives job", template: map[string]string{"fencing/cleanup-policy": "keep"}, label: "recovered"},
+		{name: "policy overrides deprecated annotation", template: map[string]string{"fencing/cleanup-policy": "on-recovery", "fencing/delete-job-on-recovery": "false"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", v1.ConditionTrue, map[string]string{
+				"fencing/enabled":    "true",
+				"fencing/state":      "fenced",
+				"fencing/started-at": "1",
+			})
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "fence-node1",
+					Namespace: Namespace,
+					Labels:    map[string]string{"fencing": "fence", "node": "node1"},
+				},
+				Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1.ConditionTrue}}},
+			}
+			r := newTestReconciler(node, job, newTestTemplate("fencing", tt.template))
+			node, _, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state, ok := node.Annotations["fencing/state"]; ok {
+				t.Errorf("state %q is not cleared", state)
+			}
+			if _, ok := node.Annotations["fencing/recovered-at"]; !ok {
+				t.Errorf("recovered-at is not set")
+			}
+
+			job = &batchv1.Job{}
+			err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: Namespace, Name: "fence-node1"}, job)
+			if tt.label == "" {
+				if !errors.IsNotFound(err) {
+					t.Errorf("job is not deleted: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("job is not kept: %v", err)
+			}
+			if label := job.Labels["fencing"]; label != tt.label {
+				t.Errorf("job is labeled %q, want %q", label, tt.label)
+			}
+		})
+	}
+}
+
+func TestRecoveryStability(t *testing.T) {
+	tests := []struct {
+		name       string
+		ready      v1.ConditionStatus
+		readySince time.Duration
+		state      string
+		requeue    bool
+	}{
+		{name: "brief ready blip", ready: v1.ConditionTrue, readySince: 10 * time.Second, state: "fenced", requeue: true},
+		{name: "failed again after the blip", ready: v1.ConditionUnknown, readySince: 5 * time.Second, state: "fenced"},
+		{name: "stably ready node is recovered", ready: v1.ConditionTrue, readySince: 5 * time.Minute, state: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", tt.ready, map[string]string{
+				"fencing/enabled":            "true",
+				"fencing/state":              "fenced",
+				"fencing/recovery-stability": "2m",
+			})
+			node.Status.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-tt.readySince))
+			r := newTestReconciler(node, newTestTemplate("fencing", nil))
+			node, result, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+			if requeue := result.RequeueAfter > 0; requeue != tt.requeue {
+				t.Errorf("requeue after %v, want requeue %v", result.RequeueAfter, tt.requeue)
+			}
+			if tt.requeue && result.RequeueAfter > 2*time.Minute-10*time.Second {
+				t.Errorf("requeue after %v is not counted from the ready transition", result.RequeueAfter)
+			}
+		})
+	}
+}
+
+func TestUnexpectedRecovery(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		unexpected bool
+	}{
+		{name: "powered off node is not expected to return", action: "off", unexpected: true},
+		{name: "rebooted node is expected to return", action: "reboot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", v1.ConditionTrue, map[string]string{
+				"fencing/enabled": "true",
+				"fencing/state":   "fenced",
+			})
+			r := newTestReconciler(node, newTestTemplate("fencing", map[string]string{"fencing/action": tt.action}))
+			recorder := record.NewFakeRecorder(10)
+			r.recorder = recorder
+			node, _, err := reconcileNode(r, "node1")
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if state, ok := node.Annotations["fencing/state"]; ok {
+				t.Errorf("state %q is not cleared", state)
+			}
+			close(recorder.Events)
+			unexpected := false
+			for event := range recorder.Events {
+				if strings.Contains(event, "UnexpectedRecovery") {
+					unexpected = true
+				}
+			}
+			if unexpected != tt.unexpected {
+				t.Errorf("unexpected recovery is reported %v, want %v", unexpected, tt.unexpected)
+			}
+		})
+	}
+}
+
+func TestRecoveryMetrics(t *testing.T) {
+	node := newTestNode("node1", v1.ConditionTrue, map[string]string{
+		"fencing/enabled":    "true",
+		"fencing/state":      "fenced",
+		"fencing/started-at": strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10),
+	})
+	r := newTestReconciler(node, newTestTemplate("fencing", map[string]string{"fencing/action": "reboot"}))
+	recorder := record.NewFakeRecorder(10)
+	r.recorder = recorder
+	recovered := testutil.ToFloat64(metrics.Recovered.WithLabelValues("fencing"))
+
+	if _, _, err := reconcileNode(r, "node1"); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if v := testutil.ToFloat64(metrics.Recovered.WithLabelValues("fencing")); v != recovered+1 {
+		t.Errorf("recovered metric is %v, want %v", v, recovered+1)
+	}
+	close(recorder.Events)
+	events := []string{}
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	if len(events) != 1 || !strings.HasPrefix(events[0], "Normal NodeRecovered") {
+		t.Errorf("events are %q, want NodeRecovered", events)
+	}
+}
+
+// flakyDeleteClient fails the first deletes of the objects
+type flakyDeleteClient struct {
+	client.Client
+	failures int
+}
+
+func (c *flakyDeleteClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	if c.failures > 0 {
+		c.failures--
+		return errors.NewServiceUnavailable("delete is not available")
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func TestRecoveryCleanupRetry(t *testing.T) {
+	node := newTestNode("node1", v1.ConditionTrue, map[string]string{
+		"fencing/enabled": "true",
+		"fencing/state":   "fenced",
+	})
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "fence-node1",
+			Namespace: Namespace,
+			Labels:    map[string]string{"fencing": "fence", "node": "node1"},
+		},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1.ConditionTrue}}},
+	}
+	r := newTestReconciler(node, job, newTestTemplate("fencing", nil))
+	r.client = &flakyDeleteClient{Client: r.client, failures: 1}
+	errorsBefore := testutil.ToFloat64(metrics.CleanupErrors)
+
+	// Failed cleanup keeps the state to be retried
+	node, _, err := reconcileNode(r, "node1")
+	if err == nil {
+		t.Fatalf("reconcile succeeded, want the delete error to requeue")
+	}
+	if state := node.Annotations["fencing/state"]; state != "fenced" {
+		t.Errorf("state is %q, want fenced", state)
+	}
+	if got := testutil.ToFloat64(metrics.CleanupErrors) - errorsBefore; got != 1 {
+		t.Errorf("cleanup errors metric is increased by %v, want 1", got)
+	}
+
+	node, _, err = reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("retried reconcile failed: %v", err)
+	}
+	if state, ok := node.Annotations["fencing/state"]; ok {
+		t.Errorf("state %q is not cleared", state)
+	}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: Namespace, Name: "fence-node1"}, &batchv1.Job{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("job is not deleted: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.CleanupErrors) - errorsBefore; got != 1 {
+		t.Errorf("cleanup errors metric is increased by %v after retry, want 1", got)
+	}
+}
@@ -0,0 +1,139 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/redfish"
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+)
+
+// redfishPollInterval is the interval of checking the power state of the node reset by ForceOff
+const redfishPollInterval = 5 * time.Second
+
+// redfishFencer powers off the node via Redfish API of its BMC
+type redfishFencer struct {
+	r *ReconcileNode
+}
+
+// Fence resets the node system, the power state is checked on the next calls until it is Off,
+// the reset time is recorded in fencing/redfish-reset-at annotation meanwhile
+func (f *redfishFencer) Fence(ctx context.Context, node *v1.Node) (FenceResult, error) {
+	podTemplate, err := f.r.getPodTemplate(node)
+	if err != nil {
+		return FenceResult{}, err
+	}
+	annotation := func(key, def string) string {
+		if v, ok := getAnnotation(node, podTemplate, key); ok {
+			return v
+		}
+		return def
+	}
+	templateAnnotation := func(key, def string) string {
+		if v, ok := podTemplate.Annotations[key]; ok {
+			return v
+		}
+		return def
+	}
+
+	// The address, the secret and the TLS verification are never taken from the node, so it can not obtain
+	// the BMC credentials, nor pick the system and the reset type
+	address := resolveTemplateAddress(node, podTemplate, "fencing/redfish-address")
+	if address == "" {
+		return FenceResult{}, fmt.Errorf("fencing/redfish-address is not specified and can not be resolved")
+	}
+	timeout, err := util.ParseDuration(annotation("fencing/redfish-timeout", "60"))
+	if err != nil {
+		return FenceResult{}, fmt.Errorf("failed to parse fencing/redfish-timeout: %v", err)
+	}
+
+	// Load credentials
+	username, password, err := f.r.getCredentials(ctx, podTemplate.Namespace, podTemplate.Annotations["fencing/redfish-secret"])
+	if err != nil {
+		return FenceResult{}, err
+	}
+
+	c := redfish.NewClient(address, username, password, templateAnnotation("fencing/redfish-insecure", "false") == "true", 30*time.Second)
+	system := templateAnnotation("fencing/redfish-system", "")
+	if system == "" {
+		if system, err = c.DefaultSystem(ctx); err != nil {
+			return FenceResult{}, err
+		}
+	}
+
+	defaultResetType := "ForceOff"
+	if fencingAction(node, podTemplate) == "reboot" {
+		defaultResetType = "ForceRestart"
+	}
+	// Confirm power state of the node reset before
+	if v, ok := node.Annotations["fencing/redfish-reset-at"]; ok {
+		resetAt, _ := strconv.ParseInt(v, 10, 64)
+		state, err := c.PowerState(ctx, system)
+		if err != nil {
+			return FenceResult{}, err
+		}
+		if state == "Off" {
+			return FenceResult{Fenced: true}, f.setResetAt(ctx, node, nil)
+		}
+		if time.Since(time.Unix(resetAt, 0)) > timeout {
+			if err := f.setResetAt(ctx, node, nil); err != nil {
+				return FenceResult{}, err
+			}
+			return FenceResult{}, fmt.Errorf("node %s is still powered %s after %s", node.Name, state, timeout)
+		}
+		return FenceResult{RequeueAfter: redfishPollInterval}, nil
+	}
+
+	resetType := templateAnnotation("fencing/redfish-reset-type", defaultResetType)
+	klog.Infoln("Resetting node", node.Name, "via Redfish", address+system, ":", resetType)
+	if err := c.Reset(ctx, system, resetType); err != nil {
+		return FenceResult{Started: true}, err
+	}
+
+	// Power state is confirmed only for ForceOff
+	if resetType != "ForceOff" {
+		return FenceResult{Fenced: true, Started: true}, nil
+	}
+	err = f.setResetAt(ctx, node, strconv.FormatInt(time.Now().Unix(), 10))
+	return FenceResult{RequeueAfter: redfishPollInterval, Started: true}, err
+}
+
+// InProgress returns true while the power state of the node reset by ForceOff is checked
+func (f *redfishFencer) InProgress(ctx context.Context, node *v1.Node) (bool, error) {
+	_, ok := node.Annotations["fencing/redfish-reset-at"]
+	return ok, nil
+}
+
+// Cancel stops checking the power state, the reset itself can not be cancelled
+func (f *redfishFencer) Cancel(ctx context.Context, node *v1.Node) error {
+	return f.setResetAt(ctx, node, nil)
+}
+
+// setResetAt records the time of ForceOff reset on the node, nil removes it
+func (f *redfishFencer) setResetAt(ctx context.Context, node *v1.Node, resetAt interface{}) error {
+	err := util.PatchNodeAnnotations(ctx, f.r.client, node, map[string]interface{}{
+		"fencing/redfish-reset-at": resetAt,
+	})
+	if err != nil {
+		klog.Errorln("Failed to patch node", node.Name, ":", err)
+	}
+	return err
+}
+
+// getCredentials returns username and password from the Secret in the namespace
+func (r *ReconcileNode) getCredentials(ctx context.Context, namespace, secretName string) (string, string, error) {
+	if secretName == "" {
+		return "", "", nil
+	}
+	secret := &v1.Secret{}
+	err := r.client.Get(ctx, types.NamespacedName{Name: secretName, Namespace: namespace}, secret)
+	if err != nil {
+		return "", "", err
+	}
+	return string(secret.Data["username"]), string(secret.Data["password"]), nil
+}
@@ -0,0 +1,164 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fakeBMC serves the subset of Redfish API used by redfishFencer
+type fakeBMC struct {
+	powerState string
+	resets     []string
+	fail       bool
+	username   string
+	password   string
+}
+
+func (b *fakeBMC) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if username, password, ok := req.BasicAuth(); !ok || username != b.username || password != b.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case req.Method == "GET" && req.URL.Path == "/redfish/v1/Systems":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Members": []map[string]string{{"@odata.id": "/redfish/v1/Systems/1"}},
+		})
+	case req.Method == "GET" && req.URL.Path == "/redfish/v1/Systems/1":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"PowerState": b.powerState,
+			"Actions": map[string]interface{}{
+				"#ComputerSystem.Reset": map[string]string{"target": "/redfish/v1/Systems/1/Actions/Reset"},
+			},
+		})
+	case req.Method == "POST" && req.URL.Path == "/redfish/v1/Systems/1/Actions/Reset":
+		if b.fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body := map[string]string{}
+		json.NewDecoder(req.Body).Decode(&body)
+		b.resets = append(b.resets, body["ResetType"])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRedfishFence(t *testing.T) {
+	longAgo := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	justNow := strconv.FormatInt(time.Now().Unix(), 10)
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		template    map[string]string
+		powerState  string
+		fail        bool
+		noAddress   bool
+		result      FenceResult
+		err         bool
+		resets      []string
+		resetAt     bool
+	}{
+		{name: "address is not specified", noAddress: true, err: true},
+		{name: "power off is started", powerState: "On", result: FenceResult{Started: true, RequeueAfter: redfishPollInterval}, resets: []string{"ForceOff"}, resetAt: true},
+		{name: "reboot is not confirmed", annotations: map[string]string{"fencing/action": "reboot"}, powerState: "On", result: FenceResult{Started: true, Fenced: true}, resets: []string{"ForceRestart"}},
+		{name: "reset type annotation", template: map[string]string{"fencing/redfish-reset-type": "PowerCycle"}, powerState: "On", result: FenceResult{Started: true, Fenced: true}, resets: []string{"PowerCycle"}},
+		{name: "failed reset counts the attempt", powerState: "On", fail: true, result: FenceResult{Started: true}, err: true},
+		{name: "node is powered off", annotations: map[string]string{"fencing/redfish-reset-at": justNow}, powerState: "Off", result: FenceResult{Fenced: true}},
+		{name: "power state is checked again", annotations: map[string]string{"fencing/redfish-reset-at": justNow}, powerState: "On", result: FenceResult{RequeueAfter: redfishPollInterval}, resetAt: true},
+		{name: "node is not powered off in time", annotations: map[string]string{"fencing/redfish-reset-at": longAgo}, powerState: "On", err: true},
+		{name: "address and secret are not taken from node", annotations: map[string]string{"fencing/redfish-address": "http://127.0.0.1:1", "fencing/redfish-secret": "other"}, powerState: "On", result: FenceResult{Started: true, RequeueAfter: redfishPollInterval}, resets: []string{"ForceOff"}, resetAt: true},
+		{name: "reset type, system and TLS verification are not taken from node", annotations: map[string]string{"fencing/redfish-reset-type": "PowerCycle", "fencing/redfish-system": "/redfish/v1/Systems/2", "fencing/redfish-insecure": "true"}, powerState: "On", result: FenceResult{Started: true, RequeueAfter: redfishPollInterval}, resets: []string{"ForceOff"}, resetAt: true},
+		{name: "address is not specified in template", annotations: map[string]string{"fencing/redfish-address": "http://127.0.0.1:1"}, noAddress: true, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bmc := &fakeBMC{powerState: tt.powerState, fail: tt.fail, username: "admin", password: "secret"}
+			server := httptest.NewServer(bmc)
+			defer server.Close()
+
+			template := map[string]string{"fencing/redfish-secret": "bmc"}
+			if !tt.noAddress {
+				template["fencing/redfish-address"] = server.URL
+			}
+			for k, v := range tt.template {
+				template[k] = v
+			}
+			annotations := map[string]string{"fencing/backend": "redfish"}
+			for k, v := range tt.annotations {
+				annotations[k] = v
+			}
+			node := newTestNode("node1", v1.ConditionUnknown, annotations)
+			secret := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "bmc", Namespace: Namespace},
+				Data:       map[string][]byte{"username": []byte("admin"), "password": []byte("secret")},
+			}
+			other := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: Namespace},
+				Data:       map[string][]byte{"username": []byte("other"), "password": []byte("other")},
+			}
+			r := newTestReconciler(node, secret, other, newTestTemplate("fencing", template))
+
+			result, err := r.fencers["redfish"].Fence(context.TODO(), node)
+			if (err != nil) != tt.err {
+				t.Errorf("fence error is %v, want error %v", err, tt.err)
+			}
+			if result != tt.result {
+				t.Errorf("result is %+v, want %+v", result, tt.result)
+			}
+			if len(bmc.resets) != len(tt.resets) || (len(tt.resets) > 0 && bmc.resets[0] != tt.resets[0]) {
+				t.Errorf("resets are %v, want %v", bmc.resets, tt.resets)
+			}
+			stored := &v1.Node{}
+			if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "node1"}, stored); err != nil {
+				t.Fatalf("get node failed: %v", err)
+			}
+			if _, resetAt := stored.Annotations["fencing/redfish-reset-at"]; resetAt != tt.resetAt {
+				t.Errorf("reset time recorded is %v, want %v", resetAt, tt.resetAt)
+			}
+			inProgress, _ := attemptInProgress(context.TODO(), r.fencers["redfish"], stored)
+			if inProgress != tt.resetAt {
+				t.Errorf("attempt in progress is %v, want %v", inProgress, tt.resetAt)
+			}
+		})
+	}
+}
+
+func TestRedfishCancel(t *testing.T) {
+	bmc := &fakeBMC{powerState: "On", username: "admin", password: "secret"}
+	server := httptest.NewServer(bmc)
+	defer server.Close()
+
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{
+		"fencing/backend":          "redfish",
+		"fencing/redfish-reset-at": strconv.FormatInt(time.Now().Unix(), 10),
+	})
+	r := newTestReconciler(node, newTestTemplate("fencing", map[string]string{"fencing/redfish-address": server.URL}))
+	if err := r.fencers["redfish"].Cancel(context.TODO(), node); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	stored := &v1.Node{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "node1"}, stored); err != nil {
+		t.Fatalf("get node failed: %v", err)
+	}
+	// Power state is not checked anymore
+	if _, ok := stored.Annotations["fencing/redfish-reset-at"]; ok {
+		t.Errorf("reset time is not removed")
+	}
+	if inProgress, _ := attemptInProgress(context.TODO(), r.fencers["redfish"], stored); inProgress {
+		t.Errorf("attempt is still in progress")
+	}
+	if len(bmc.resets) != 0 {
+		t.Errorf("resets %v are sent by cancel, want none", bmc.resets)
+	}
+}
@@ -0,0 +1,57 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// checkRescheduled emits WorkloadsRescheduled event when all the workloads removed from the fenced node
+// have pods on other nodes, or RescheduleStalled event when they are not rescheduled until the deadline
+func (r *ReconcileNode) checkRescheduled(node *v1.Node) (reconcile.Result, error) {
+	owners := strings.Split(node.Annotations["fencing/reschedule-owners"], ",")
+	deadline, _ := strconv.ParseInt(node.Annotations["fencing/reschedule-deadline"], 10, 64)
+	startedAt, _ := strconv.ParseInt(node.Annotations["fencing/started-at"], 10, 64)
+
+	pending, err := util.PendingOwners(r.clientset, node.Name, owners, time.Unix(startedAt, 0))
+	if err != nil {
+		klog.Errorln("Failed to check rescheduled workloads of node", node.Name, ":", err)
+		return reconcile.Result{}, err
+	}
+	if len(pending) > 0 {
+		if remainTime := time.Until(time.Unix(deadline, 0)); remainTime > 0 {
+			return reconcile.Result{RequeueAfter: minDuration(remainTime, 10*time.Second)}, nil
+		}
+		message := "Workloads are not rescheduled from the fenced node: " + strings.Join(pending, ", ")
+		klog.Infoln(message, "for node", node.Name)
+		r.recorder.Event(node, v1.EventTypeWarning, "RescheduleStalled", message)
+	} else {
+		klog.Infoln("Workloads are rescheduled from node", node.Name)
+		r.recorder.Event(node, v1.EventTypeNormal, "WorkloadsRescheduled", "All workloads are rescheduled from the fenced node")
+	}
+
+	// Stop tracking
+	err = util.PatchNodeAnnotations(context.TODO(), r.client, node, map[string]interface{}{
+		"fencing/reschedule-owners":   nil,
+		"fencing/reschedule-deadline": nil,
+	})
+	if err != nil {
+		klog.Errorln("Failed to patch node", node.Name, ":", err)
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, nil
+}
+
+// minDuration returns the smaller duration
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,92 @@
+package node
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/metrics"
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+var (
+	// SafeModeThreshold is the fraction of nodes flipped to unknown status within SafeModeWindow which suspends all fencing,
+	// 0 disables safe mode
+	SafeModeThreshold float64
+	// SafeModeWindow is the sliding window the nodes must lose their status within to enter safe mode
+	SafeModeWindow = time.Minute
+)
+
+// safeMode remembers if fencing is suspended, it is entered when many nodes flip to unknown status at once
+// and left only when the fraction of nodes with unknown status recovers
+type safeMode struct {
+	mu     sync.Mutex
+	active bool
+}
+
+// newSafeMode returns a new safeMode
+func newSafeMode() *safeMode {
+	return &safeMode{}
+}
+
+// update enters safe mode if flipped fraction of nodes exceeds the threshold and leaves it
+// if unknown fraction of nodes doesn't, it returns true while safe mode is active
+func (s *safeMode) update(flipped, unknown, total int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case !s.active && float64(flipped)/float64(total) > SafeModeThreshold:
+		s.active = true
+		klog.Errorln("Safe mode:", flipped, "of", total, "nodes lost their status at once, fencing is suspended")
+	case s.active && float64(unknown)/float64(total) <= SafeModeThreshold:
+		s.active = false
+		klog.Infoln("Safe mode is left:", unknown, "of", total, "nodes have unknown status, fencing is resumed")
+	}
+	if s.active {
+		metrics.SafeMode.Set(1)
+	} else {
+		metrics.SafeMode.Set(0)
+	}
+	return s.active
+}
+
+// inSafeMode returns true if too many nodes lost their status at once, which likely means
+// the control plane is unavailable rather than the nodes failed
+func (r *ReconcileNode) inSafeMode(ctx context.Context) (bool, error) {
+	if SafeModeThreshold <= 0 {
+		return false, nil
+	}
+	nodes := &v1.NodeList{}
+	if err := r.client.List(ctx, nodes); err != nil {
+		return false, err
+	}
+	if len(nodes.Items) == 0 {
+		return false, nil
+	}
+	var transitions []time.Time
+	for i := range nodes.Items {
+		_, c := util.GetNodeCondition(&nodes.Items[i].Status, v1.NodeReady)
+		if c != nil && c.Reason == "NodeStatusUnknown" {
+			transitions = append(transitions, c.LastTransitionTime.Time)
+		}
+	}
+	return r.safeMode.update(maxFlipped(transitions, SafeModeWindow), len(transitions), len(nodes.Items)), nil
+}
+
+// maxFlipped returns the maximum number of the transitions within the sliding window
+func maxFlipped(transitions []time.Time, window time.Duration) int {
+	sort.Slice(transitions, func(i, j int) bool { return transitions[i].Before(transitions[j]) })
+	max, first := 0, 0
+	for last := range transitions {
+		for transitions[last].Sub(transitions[first]) > window {
+			first++
+		}
+		if n := last - first + 1; n > max {
+			max = n
+		}
+	}
+	return max
+}
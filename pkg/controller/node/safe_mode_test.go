@@ -0,0 +1,113 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMaxFlipped(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		transitions []time.Duration
+		max         int
+	}{
+		{name: "no transitions"},
+		{name: "nodes failed one by one", transitions: []time.Duration{time.Hour, 30 * time.Minute, 0}, max: 1},
+		{name: "nodes failed at once", transitions: []time.Duration{time.Hour, 50 * time.Second, 30 * time.Second, 0}, max: 3},
+		{name: "old burst is detected", transitions: []time.Duration{0, time.Hour, time.Hour + 10*time.Second}, max: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var transitions []time.Time
+			for _, ago := range tt.transitions {
+				transitions = append(transitions, now.Add(-ago))
+			}
+			if max := maxFlipped(transitions, time.Minute); max != tt.max {
+				t.Errorf("max flipped is %d, want %d", max, tt.max)
+			}
+		})
+	}
+}
+
+func TestSafeMode(t *testing.T) {
+	defer func(threshold float64, window time.Duration) {
+		SafeModeThreshold, SafeModeWindow = threshold, window
+	}(SafeModeThreshold, SafeModeWindow)
+	SafeModeThreshold, SafeModeWindow = 0.5, time.Minute
+
+	r := newTestReconciler(newTestTemplate("fencing", nil))
+	for _, name := range []string{"node1", "node2", "node3", "node4"} {
+		if err := r.client.Create(context.TODO(), newTestNode(name, v1.ConditionTrue, nil)); err != nil {
+			t.Fatalf("create node failed: %v", err)
+		}
+	}
+	// setStatus sets the Ready condition of the node, unknown status is reported the given time ago
+	setStatus := func(name string, ready v1.ConditionStatus, ago time.Duration) {
+		node := &v1.Node{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: name}, node); err != nil {
+			t.Fatalf("get node failed: %v", err)
+		}
+		node.Status.Conditions = newTestNode(name, ready, nil).Status.Conditions
+		node.Status.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-ago))
+		if err := r.client.Update(context.TODO(), node); err != nil {
+			t.Fatalf("update node failed: %v", err)
+		}
+	}
+
+	steps := []struct {
+		name   string
+		status map[string]time.Duration
+		ready  []string
+		safe   bool
+	}{
+		{name: "nodes failed one by one", status: map[string]time.Duration{"node1": 30 * time.Minute, "node2": 20 * time.Minute, "node3": 10 * time.Minute}},
+		{name: "nodes flipped at once", status: map[string]time.Duration{"node1": 30 * time.Second, "node2": 20 * time.Second, "node3": 10 * time.Second}, safe: true},
+		{name: "safe mode is kept while nodes have unknown status", status: map[string]time.Duration{"node1": 30 * time.Minute, "node2": 20 * time.Minute, "node3": 10 * time.Minute}, safe: true},
+		{name: "safe mode is left when nodes recover", ready: []string{"node2", "node3"}},
+		{name: "recovered nodes are kept out of safe mode", status: map[string]time.Duration{"node2": 40 * time.Minute}},
+	}
+	for _, s := range steps {
+		for name, ago := range s.status {
+			setStatus(name, v1.ConditionUnknown, ago)
+		}
+		for _, name := range s.ready {
+			setStatus(name, v1.ConditionTrue, 0)
+		}
+		safe, err := r.inSafeMode(context.TODO())
+		if err != nil {
+			t.Fatalf("%s: check safe mode failed: %v", s.name, err)
+		}
+		if safe != s.safe {
+			t.Errorf("%s: safe mode is %v, want %v", s.name, safe, s.safe)
+		}
+	}
+}
+
+func TestSafeModeBlocksFencing(t *testing.T) {
+	defer func(threshold float64) {
+		SafeModeThreshold = threshold
+	}(SafeModeThreshold)
+	SafeModeThreshold = 0.5
+
+	objs := []runtime.Object{newTestTemplate("fencing", map[string]string{"fencing/enabled": "true"})}
+	for _, name := range []string{"node1", "node2", "node3"} {
+		node := newTestNode(name, v1.ConditionUnknown, nil)
+		node.Status.Conditions[0].LastTransitionTime = metav1.Now()
+		objs = append(objs, node)
+	}
+	r := newTestReconciler(append(objs, newTestNode("node4", v1.ConditionTrue, nil))...)
+	node, result, err := reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if state := node.Annotations["fencing/state"]; state != "" || result.RequeueAfter <= 0 {
+		t.Errorf("node is %q with requeue after %v, want suspended", state, result.RequeueAfter)
+	}
+}
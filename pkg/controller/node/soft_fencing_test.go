@@ -0,0 +1,103 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSoftFencing(t *testing.T) {
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{
+		"fencing/enabled": "true",
+		"fencing/state":   "started",
+	})
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default"},
+		Spec:       v1.PodSpec{NodeName: "node1"},
+	}
+	ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+	r := newTestReconciler(node, pod, ns, newTestTemplate("fencing", map[string]string{"fencing/mode": "soft"}))
+
+	node, _, err := reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if state := node.Annotations["fencing/state"]; state != "fenced" {
+		t.Errorf("state is %q, want fenced", state)
+	}
+	if !node.Spec.Unschedulable {
+		t.Errorf("node is not cordoned")
+	}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "pod1"}, &v1.Pod{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("pod is not deleted: %v", err)
+	}
+	jobs := &batchv1.JobList{}
+	if err := r.client.List(context.TODO(), jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.Items) != 0 {
+		t.Errorf("%d fencing jobs are created, want none", len(jobs.Items))
+	}
+}
+
+func TestEscalation(t *testing.T) {
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{
+		"fencing/enabled": "true",
+		"fencing/state":   "started",
+	})
+	r := newTestReconciler(node, newTestTemplate("fencing", map[string]string{
+		"fencing/escalation":         "true",
+		"fencing/escalation-timeout": "1m",
+	}))
+
+	// Soft fencing is tried first
+	node, result, err := reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if state := node.Annotations["fencing/state"]; state != "fenced" {
+		t.Fatalf("state is %q, want fenced", state)
+	}
+	if result.RequeueAfter != time.Minute {
+		t.Errorf("requeue after %v, want the escalation timeout", result.RequeueAfter)
+	}
+	jobs := &batchv1.JobList{}
+	if err := r.client.List(context.TODO(), jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.Items) != 0 {
+		t.Fatalf("%d fencing jobs are created by soft fencing, want none", len(jobs.Items))
+	}
+
+	// Node did not recover in time
+	node.Annotations["fencing/escalation-deadline"] = strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	if err := r.client.Update(context.TODO(), node); err != nil {
+		t.Fatal(err)
+	}
+	node, _, err = reconcileNode(r, "node1")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if state := node.Annotations["fencing/state"]; state != "started" || node.Annotations["fencing/escalated"] != "true" {
+		t.Fatalf("state is %q escalated %q, want started escalated", state, node.Annotations["fencing/escalated"])
+	}
+
+	// Backend fences the node
+	if _, _, err := reconcileNode(r, "node1"); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if err := r.client.List(context.TODO(), jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.Items) != 1 {
+		t.Errorf("%d fencing jobs are created after escalation, want 1", len(jobs.Items))
+	}
+}
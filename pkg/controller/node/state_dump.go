@@ -0,0 +1,93 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+var (
+	// StateConfigMap is the name of ConfigMap in Namespace to dump the controller state to, empty disables it
+	StateConfigMap string
+)
+
+// nodeDump is the controller view of the node
+type nodeDump struct {
+	State       string `json:"state"`
+	InFlight    bool   `json:"inFlight"`
+	Attempts    string `json:"attempts,omitempty"`
+	LastAttempt string `json:"lastAttempt,omitempty"`
+}
+
+// stateDumper periodically writes the controller state to StateConfigMap
+type stateDumper struct {
+	r *ReconcileNode
+}
+
+// Start dumps the state every 30 seconds until stop is closed
+func (d *stateDumper) Start(stop <-chan struct{}) error {
+	wait.Until(d.dump, 30*time.Second, stop)
+	return nil
+}
+
+// dump writes the state of the tracked nodes, errors are only logged
+func (d *stateDumper) dump() {
+	states := d.r.states.snapshot()
+	inflight := d.r.inflight.snapshot()
+
+	nodes := &v1.NodeList{}
+	if err := d.r.client.List(context.TODO(), nodes); err != nil {
+		klog.Errorln("Failed to list nodes:", err)
+	}
+	annotations := map[string]map[string]string{}
+	for _, node := range nodes.Items {
+		annotations[node.Name] = node.Annotations
+	}
+
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	for name := range inflight {
+		if _, ok := states[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	data := map[string]string{}
+	for _, name := range names {
+		b, _ := json.Marshal(nodeDump{
+			State:       states[name],
+			InFlight:    inflight[name],
+			Attempts:    annotations[name]["fencing/attempts"],
+			LastAttempt: annotations[name]["fencing/last-attempt"],
+		})
+		data[name] = string(b)
+	}
+
+	configMaps := d.r.clientset.CoreV1().ConfigMaps(Namespace)
+	cm, err := configMaps.Get(StateConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: StateConfigMap, Namespace: Namespace}, Data: data}
+		if _, err := configMaps.Create(cm); err != nil {
+			klog.Errorln("Failed to create configmap", StateConfigMap, ":", err)
+		}
+		return
+	}
+	if err != nil {
+		klog.Errorln("Failed to get configmap", StateConfigMap, ":", err)
+		return
+	}
+	cm.Data = data
+	if _, err := configMaps.Update(cm); err != nil {
+		klog.Errorln("Failed to update configmap", StateConfigMap, ":", err)
+	}
+}
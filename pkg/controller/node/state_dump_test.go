@@ -0,0 +1,43 @@
+package node
+
+import (
+	"encoding/json"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStateDump(t *testing.T) {
+	defer func(v string) { StateConfigMap = v }(StateConfigMap)
+	StateConfigMap = "fencing-state"
+
+	r := newTestReconciler(newTestNode("node1", v1.ConditionUnknown, map[string]string{
+		"fencing/state":        "started",
+		"fencing/attempts":     "2",
+		"fencing/last-attempt": "1000",
+	}))
+	r.states.set("node1", "started")
+	defer r.states.set("node1", "")
+	d := &stateDumper{r: r}
+
+	// The ConfigMap is created and updated afterwards
+	for i := 0; i < 2; i++ {
+		d.dump()
+		cm, err := r.clientset.CoreV1().ConfigMaps(Namespace).Get(StateConfigMap, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("configmap is not written: %v", err)
+		}
+		if len(cm.Data) != 1 {
+			t.Errorf("configmap data is %v, want only node1", cm.Data)
+		}
+		dump := nodeDump{}
+		if err := json.Unmarshal([]byte(cm.Data["node1"]), &dump); err != nil {
+			t.Fatalf("node1 state %q is invalid: %v", cm.Data["node1"], err)
+		}
+		want := nodeDump{State: "started", Attempts: "2", LastAttempt: "1000"}
+		if dump != want {
+			t.Errorf("node1 state is %+v, want %+v", dump, want)
+		}
+	}
+}
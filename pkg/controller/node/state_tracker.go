@@ -0,0 +1,50 @@
+package node
+
+import (
+	"sync"
+
+	"github.com/kvaps/kube-fencing/pkg/metrics"
+)
+
+// stateTracker remembers the last seen fencing state of every node
+// and keeps kube_fencing_nodes metric in sync with it
+type stateTracker struct {
+	mu     sync.Mutex
+	states map[string]string
+}
+
+// newStateTracker returns a new stateTracker
+func newStateTracker() *stateTracker {
+	return &stateTracker{states: map[string]string{}}
+}
+
+// set records the fencing state of the node, empty state removes the node from tracking
+func (t *stateTracker) set(name, state string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	old, ok := t.states[name]
+	if ok && old == state {
+		return
+	}
+	if ok {
+		metrics.Nodes.WithLabelValues(old).Dec()
+		delete(t.states, name)
+	}
+	if state != "" {
+		metrics.Nodes.WithLabelValues(state).Inc()
+		t.states[name] = state
+	}
+}
+
+// snapshot returns a copy of the tracked states
+func (t *stateTracker) snapshot() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	states := make(map[string]string, len(t.states))
+	for k, v := range t.states {
+		states[k] = v
+	}
+	return states
+}
@@ -0,0 +1,80 @@
+package node
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestStateMetric(t *testing.T) {
+	states := []string{"pending", "started", "fenced"}
+	// gauges returns kube_fencing_nodes metric of the states
+	gauges := func() map[string]float64 {
+		values := map[string]float64{}
+		for _, state := range states {
+			values[state] = testutil.ToFloat64(metrics.Nodes.WithLabelValues(state))
+		}
+		return values
+	}
+
+	r := newTestReconciler(
+		newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true", "fencing/timeout": "60"}),
+		newTestTemplate("fencing", nil),
+	)
+	steps := []struct {
+		name   string
+		update func(node *v1.Node)
+		state  string
+		// delta is the change of the metric since the start of the test
+		delta map[string]float64
+	}{
+		{name: "failed node is pending", state: "pending", delta: map[string]float64{"pending": 1}},
+		{
+			name: "pending node is started",
+			update: func(node *v1.Node) {
+				node.Annotations["fencing/timestamp"] = strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10)
+			},
+			state: "started",
+			delta: map[string]float64{"started": 1},
+		},
+		{
+			name: "recovered node is not tracked",
+			update: func(node *v1.Node) {
+				node.Status.Conditions = newTestNode("node1", v1.ConditionTrue, nil).Status.Conditions
+			},
+			delta: map[string]float64{},
+		},
+	}
+	before := gauges()
+	for _, s := range steps {
+		if s.update != nil {
+			node := &v1.Node{}
+			if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "node1"}, node); err != nil {
+				t.Fatalf("get node failed: %v", err)
+			}
+			s.update(node)
+			if err := r.client.Update(context.TODO(), node); err != nil {
+				t.Fatalf("update node failed: %v", err)
+			}
+		}
+		node, _, err := reconcileNode(r, "node1")
+		if err != nil {
+			t.Fatalf("%s: reconcile failed: %v", s.name, err)
+		}
+		if state := node.Annotations["fencing/state"]; state != s.state {
+			t.Fatalf("%s: state is %q, want %q", s.name, state, s.state)
+		}
+		after := gauges()
+		for _, state := range states {
+			if delta := after[state] - before[state]; delta != s.delta[state] {
+				t.Errorf("%s: %s nodes changed by %v, want %v", s.name, state, delta, s.delta[state])
+			}
+		}
+	}
+}
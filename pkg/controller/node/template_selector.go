@@ -0,0 +1,89 @@
+package node
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// PoolLabel is the node label which value selects the PodTemplate labeled with fencing/pool=<value>
+	PoolLabel string
+)
+
+// templateCandidate is a PodTemplate matching the node
+type templateCandidate struct {
+	name string
+	// specificity is the number of selector requirements matched the node
+	specificity int
+}
+
+// selectTemplate returns the name of PodTemplate in the namespace selected for the node by its pool label
+// or fencing/node-selector annotation of PodTemplate, or empty string if there is no one.
+// The most specific selector wins, ties are broken by lexical order of names.
+func (r *ReconcileNode) selectTemplate(node *v1.Node, namespace string) (string, error) {
+	podTemplates := &v1.PodTemplateList{}
+	err := r.client.List(context.TODO(), podTemplates, client.InNamespace(namespace))
+	if err != nil {
+		return "", err
+	}
+
+	pool := ""
+	if PoolLabel != "" {
+		pool = node.Labels[PoolLabel]
+	}
+
+	var candidates []templateCandidate
+	for _, t := range podTemplates.Items {
+		if pool != "" && t.Labels["fencing/pool"] == pool {
+			candidates = append(candidates, templateCandidate{name: t.Name, specificity: 1})
+			continue
+		}
+		s, ok := t.Annotations["fencing/node-selector"]
+		if !ok {
+			continue
+		}
+		selector, err := labels.Parse(s)
+		if err != nil {
+			klog.Errorln("Failed to parse fencing/node-selector of podTemplate", t.Name, ":", err)
+			continue
+		}
+		if selector.Empty() || !selector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		reqs, _ := selector.Requirements()
+		candidates = append(candidates, templateCandidate{name: t.Name, specificity: len(reqs)})
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].specificity != candidates[j].specificity {
+			return candidates[i].specificity > candidates[j].specificity
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	chosen := candidates[0]
+
+	// Report ambiguity
+	var ambiguous []string
+	for _, c := range candidates {
+		if c.specificity == chosen.specificity {
+			ambiguous = append(ambiguous, c.name)
+		}
+	}
+	if len(ambiguous) > 1 {
+		message := "Multiple podTemplates match the node: " + strings.Join(ambiguous, ", ") + ", using " + chosen.name
+		klog.Warningln(message, "for node", node.Name)
+		r.recorder.Event(node, v1.EventTypeWarning, "AmbiguousTemplate", message)
+	}
+
+	klog.V(1).Infoln("Using podTemplate", chosen.name, "for node", node.Name)
+	return chosen.name, nil
+}
@@ -0,0 +1,161 @@
+package node
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// newSelectorTemplate returns the PodTemplate selecting the nodes by fencing/node-selector
+func newSelectorTemplate(name, selector string) *v1.PodTemplate {
+	return newTestTemplate(name, map[string]string{"fencing/node-selector": selector})
+}
+
+func TestSelectTemplate(t *testing.T) {
+	pool := newTestTemplate("pool-a", nil)
+	pool.Labels = map[string]string{"fencing/pool": "a"}
+
+	tests := []struct {
+		name      string
+		poolLabel string
+		templates []runtime.Object
+		template  string
+		ambiguous bool
+	}{
+		{name: "no templates"},
+		{name: "template without selector", templates: []runtime.Object{newTestTemplate("fencing", nil)}},
+		{name: "matching selector", templates: []runtime.Object{newSelectorTemplate("rack1", "rack=1")}, template: "rack1"},
+		{name: "not matching selector", templates: []runtime.Object{newSelectorTemplate("rack2", "rack=2")}},
+		{name: "empty selector", templates: []runtime.Object{newSelectorTemplate("all", "")}},
+		{name: "invalid selector", templates: []runtime.Object{newSelectorTemplate("invalid", "rack in (1")}},
+		{name: "most specific selector wins", templates: []runtime.Object{
+			newSelectorTemplate("rack1", "rack=1"),
+			newSelectorTemplate("rack1-ipmi", "rack=1,bmc=ipmi"),
+		}, template: "rack1-ipmi"},
+		{name: "ties are broken by name", templates: []runtime.Object{
+			newSelectorTemplate("rack1-b", "rack=1"),
+			newSelectorTemplate("rack1-a", "rack in (1,2)"),
+		}, template: "rack1-a", ambiguous: true},
+		{name: "pool label", poolLabel: "pool", templates: []runtime.Object{pool}, template: "pool-a"},
+		{name: "pool label is not set", templates: []runtime.Object{pool}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(poolLabel string) {
+				PoolLabel = poolLabel
+			}(PoolLabel)
+			PoolLabel = tt.poolLabel
+
+			node := newTestNode("node1", v1.ConditionUnknown, nil)
+			node.Labels = map[string]string{"rack": "1", "bmc": "ipmi", "pool": "a"}
+			r := newTestReconciler(tt.templates...)
+			template, err := r.selectTemplate(node, Namespace)
+			if err != nil {
+				t.Fatalf("select template failed: %v", err)
+			}
+			if template != tt.template {
+				t.Errorf("selected template is %q, want %q", template, tt.template)
+			}
+			events := r.recorder.(*record.FakeRecorder).Events
+			ambiguous := false
+			for len(events) > 0 {
+				if strings.Contains(<-events, "AmbiguousTemplate") {
+					ambiguous = true
+				}
+			}
+			if ambiguous != tt.ambiguous {
+				t.Errorf("ambiguity reported is %v, want %v", ambiguous, tt.ambiguous)
+			}
+		})
+	}
+}
+
+func TestGetPodTemplate(t *testing.T) {
+	inNamespace := func(template *v1.PodTemplate, namespace string) *v1.PodTemplate {
+		template.Namespace = namespace
+		return template
+	}
+	tests := []struct {
+		name       string
+		namespaces []string
+		node       map[string]string
+		templates  []runtime.Object
+		namespace  string
+		template   string
+		notFound   bool
+	}{
+		{name: "default template", templates: []runtime.Object{newTestTemplate("fencing", nil)}, namespace: Namespace, template: "fencing"},
+		{name: "template annotation", node: map[string]string{"fencing/template": "ipmi"}, templates: []runtime.Object{
+			newTestTemplate("fencing", nil),
+			newTestTemplate("ipmi", nil),
+		}, namespace: Namespace, template: "ipmi"},
+		{name: "template is not found", node: map[string]string{"fencing/template": "ipmi"}, templates: []runtime.Object{newTestTemplate("fencing", nil)}, notFound: true},
+		{name: "other namespaces are not searched by default", templates: []runtime.Object{inNamespace(newTestTemplate("fencing", nil), "rack1")}, notFound: true},
+		{name: "controller namespace is searched first", namespaces: []string{"rack1"}, templates: []runtime.Object{
+			newTestTemplate("fencing", nil),
+			inNamespace(newTestTemplate("fencing", nil), "rack1"),
+		}, namespace: Namespace, template: "fencing"},
+		{name: "template namespaces are searched in order", namespaces: []string{"rack1", "rack2"}, templates: []runtime.Object{
+			inNamespace(newTestTemplate("fencing", nil), "rack2"),
+		}, namespace: "rack2", template: "fencing"},
+		{name: "namespace annotation", namespaces: []string{"rack1", "rack2"}, node: map[string]string{"fencing/namespace": "rack2"}, templates: []runtime.Object{
+			newTestTemplate("fencing", nil),
+			inNamespace(newTestTemplate("fencing", nil), "rack2"),
+		}, namespace: "rack2", template: "fencing"},
+		{name: "namespace annotation outside template namespaces is ignored", namespaces: []string{"rack1"}, node: map[string]string{"fencing/namespace": "kube-system"}, templates: []runtime.Object{
+			newTestTemplate("fencing", nil),
+			inNamespace(newTestTemplate("fencing", nil), "kube-system"),
+		}, namespace: Namespace, template: "fencing"},
+		{name: "namespace annotation requires template namespaces", node: map[string]string{"fencing/namespace": "rack2"}, templates: []runtime.Object{
+			newTestTemplate("fencing", nil),
+			inNamespace(newTestTemplate("fencing", nil), "rack2"),
+		}, namespace: Namespace, template: "fencing"},
+		{name: "selector in template namespace", namespaces: []string{"rack1"}, templates: []runtime.Object{
+			inNamespace(newSelectorTemplate("rack1", "rack=1"), "rack1"),
+		}, namespace: "rack1", template: "rack1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(namespaces []string) {
+				TemplateNamespaces = namespaces
+			}(TemplateNamespaces)
+			TemplateNamespaces = tt.namespaces
+
+			node := newTestNode("node1", v1.ConditionUnknown, tt.node)
+			node.Labels = map[string]string{"rack": "1"}
+			r := newTestReconciler(tt.templates...)
+			podTemplate, err := r.getPodTemplate(node)
+			if tt.notFound {
+				if !errors.IsNotFound(err) {
+					t.Errorf("get template error is %v, want not found", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("get template failed: %v", err)
+			}
+			if podTemplate.Namespace != tt.namespace || podTemplate.Name != tt.template {
+				t.Errorf("template is %s/%s, want %s/%s", podTemplate.Namespace, podTemplate.Name, tt.namespace, tt.template)
+			}
+		})
+	}
+}
+
+func TestJobNamespace(t *testing.T) {
+	defer func(namespaces []string) {
+		TemplateNamespaces = namespaces
+	}(TemplateNamespaces)
+
+	TemplateNamespaces = nil
+	if namespace := jobNamespace(); namespace != Namespace {
+		t.Errorf("jobs are listed in %q, want %q", namespace, Namespace)
+	}
+	TemplateNamespaces = []string{"rack1"}
+	if namespace := jobNamespace(); namespace != v1.NamespaceAll {
+		t.Errorf("jobs are listed in %q, want all namespaces", namespace)
+	}
+}
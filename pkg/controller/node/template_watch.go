@@ -0,0 +1,53 @@
+package node
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// templateNodes returns the reconcile requests for the nodes using the changed PodTemplate,
+// so the nodes which failed to find or validate it are re-examined after the fix
+func (r *ReconcileNode) templateNodes(obj handler.MapObject) []reconcile.Request {
+	nodes := &v1.NodeList{}
+	if err := r.client.List(context.TODO(), nodes); err != nil {
+		klog.Errorln("Failed to list nodes for podTemplate", obj.Meta.GetName(), ":", err)
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if r.usesTemplate(node, obj.Meta.GetNamespace(), obj.Meta.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: node.Name}})
+		}
+	}
+	return requests
+}
+
+// usesTemplate reports if the node is fenced using the PodTemplate with the name from the namespace
+func (r *ReconcileNode) usesTemplate(node *v1.Node, namespace, name string) bool {
+	for _, ns := range templateNamespaces(node) {
+		if ns != namespace {
+			continue
+		}
+		templateName, ok := node.Annotations["fencing/template"]
+		if !ok {
+			templateName, ok = r.nodeConfig(node)["fencing/template"]
+		}
+		if !ok {
+			var err error
+			if templateName, err = r.selectTemplate(node, ns); err != nil {
+				return false
+			}
+		}
+		if templateName == "" {
+			templateName = "fencing"
+		}
+		return templateName == name
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package node
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestTemplateNodes(t *testing.T) {
+	node3 := newTestNode("node3", v1.ConditionTrue, nil)
+	node3.Labels = map[string]string{"rack": "1"}
+	r := newTestReconciler(
+		newTestNode("node1", v1.ConditionTrue, nil),
+		newTestNode("node2", v1.ConditionTrue, map[string]string{"fencing/template": "ipmi"}),
+		node3,
+		newTestNode("node4", v1.ConditionTrue, map[string]string{"fencing/config-ref": "redfish"}),
+		newSelectorTemplate("rack1", "rack=1"),
+		newTestConfig("redfish", Namespace, map[string]string{"template": "redfish"}),
+	)
+	request := func(name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+	}
+	tests := []struct {
+		name      string
+		template  *v1.PodTemplate
+		namespace string
+		requests  []reconcile.Request
+	}{
+		{name: "default template", template: newTestTemplate("fencing", nil), requests: []reconcile.Request{request("node1")}},
+		{name: "template annotation", template: newTestTemplate("ipmi", nil), requests: []reconcile.Request{request("node2")}},
+		{name: "selected template", template: newSelectorTemplate("rack1", "rack=1"), requests: []reconcile.Request{request("node3")}},
+		{name: "template from config-ref", template: newTestTemplate("redfish", nil), requests: []reconcile.Request{request("node4")}},
+		{name: "unused template", template: newTestTemplate("snmp", nil)},
+		{name: "template of other namespace", template: newTestTemplate("fencing", nil), namespace: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.namespace != "" {
+				tt.template.Namespace = tt.namespace
+			}
+			requests := r.templateNodes(handler.MapObject{Meta: tt.template, Object: tt.template})
+			if !reflect.DeepEqual(requests, tt.requests) {
+				t.Errorf("requests are %v, want %v", requests, tt.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package node
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// Tracer starts the reconcile spans, the default one records nothing
+	Tracer = trace.NewNoopTracerProvider().Tracer("")
+)
+
+// spanTracker holds the spans of the nodes being reconciled, so the decisions and the job calls are recorded on them.
+// A node is reconciled by a single worker at a time, see inflight.
+type spanTracker struct {
+	mu    sync.Mutex
+	spans map[string]trace.Span
+}
+
+// newSpanTracker returns an empty spanTracker
+func newSpanTracker() *spanTracker {
+	return &spanTracker{spans: map[string]trace.Span{}}
+}
+
+// start starts the reconcile span of the node, the action is none until a decision is recorded
+func (t *spanTracker) start(name string) trace.Span {
+	_, span := Tracer.Start(context.Background(), "Reconcile", trace.WithAttributes(
+		attribute.String("fencing.node", name),
+		attribute.String("fencing.action", "none"),
+	))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans[name] = span
+	return span
+}
+
+// end ends the reconcile span of the node
+func (t *spanTracker) end(name string, err error) {
+	t.mu.Lock()
+	span := t.spans[name]
+	delete(t.spans, name)
+	t.mu.Unlock()
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// setAction records the decision made for the node on its reconcile span
+func (t *spanTracker) setAction(name, action string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if span := t.spans[name]; span != nil {
+		span.SetAttributes(attribute.String("fencing.action", action))
+	}
+}
+
+// startChild starts the span of the call made while reconciling the node
+func (t *spanTracker) startChild(ctx context.Context, name, call string) (context.Context, trace.Span) {
+	t.mu.Lock()
+	parent := t.spans[name]
+	t.mu.Unlock()
+	if parent != nil {
+		ctx = trace.ContextWithSpan(ctx, parent)
+	}
+	return Tracer.Start(ctx, call, trace.WithAttributes(attribute.String("fencing.node", name)))
+}
+
+// createJob creates the fencing job of the node within the child span
+func (r *ReconcileNode) createJob(ctx context.Context, node string, job *batchv1.Job) error {
+	ctx, span := r.spans.startChild(ctx, node, "CreateJob")
+	defer span.End()
+	err := r.client.Create(ctx, job)
+	span.SetAttributes(attribute.String("fencing.job", job.Name))
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// deleteJob deletes the fencing job of the node with its pods in background within the child span
+func (r *ReconcileNode) deleteJob(ctx context.Context, node string, job *batchv1.Job) error {
+	ctx, span := r.spans.startChild(ctx, node, "DeleteJob")
+	defer span.End()
+	err := r.client.Delete(ctx, job,
+		client.GracePeriodSeconds(0),
+		client.PropagationPolicy(metav1.DeletePropagationBackground),
+	)
+	span.SetAttributes(attribute.String("fencing.job", job.Name))
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package node
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestReconcileSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	defer func(tracer trace.Tracer) {
+		Tracer = tracer
+	}(Tracer)
+	Tracer = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	r := newTestReconciler(
+		newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/enabled": "true"}),
+		newTestNode("node2", v1.ConditionTrue, map[string]string{"fencing/enabled": "true"}),
+		newTestTemplate("fencing", nil),
+	)
+
+	tests := []struct {
+		node   string
+		spans  []string
+		action string
+	}{
+		// Failed node is started to fence
+		{node: "node1", spans: []string{"Reconcile"}, action: "start"},
+		// Fencing job is created within the reconcile
+		{node: "node1", spans: []string{"CreateJob", "Reconcile"}, action: "fence"},
+		// Running job is waited for
+		{node: "node1", spans: []string{"Reconcile"}, action: "none"},
+		// Nothing is done for healthy node
+		{node: "node2", spans: []string{"Reconcile"}, action: "none"},
+	}
+	for i, tt := range tests {
+		exporter.Reset()
+		if _, _, err := reconcileNode(r, tt.node); err != nil {
+			t.Fatalf("%d: reconcile failed: %v", i, err)
+		}
+		spans := exporter.GetSpans()
+		if len(spans) != len(tt.spans) {
+			t.Fatalf("%d: got %d spans, want %v", i, len(spans), tt.spans)
+		}
+		root := spans[len(spans)-1]
+		for j, name := range tt.spans {
+			if spans[j].Name != name {
+				t.Errorf("%d: span %d is %q, want %q", i, j, spans[j].Name, name)
+			}
+			if j < len(spans)-1 && spans[j].Parent.SpanID() != root.SpanContext.SpanID() {
+				t.Errorf("%d: span %q is not a child of the reconcile span", i, name)
+			}
+		}
+		attrs := map[attribute.Key]string{}
+		for _, kv := range root.Attributes {
+			attrs[kv.Key] = kv.Value.AsString()
+		}
+		if attrs["fencing.node"] != tt.node {
+			t.Errorf("%d: fencing.node is %q, want %q", i, attrs["fencing.node"], tt.node)
+		}
+		if attrs["fencing.action"] != tt.action {
+			t.Errorf("%d: fencing.action is %q, want %q", i, attrs["fencing.action"], tt.action)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package node
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// durationOptions are the annotations containing Go duration or integer seconds
+var durationOptions = []string{
+	"fencing/timeout",
+	"fencing/drain-timeout",
+	"fencing/cooldown",
+	"fencing/post-fence-wait",
+	"fencing/reschedule-timeout",
+	"fencing/backoff",
+	"fencing/backoff-max",
+	"fencing/redfish-timeout",
+	"fencing/recovery-stability",
+	"fencing/overall-deadline",
+	"fencing/lease-threshold",
+	"fencing/heartbeat-threshold",
+	"fencing/cleanup-ttl",
+	"fencing/escalation-timeout",
+}
+
+// intOptions are the annotations containing integers
+var intOptions = []string{
+	"fencing/parallelism",
+	"fencing/completions",
+	"fencing/pod-grace-period",
+	"fencing/priority",
+	"fencing/max-concurrent",
+	"fencing/max-attempts",
+}
+
+// ValidatePodTemplate checks that the podTemplate can be used to create a fencing Job
+func ValidatePodTemplate(podTemplate *v1.PodTemplate) error {
+	return ValidateOptions(&v1.Node{}, podTemplate)
+}
+
+// ValidateOptions checks the podTemplate and fencing options of the node and podTemplate,
+// all found problems are returned as a single aggregated error
+func ValidateOptions(node *v1.Node, podTemplate *v1.PodTemplate) error {
+	var errs []error
+
+	spec := podTemplate.Template.Spec
+	if len(spec.Containers) == 0 {
+		errs = append(errs, fmt.Errorf("no containers specified"))
+	}
+	switch spec.RestartPolicy {
+	case v1.RestartPolicyNever, v1.RestartPolicyOnFailure, v1.RestartPolicyAlways, "":
+	default:
+		errs = append(errs, fmt.Errorf("restartPolicy %q is not supported, use Never or OnFailure", spec.RestartPolicy))
+	}
+
+	if mode, ok := getAnnotation(node, podTemplate, "fencing/mode"); ok {
+		switch mode {
+		case "", "none", "flush", "delete", "soft":
+		default:
+			errs = append(errs, fmt.Errorf("unknown fencing/mode %q", mode))
+		}
+	}
+	if backend, ok := getAnnotation(node, podTemplate, "fencing/backend"); ok {
+		switch backend {
+		case "", "job", "redfish", "ipmi", "webhook":
+		default:
+			if _, ok := fencers[backend]; !ok {
+				errs = append(errs, fmt.Errorf("unknown fencing/backend %q", backend))
+			}
+		}
+	}
+	if policy, ok := getAnnotation(node, podTemplate, "fencing/cleanup-policy"); ok {
+		switch policy {
+		case "", "on-recovery", "ttl", "keep":
+		default:
+			errs = append(errs, fmt.Errorf("unknown fencing/cleanup-policy %q", policy))
+		}
+	}
+	if action, ok := getAnnotation(node, podTemplate, "fencing/action"); ok {
+		switch action {
+		case "off", "reboot":
+		default:
+			errs = append(errs, fmt.Errorf("unknown fencing/action %q", action))
+		}
+	}
+	for _, k := range durationOptions {
+		if v, ok := getAnnotation(node, podTemplate, k); ok {
+			if _, err := util.ParseDuration(v); err != nil {
+				errs = append(errs, fmt.Errorf("failed to parse %s: %v", k, err))
+			}
+		}
+	}
+	for _, k := range intOptions {
+		if v, ok := getAnnotation(node, podTemplate, k); ok {
+			if _, err := strconv.Atoi(v); err != nil {
+				errs = append(errs, fmt.Errorf("failed to parse %s: %v", k, err))
+			}
+		}
+	}
+	if v, ok := getAnnotation(node, podTemplate, "fencing/success-exit-codes"); ok {
+		if _, err := util.ParseExitCodes(v); err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse fencing/success-exit-codes: %v", err))
+		}
+	}
+	if prefix, ok := getAnnotation(node, podTemplate, "fencing/job-prefix"); ok {
+		if msgs := validation.IsDNS1123Label(prefix); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid fencing/job-prefix %q: %s", prefix, strings.Join(msgs, ", ")))
+		}
+	}
+	if _, err := renderJobName(node, podTemplate); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,63 @@
+package node
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestValidateOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		node          map[string]string
+		template      map[string]string
+		restartPolicy v1.RestartPolicy
+		noContainers  bool
+		errs          int
+	}{
+		{name: "valid options", node: map[string]string{"fencing/mode": "delete", "fencing/timeout": "5m"},
+			template: map[string]string{"fencing/backend": "redfish", "fencing/action": "reboot", "fencing/max-attempts": "3", "fencing/success-exit-codes": "3,10-12"}},
+		{name: "restartPolicy Always is overridden", restartPolicy: v1.RestartPolicyAlways},
+		{name: "no containers", noContainers: true, errs: 1},
+		{name: "unsupported restartPolicy", restartPolicy: "Sometimes", errs: 1},
+		{name: "unknown mode", node: map[string]string{"fencing/mode": "reboot"}, errs: 1},
+		{name: "unknown backend", template: map[string]string{"fencing/backend": "snmp"}, errs: 1},
+		{name: "unknown cleanup-policy", template: map[string]string{"fencing/cleanup-policy": "never"}, errs: 1},
+		{name: "unknown action", template: map[string]string{"fencing/action": "on"}, errs: 1},
+		{name: "invalid duration", node: map[string]string{"fencing/backoff": "soon"}, errs: 1},
+		{name: "invalid integer", node: map[string]string{"fencing/priority": "high"}, errs: 1},
+		{name: "invalid exit codes", template: map[string]string{"fencing/success-exit-codes": "3-1"}, errs: 1},
+		{name: "invalid job-prefix", template: map[string]string{"fencing/job-prefix": "Fence_"}, errs: 1},
+		{name: "invalid job-name-template", template: map[string]string{"fencing/job-name-template": "{{ .Name"}, errs: 1},
+		{name: "node overrides invalid podTemplate option", node: map[string]string{"fencing/mode": "flush"}, template: map[string]string{"fencing/mode": "unknown"}},
+		{name: "all problems are reported", noContainers: true, node: map[string]string{"fencing/mode": "reboot", "fencing/timeout": "soon"},
+			template: map[string]string{"fencing/max-attempts": "many", "fencing/action": "on"}, errs: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode("node1", v1.ConditionUnknown, tt.node)
+			podTemplate := newTestTemplate("fencing", tt.template)
+			if tt.restartPolicy != "" {
+				podTemplate.Template.Spec.RestartPolicy = tt.restartPolicy
+			}
+			if tt.noContainers {
+				podTemplate.Template.Spec.Containers = nil
+			}
+			err := ValidateOptions(node, podTemplate)
+			if tt.errs == 0 {
+				if err != nil {
+					t.Errorf("valid options are rejected: %v", err)
+				}
+				return
+			}
+			agg, ok := err.(utilerrors.Aggregate)
+			if !ok {
+				t.Fatalf("error is %v, want aggregate of %d errors", err, tt.errs)
+			}
+			if len(agg.Errors()) != tt.errs {
+				t.Errorf("%d problems are reported, want %d: %v", len(agg.Errors()), tt.errs, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package node
+
+import (
+	"sync"
+	"time"
+)
+
+// waitingTTL is the period the node deferred by concurrency limit is considered waiting for a fencing slot,
+// deferred nodes are rechecked every 30 seconds and refresh it, so the nodes which stopped waiting expire
+const waitingTTL = 2 * time.Minute
+
+// waitingNode is the node waiting for a fencing slot
+type waitingNode struct {
+	priority int
+	seen     time.Time
+}
+
+// waitQueue remembers the nodes deferred by concurrency limit with their fencing/priority,
+// so the priority of other nodes is not resolved on every reconcile
+type waitQueue struct {
+	mu    sync.Mutex
+	nodes map[string]waitingNode
+}
+
+// newWaitQueue returns a new waitQueue
+func newWaitQueue() *waitQueue {
+	return &waitQueue{nodes: map[string]waitingNode{}}
+}
+
+// wait records the node waiting for a fencing slot
+func (q *waitQueue) wait(name string, priority int, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nodes[name] = waitingNode{priority: priority, seen: now}
+}
+
+// leave removes the node which does not wait for a fencing slot anymore
+func (q *waitQueue) leave(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.nodes, name)
+}
+
+// countPrior returns the number of nodes waiting before the node, nodes with higher priority go first,
+// ties are broken by name. Active nodes occupy their slots already and are not counted.
+func (q *waitQueue) countPrior(name string, priority int, active map[string]bool, now time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	prior := 0
+	for n, w := range q.nodes {
+		if now.Sub(w.seen) > waitingTTL {
+			delete(q.nodes, n)
+			continue
+		}
+		if _, ok := active[n]; ok || n == name {
+			continue
+		}
+		if w.priority > priority || (w.priority == priority && n < name) {
+			prior++
+		}
+	}
+	return prior
+}
@@ -0,0 +1,81 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestWaitQueue(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		node     string
+		priority int
+		active   map[string]bool
+		prior    int
+	}{
+		{name: "highest priority goes first", node: "node3", priority: 10, prior: 0},
+		{name: "higher priority nodes go before", node: "node0", priority: 0, prior: 2},
+		{name: "ties are broken by name", node: "node2", priority: 5, prior: 1},
+		{name: "waiting node does not count itself", node: "node1", priority: 5, prior: 0},
+		{name: "active nodes are not counted", node: "node4", priority: 0, active: map[string]bool{"node1": true}, prior: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newWaitQueue()
+			q.wait("node1", 5, now)
+			q.wait("node2", 5, now)
+			q.wait("stale", 100, now.Add(-waitingTTL-time.Second))
+			if prior := q.countPrior(tt.node, tt.priority, tt.active, now); prior != tt.prior {
+				t.Errorf("%d nodes are waiting before, want %d", prior, tt.prior)
+			}
+			if _, ok := q.nodes["stale"]; ok {
+				t.Errorf("expired node is not removed")
+			}
+		})
+	}
+}
+
+func TestWaitQueueLeave(t *testing.T) {
+	now := time.Now()
+	q := newWaitQueue()
+	q.wait("node1", 5, now)
+	q.leave("node1")
+	if prior := q.countPrior("node2", 0, nil, now); prior != 0 {
+		t.Errorf("%d nodes are waiting before, want 0", prior)
+	}
+}
+
+func TestCheckLimitsPriority(t *testing.T) {
+	defer func(maxConcurrent int) {
+		MaxConcurrentFences = maxConcurrent
+	}(MaxConcurrentFences)
+	MaxConcurrentFences = 2
+
+	low := newTestNode("low", v1.ConditionUnknown, nil)
+	high := newTestNode("high", v1.ConditionUnknown, map[string]string{"fencing/priority": "10"})
+	podTemplate := newTestTemplate("fencing", nil)
+	r := newTestReconciler(low, high, podTemplate, newTestJob("fence-node1", "node1", "fence"))
+	r.waiting.wait("high", 10, time.Now())
+
+	limit, err := r.checkLimits(context.TODO(), low, podTemplate)
+	if err != nil {
+		t.Fatalf("check limits failed: %v", err)
+	}
+	if limit != "priority" {
+		t.Errorf("lower priority node is deferred by %q, want priority", limit)
+	}
+	limit, err = r.checkLimits(context.TODO(), high, podTemplate)
+	if err != nil {
+		t.Fatalf("check limits failed: %v", err)
+	}
+	if limit != "" {
+		t.Errorf("higher priority node is deferred by %q", limit)
+	}
+	if _, ok := r.waiting.nodes["high"]; ok {
+		t.Errorf("node taking the slot still waits")
+	}
+}
@@ -0,0 +1,215 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// webhookPollInterval is the interval of polling the status URL of asynchronous fencing
+const webhookPollInterval = 10 * time.Second
+
+// webhookRequest is the body posted to the fencing webhook
+type webhookRequest struct {
+	Node        string            `json:"node"`
+	ID          string            `json:"id"`
+	Address     string            `json:"address,omitempty"`
+	Action      string            `json:"action"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// webhookResponse is the response of the fencing webhook and its status URL
+type webhookResponse struct {
+	// StatusURL is returned with 202 Accepted for asynchronous fencing
+	StatusURL string `json:"statusURL,omitempty"`
+	// State is returned by the status URL: pending, fenced or failed
+	State string `json:"state,omitempty"`
+	// Message describes the failure
+	Message string `json:"message,omitempty"`
+}
+
+// webhookFencer fences the node by calling external HTTP endpoint
+type webhookFencer struct {
+	r      *ReconcileNode
+	client *http.Client
+}
+
+// Fence posts the node to fencing/webhook-url, 2xx response means the node is fenced,
+// 202 Accepted with statusURL starts polling of the status URL until it reports fenced or failed state
+func (f *webhookFencer) Fence(ctx context.Context, node *v1.Node) (FenceResult, error) {
+	podTemplate, err := f.r.getPodTemplate(node)
+	if err != nil {
+		return FenceResult{}, err
+	}
+
+	// Poll the status of asynchronous fencing
+	if statusURL, ok := node.Annotations["fencing/webhook-status-url"]; ok {
+		if err := checkStatusURL(podTemplate, statusURL); err != nil {
+			klog.Errorln("Refusing status URL of node", node.Name, ":", err)
+			if patchErr := f.setStatusURL(ctx, node, nil); patchErr != nil {
+				return FenceResult{}, patchErr
+			}
+			return FenceResult{}, err
+		}
+		resp := webhookResponse{}
+		if _, err := f.do(ctx, http.MethodGet, statusURL, nil, &resp); err != nil {
+			return FenceResult{}, err
+		}
+		switch resp.State {
+		case "fenced":
+			return FenceResult{Fenced: true}, f.setStatusURL(ctx, node, nil)
+		case "failed":
+			if err := f.setStatusURL(ctx, node, nil); err != nil {
+				return FenceResult{}, err
+			}
+			return FenceResult{}, fmt.Errorf("fencing webhook failed: %s", resp.Message)
+		default:
+			return FenceResult{RequeueAfter: webhookPollInterval}, nil
+		}
+	}
+
+	// The URL is never taken from the node, so it can not make the controller call arbitrary endpoints
+	url := podTemplate.Annotations["fencing/webhook-url"]
+	if url == "" {
+		return FenceResult{}, fmt.Errorf("fencing/webhook-url is not specified")
+	}
+
+	// Pass the resolved fencing options
+	annotations := map[string]string{}
+	for k, v := range podTemplate.Annotations {
+		if strings.HasPrefix(k, "fencing/") {
+			annotations[k] = v
+		}
+	}
+	for k, v := range node.Annotations {
+		if strings.HasPrefix(k, "fencing/") {
+			annotations[k] = v
+		}
+	}
+	id, ok := getAnnotation(node, podTemplate, "fencing/id")
+	if !ok {
+		id = node.Name
+	}
+	body, _ := json.Marshal(webhookRequest{
+		Node:        node.Name,
+		ID:          id,
+		Address:     resolveAddress(node, podTemplate, "fencing/address"),
+		Action:      fencingAction(node, podTemplate),
+		Annotations: annotations,
+	})
+
+	klog.Infoln("Fencing node", node.Name, "via webhook", url)
+	resp := webhookResponse{}
+	code, err := f.do(ctx, http.MethodPost, url, body, &resp)
+	if err != nil {
+		return FenceResult{Started: true}, err
+	}
+	if code == http.StatusAccepted && resp.StatusURL != "" {
+		return FenceResult{RequeueAfter: webhookPollInterval, Started: true}, f.setStatusURL(ctx, node, resp.StatusURL)
+	}
+	return FenceResult{Fenced: true, Started: true}, nil
+}
+
+// InProgress returns true while the status URL of asynchronous fencing is polled,
+// a status URL not matching fencing/webhook-url is not counted
+func (f *webhookFencer) InProgress(ctx context.Context, node *v1.Node) (bool, error) {
+	statusURL, ok := node.Annotations["fencing/webhook-status-url"]
+	if !ok {
+		return false, nil
+	}
+	podTemplate, err := f.r.getPodTemplate(node)
+	if err != nil {
+		return false, err
+	}
+	return checkStatusURL(podTemplate, statusURL) == nil, nil
+}
+
+// Cancel sends DELETE to the status URL of asynchronous fencing in progress, the failure is only logged
+// as the webhook may not support cancellation
+func (f *webhookFencer) Cancel(ctx context.Context, node *v1.Node) error {
+	statusURL, ok := node.Annotations["fencing/webhook-status-url"]
+	if !ok {
+		return nil
+	}
+	podTemplate, err := f.r.getPodTemplate(node)
+	if err == nil {
+		err = checkStatusURL(podTemplate, statusURL)
+	}
+	if err != nil {
+		klog.Errorln("Refusing status URL of node", node.Name, ":", err)
+		return f.setStatusURL(ctx, node, nil)
+	}
+	klog.Infoln("Cancelling fencing of node", node.Name, "via webhook", statusURL)
+	if _, err := f.do(ctx, http.MethodDelete, statusURL, nil, &webhookResponse{}); err != nil {
+		klog.Errorln("Failed to cancel fencing of node", node.Name, ":", err)
+	}
+	return f.setStatusURL(ctx, node, nil)
+}
+
+// checkStatusURL returns an error unless the status URL has the same scheme and host as fencing/webhook-url,
+// the status URL is recorded on the node, so the node could point it anywhere
+func checkStatusURL(podTemplate *v1.PodTemplate, statusURL string) error {
+	webhookURL, err := url.Parse(podTemplate.Annotations["fencing/webhook-url"])
+	if err != nil || webhookURL.Host == "" {
+		return fmt.Errorf("fencing/webhook-url is not valid")
+	}
+	u, err := url.Parse(statusURL)
+	if err != nil {
+		return fmt.Errorf("status URL %q is not valid: %v", statusURL, err)
+	}
+	if !strings.EqualFold(u.Scheme, webhookURL.Scheme) || !strings.EqualFold(u.Host, webhookURL.Host) {
+		return fmt.Errorf("status URL %q does not match fencing/webhook-url", statusURL)
+	}
+	return nil
+}
+
+// do sends the request and decodes the JSON response, non-2xx responses are returned as errors
+func (f *webhookFencer) do(ctx context.Context, method, url string, body []byte, out *webhookResponse) (int, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("fencing webhook %s responded with status %s", url, resp.Status)
+	}
+	if resp.ContentLength != 0 {
+		// Empty or non-JSON body of synchronous response is fine
+		_ = json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode, nil
+}
+
+// setStatusURL records the status URL of asynchronous fencing on the node, nil removes it
+func (f *webhookFencer) setStatusURL(ctx context.Context, node *v1.Node, statusURL interface{}) error {
+	if statusURL != nil {
+		podTemplate, err := f.r.getPodTemplate(node)
+		if err != nil {
+			return err
+		}
+		if err := checkStatusURL(podTemplate, statusURL.(string)); err != nil {
+			return err
+		}
+	}
+	err := util.PatchNodeAnnotations(ctx, f.r.client, node, map[string]interface{}{
+		"fencing/webhook-status-url": statusURL,
+	})
+	if err != nil {
+		klog.Errorln("Failed to patch node", node.Name, ":", err)
+	}
+	return err
+}
@@ -0,0 +1,220 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fakeWebhook serves the fencing webhook and its status URL
+type fakeWebhook struct {
+	code     int
+	async    bool
+	state    string
+	requests []webhookRequest
+	deleted  bool
+	url      string
+}
+
+func (h *fakeWebhook) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.Method == http.MethodPost && req.URL.Path == "/fence":
+		body := webhookRequest{}
+		json.NewDecoder(req.Body).Decode(&body)
+		h.requests = append(h.requests, body)
+		if h.async {
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(webhookResponse{StatusURL: h.url + "/status"})
+			return
+		}
+		w.WriteHeader(h.code)
+	case req.Method == http.MethodGet && req.URL.Path == "/status":
+		json.NewEncoder(w).Encode(webhookResponse{State: h.state, Message: "bmc is unreachable"})
+	case req.Method == http.MethodDelete && req.URL.Path == "/status":
+		h.deleted = true
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestWebhookFence(t *testing.T) {
+	tests := []struct {
+		name      string
+		webhook   fakeWebhook
+		polling   bool
+		noURL     bool
+		nodeURL   bool
+		result    FenceResult
+		err       bool
+		requests  int
+		statusURL bool
+	}{
+		{name: "webhook url is not specified", noURL: true, err: true},
+		{name: "webhook url is not taken from node", noURL: true, nodeURL: true, err: true},
+		{name: "synchronous fencing", webhook: fakeWebhook{code: http.StatusOK}, result: FenceResult{Fenced: true, Started: true}, requests: 1},
+		{name: "failed fencing counts the attempt", webhook: fakeWebhook{code: http.StatusInternalServerError}, result: FenceResult{Started: true}, err: true, requests: 1},
+		{name: "asynchronous fencing is started", webhook: fakeWebhook{async: true}, result: FenceResult{Started: true, RequeueAfter: webhookPollInterval}, requests: 1, statusURL: true},
+		{name: "asynchronous fencing is pending", webhook: fakeWebhook{state: "pending"}, polling: true, result: FenceResult{RequeueAfter: webhookPollInterval}, statusURL: true},
+		{name: "asynchronous fencing succeeded", webhook: fakeWebhook{state: "fenced"}, polling: true, result: FenceResult{Fenced: true}},
+		{name: "asynchronous fencing failed", webhook: fakeWebhook{state: "failed"}, polling: true, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := tt.webhook
+			server := httptest.NewServer(&webhook)
+			defer server.Close()
+			webhook.url = server.URL
+
+			annotations := map[string]string{"fencing/backend": "webhook", "fencing/mode": "none"}
+			if tt.polling {
+				annotations["fencing/webhook-status-url"] = server.URL + "/status"
+			}
+			template := map[string]string{"fencing/mode": "flush", "fencing/action": "off"}
+			if !tt.noURL {
+				template["fencing/webhook-url"] = server.URL + "/fence"
+			}
+			if tt.nodeURL {
+				annotations["fencing/webhook-url"] = server.URL + "/fence"
+			}
+			node := newTestNode("node1", v1.ConditionUnknown, annotations)
+			r := newTestReconciler(node, newTestTemplate("fencing", template))
+
+			result, err := r.fencers["webhook"].Fence(context.TODO(), node)
+			if (err != nil) != tt.err {
+				t.Errorf("fence error is %v, want error %v", err, tt.err)
+			}
+			if result != tt.result {
+				t.Errorf("result is %+v, want %+v", result, tt.result)
+			}
+			if len(webhook.requests) != tt.requests {
+				t.Fatalf("webhook is called %d times, want %d", len(webhook.requests), tt.requests)
+			}
+			if tt.requests > 0 {
+				req := webhook.requests[0]
+				if req.Node != "node1" || req.ID != "node1" || req.Action != "off" {
+					t.Errorf("request is %+v, want node1 to be powered off", req)
+				}
+				// Node annotations override podTemplate ones
+				if req.Annotations["fencing/mode"] != "none" || req.Annotations["fencing/webhook-url"] == "" {
+					t.Errorf("request annotations are %v", req.Annotations)
+				}
+			}
+			stored := &v1.Node{}
+			if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "node1"}, stored); err != nil {
+				t.Fatalf("get node failed: %v", err)
+			}
+			if _, statusURL := stored.Annotations["fencing/webhook-status-url"]; statusURL != tt.statusURL {
+				t.Errorf("status URL recorded is %v, want %v", statusURL, tt.statusURL)
+			}
+		})
+	}
+}
+
+func TestWebhookCancel(t *testing.T) {
+	webhook := &fakeWebhook{}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	node := newTestNode("node1", v1.ConditionTrue, map[string]string{"fencing/webhook-status-url": server.URL + "/status"})
+	r := newTestReconciler(node, newTestTemplate("fencing", map[string]string{"fencing/webhook-url": server.URL + "/fence"}))
+	if err := r.fencers["webhook"].Cancel(context.TODO(), node); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	if !webhook.deleted {
+		t.Errorf("fencing is not cancelled via status URL")
+	}
+	stored := &v1.Node{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "node1"}, stored); err != nil {
+		t.Fatalf("get node failed: %v", err)
+	}
+	if _, ok := stored.Annotations["fencing/webhook-status-url"]; ok {
+		t.Errorf("status URL is not removed")
+	}
+}
+
+func TestWebhookForgedStatusURL(t *testing.T) {
+	webhook := &fakeWebhook{}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+	// The node rewrites the status URL to point at the server always answering fenced
+	forged := &fakeWebhook{state: "fenced"}
+	forgedServer := httptest.NewServer(forged)
+	defer forgedServer.Close()
+
+	template := newTestTemplate("fencing", map[string]string{"fencing/webhook-url": server.URL + "/fence"})
+	node := newTestNode("node1", v1.ConditionUnknown, map[string]string{"fencing/webhook-status-url": forgedServer.URL + "/status"})
+	r := newTestReconciler(node, template)
+	f := r.fencers["webhook"].(*webhookFencer)
+
+	if inProgress, err := f.InProgress(context.TODO(), node); err != nil || inProgress {
+		t.Errorf("forged status URL is in progress %v (error %v), want false", inProgress, err)
+	}
+	result, err := f.Fence(context.TODO(), node)
+	if err == nil || result.Fenced {
+		t.Errorf("fence with forged status URL is %+v (error %v), want refused", result, err)
+	}
+	if err := f.Cancel(context.TODO(), node); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	if forged.deleted {
+		t.Errorf("forged status URL is called on cancel")
+	}
+	stored := &v1.Node{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "node1"}, stored); err != nil {
+		t.Fatalf("get node failed: %v", err)
+	}
+	if _, ok := stored.Annotations["fencing/webhook-status-url"]; ok {
+		t.Errorf("forged status URL is not removed")
+	}
+
+	// The status URL returned by the webhook is refused as well unless it matches fencing/webhook-url
+	if err := f.setStatusURL(context.TODO(), stored, forgedServer.URL+"/status"); err == nil {
+		t.Errorf("forged status URL is stored")
+	}
+}
+
+func TestBackendAttempts(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts string
+		attempts    string
+		state       string
+	}{
+		{name: "failed attempt is retried", attempts: "1", state: "started"},
+		{name: "attempts are exhausted", maxAttempts: "2", attempts: "2", state: "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := &fakeWebhook{code: http.StatusBadGateway}
+			server := httptest.NewServer(webhook)
+			defer server.Close()
+
+			annotations := map[string]string{
+				"fencing/enabled": "true",
+				"fencing/state":   "started",
+				"fencing/backend": "webhook",
+			}
+			if tt.maxAttempts != "" {
+				annotations["fencing/max-attempts"] = tt.maxAttempts
+				annotations["fencing/attempts"] = "1"
+			}
+			template := newTestTemplate("fencing", map[string]string{"fencing/webhook-url": server.URL + "/fence"})
+			r := newTestReconciler(newTestNode("node1", v1.ConditionUnknown, annotations), template)
+			node, _, _ := reconcileNode(r, "node1")
+			if node.Annotations["fencing/attempts"] != tt.attempts {
+				t.Errorf("attempts are %q, want %q", node.Annotations["fencing/attempts"], tt.attempts)
+			}
+			if node.Annotations["fencing/last-error"] == "" {
+				t.Errorf("last error is not recorded")
+			}
+			if state := node.Annotations["fencing/state"]; state != tt.state {
+				t.Errorf("state is %q, want %q", state, tt.state)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package ipmi
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Runner runs the command with additional environment variables and returns its combined output
+type Runner func(ctx context.Context, env []string, name string, args ...string) ([]byte, error)
+
+// ExecRunner runs the command using os/exec
+func ExecRunner(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.CombinedOutput()
+}
+
+// Client manages the chassis power via ipmitool
+type Client struct {
+	// Address is the BMC host
+	Address string
+	// Interface is the ipmitool interface, e.g. lanplus
+	Interface string
+	Username  string
+	Password  string
+	Run       Runner
+}
+
+// Args returns ipmitool arguments for the chassis power command.
+// Password is passed via IPMI_PASSWORD environment variable to not expose it in the process list.
+func (c *Client) Args(command string) []string {
+	args := []string{"-I", c.Interface, "-H", c.Address}
+	if c.Username != "" {
+		args = append(args, "-U", c.Username)
+	}
+	if c.Password != "" {
+		args = append(args, "-E")
+	}
+	return append(args, "chassis", "power", command)
+}
+
+// Power runs chassis power command (off, cycle, status) and returns its output
+func (c *Client) Power(ctx context.Context, command string) (string, error) {
+	run := c.Run
+	if run == nil {
+		run = ExecRunner
+	}
+	var env []string
+	if c.Password != "" {
+		env = append(env, "IPMI_PASSWORD="+c.Password)
+	}
+	out, err := run(ctx, env, "ipmitool", c.Args(command)...)
+	if err != nil {
+		return "", fmt.Errorf("ipmitool chassis power %s: %v: %s", command, err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// IsOff returns true if the chassis is powered off
+func (c *Client) IsOff(ctx context.Context) (bool, error) {
+	out, err := c.Power(ctx, "status")
+	if err != nil {
+		return false, err
+	}
+	return strings.HasSuffix(strings.ToLower(out), "is off"), nil
+}
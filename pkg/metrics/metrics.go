@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// Nodes is a number of nodes in each fencing state
+	Nodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_fencing_nodes",
+		Help: "Number of nodes in each fencing state",
+	}, []string{"state"})
+
+	// Throttled is a number of fencings deferred by safety limits
+	Throttled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_fencing_throttled_total",
+		Help: "Number of fencings deferred by safety limits",
+	}, []string{"reason"})
+
+	// ReconcilePanics is a number of panics recovered during reconciliation
+	ReconcilePanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_fencing_reconcile_panics_total",
+		Help: "Number of panics recovered during reconciliation",
+	}, []string{"controller"})
+
+	// ReconcileDuration is a duration of reconciliation
+	ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kube_fencing_reconcile_duration_seconds",
+		Help:    "Duration of reconciliation in seconds",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"controller"})
+
+	// ReconcileErrors is a number of reconciliations finished with error
+	ReconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_fencing_reconcile_errors_total",
+		Help: "Number of reconciliations finished with error",
+	}, []string{"controller"})
+
+	// SafeMode is 1 when fencing is suspended because too many nodes have unknown status
+	SafeMode = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kube_fencing_safe_mode",
+		Help: "Whether fencing is suspended because too many nodes have unknown status",
+	})
+
+	// Recovered is a number of nodes recovered after fencing was started
+	Recovered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_fencing_recovered_total",
+		Help: "Number of nodes recovered after fencing was started",
+	}, []string{"template"})
+
+	// RecoveryDeferred is a number of recovery cleanups deferred by rate limit
+	RecoveryDeferred = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kube_fencing_recovery_deferred_total",
+		Help: "Number of recovery cleanups deferred by rate limit",
+	})
+
+	// CleanupErrors is a number of failed cleanups of the recovered nodes, they are retried
+	CleanupErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kube_fencing_cleanup_errors_total",
+		Help: "Number of failed cleanups of the recovered nodes",
+	})
+
+	// RecoveryDuration is a time from the fencing start to the node recovery
+	RecoveryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kube_fencing_recovery_duration_seconds",
+		Help:    "Time from the fencing start to the node recovery in seconds",
+		Buckets: prometheus.ExponentialBuckets(30, 2, 10),
+	}, []string{"template"})
+)
+
+func init() {
+	// Register custom metrics with the global controller-runtime registry
+	metrics.Registry.MustRegister(
+		Nodes,
+		Throttled,
+		ReconcilePanics,
+		ReconcileDuration,
+		ReconcileErrors,
+		Recovered,
+		RecoveryDeferred,
+		CleanupErrors,
+		RecoveryDuration,
+		SafeMode,
+	)
+}
+
+// ObserveReconcile records duration and result of reconciliation started at start
+func ObserveReconcile(controller string, start time.Time, err error) {
+	ReconcileDuration.WithLabelValues(controller).Observe(time.Since(start).Seconds())
+	if err != nil {
+		ReconcileErrors.WithLabelValues(controller).Inc()
+	}
+}
@@ -0,0 +1,115 @@
+package redfish
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client is a minimal Redfish API client for power management
+type Client struct {
+	// Address is the BMC base URL, e.g. https://10.0.0.1
+	Address  string
+	Username string
+	Password string
+	http     *http.Client
+}
+
+// NewClient returns a new Redfish Client
+func NewClient(address, username, password string, insecure bool, timeout time.Duration) *Client {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+	}
+	return &Client{
+		Address:  strings.TrimSuffix(address, "/"),
+		Username: username,
+		Password: password,
+		http:     &http.Client{Transport: transport, Timeout: timeout},
+	}
+}
+
+// system is a subset of ComputerSystem resource
+type system struct {
+	PowerState string `json:"PowerState"`
+	Actions    struct {
+		Reset struct {
+			Target string `json:"target"`
+		} `json:"#ComputerSystem.Reset"`
+	} `json:"Actions"`
+}
+
+// collection is a subset of resource collection
+type collection struct {
+	Members []struct {
+		ID string `json:"@odata.id"`
+	} `json:"Members"`
+}
+
+// do performs request to the Redfish API and decodes the response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.Address+path, &body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: unexpected status %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// DefaultSystem returns the path of the first system managed by the BMC
+func (c *Client) DefaultSystem(ctx context.Context) (string, error) {
+	systems := &collection{}
+	if err := c.do(ctx, "GET", "/redfish/v1/Systems", nil, systems); err != nil {
+		return "", err
+	}
+	if len(systems.Members) == 0 {
+		return "", fmt.Errorf("no systems found")
+	}
+	return systems.Members[0].ID, nil
+}
+
+// PowerState returns the power state of the system, e.g. On or Off
+func (c *Client) PowerState(ctx context.Context, systemPath string) (string, error) {
+	s := &system{}
+	if err := c.do(ctx, "GET", systemPath, nil, s); err != nil {
+		return "", err
+	}
+	return s.PowerState, nil
+}
+
+// Reset performs ComputerSystem.Reset action of the specified type, e.g. ForceOff or ForceRestart
+func (c *Client) Reset(ctx context.Context, systemPath, resetType string) error {
+	s := &system{}
+	if err := c.do(ctx, "GET", systemPath, nil, s); err != nil {
+		return err
+	}
+	target := s.Actions.Reset.Target
+	if target == "" {
+		target = systemPath + "/Actions/ComputerSystem.Reset"
+	}
+	return c.do(ctx, "POST", target, map[string]string{"ResetType": resetType}, nil)
+}
@@ -0,0 +1,83 @@
+package status
+
+import (
+	"net/http"
+	"strings"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// authorizer authenticates the requests by bearer token with TokenReview
+// and authorizes them with SubjectAccessReview for the request path as non-resource URL
+type authorizer struct {
+	clientset kubernetes.Interface
+}
+
+// verbs maps the request methods to the authorized verbs
+var verbs = map[string]string{
+	http.MethodGet:  "get",
+	http.MethodPost: "create",
+}
+
+// wrap returns the handler serving only the requests allowed to the user
+func (a *authorizer) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header := req.Header.Get("Authorization")
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == "" || token == header {
+			http.Error(w, "bearer token is required", http.StatusUnauthorized)
+			return
+		}
+		verb, ok := verbs[req.Method]
+		if !ok {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tr, err := a.clientset.AuthenticationV1().TokenReviews().Create(&authnv1.TokenReview{
+			Spec: authnv1.TokenReviewSpec{Token: token},
+		})
+		if err != nil {
+			klog.Errorln("Failed to review token:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !tr.Status.Authenticated {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		user := tr.Status.User
+		extra := map[string]authzv1.ExtraValue{}
+		for k, v := range user.Extra {
+			extra[k] = authzv1.ExtraValue(v)
+		}
+		sar, err := a.clientset.AuthorizationV1().SubjectAccessReviews().Create(&authzv1.SubjectAccessReview{
+			Spec: authzv1.SubjectAccessReviewSpec{
+				User:   user.Username,
+				UID:    user.UID,
+				Groups: user.Groups,
+				Extra:  extra,
+				NonResourceAttributes: &authzv1.NonResourceAttributes{
+					Path: req.URL.Path,
+					Verb: verb,
+				},
+			},
+		})
+		if err != nil {
+			klog.Errorln("Failed to review access of", user.Username, "to", req.URL.Path, ":", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !sar.Status.Allowed {
+			klog.Infoln("Denied", verb, req.URL.Path, "to", user.Username)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		klog.Infoln("Allowed", verb, req.URL.Path, "to", user.Username)
+		h.ServeHTTP(w, req)
+	})
+}
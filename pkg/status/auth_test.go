@@ -0,0 +1,82 @@
+package status
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestAuthorizer returns the authorizer knowing the tokens of the users allowed to access the paths
+func newTestAuthorizer(tokens map[string]string, allowed map[string]bool) *authorizer {
+	clientset := k8sfake.NewSimpleClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		tr := action.(k8stesting.CreateAction).GetObject().(*authnv1.TokenReview)
+		if tr.Spec.Token == "broken" {
+			return true, &authnv1.TokenReview{}, errors.New("apiserver is unavailable")
+		}
+		if user, ok := tokens[tr.Spec.Token]; ok {
+			tr.Status.Authenticated = true
+			tr.Status.User.Username = user
+		}
+		return true, tr, nil
+	})
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		attrs := sar.Spec.NonResourceAttributes
+		sar.Status.Allowed = allowed[sar.Spec.User+" "+attrs.Verb+" "+attrs.Path]
+		return true, sar, nil
+	})
+	return &authorizer{clientset: clientset}
+}
+
+func TestAuthorizer(t *testing.T) {
+	auth := newTestAuthorizer(
+		map[string]string{"admin-token": "admin", "viewer-token": "viewer", "broken": ""},
+		map[string]bool{
+			"admin create /fence/approve": true,
+			"admin get /fence/incident":   true,
+			"viewer get /fence/incident":  true,
+		},
+	)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		code   int
+	}{
+		{name: "allowed user", method: http.MethodPost, path: "/fence/approve", header: "Bearer admin-token", code: http.StatusNoContent},
+		{name: "allowed GET", method: http.MethodGet, path: "/fence/incident", header: "Bearer viewer-token", code: http.StatusNoContent},
+		{name: "verb is not allowed", method: http.MethodPost, path: "/fence/incident", header: "Bearer viewer-token", code: http.StatusForbidden},
+		{name: "path is not allowed", method: http.MethodPost, path: "/fence/approve", header: "Bearer viewer-token", code: http.StatusForbidden},
+		{name: "unknown token", method: http.MethodPost, path: "/fence/approve", header: "Bearer other", code: http.StatusUnauthorized},
+		{name: "missing token", method: http.MethodPost, path: "/fence/approve", code: http.StatusUnauthorized},
+		{name: "not a bearer token", method: http.MethodPost, path: "/fence/approve", header: "Basic YWRtaW46YWRtaW4=", code: http.StatusUnauthorized},
+		{name: "unsupported method", method: http.MethodDelete, path: "/fence/approve", header: "Bearer admin-token", code: http.StatusMethodNotAllowed},
+		{name: "token review failed", method: http.MethodPost, path: "/fence/approve", header: "Bearer broken", code: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			auth.wrap(ok).ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Errorf("code is %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package status
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FencingStatus is a status of the node being fenced
+type FencingStatus struct {
+	Node      string     `json:"node"`
+	State     string     `json:"state"`
+	Attempts  int        `json:"attempts"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+}
+
+// ListFencingNodes returns the nodes being fenced right now, i.e. with fencing/state set and not recovered
+func ListFencingNodes(ctx context.Context, c client.Client) ([]FencingStatus, error) {
+	nodes := &v1.NodeList{}
+	if err := c.List(ctx, nodes); err != nil {
+		return nil, err
+	}
+	result := []FencingStatus{}
+	for _, node := range nodes.Items {
+		state := node.Annotations["fencing/state"]
+		if state == "" || state == "recovered" {
+			continue
+		}
+		s := FencingStatus{
+			Node:  node.Name,
+			State: state,
+		}
+		s.Attempts, _ = strconv.Atoi(node.Annotations["fencing/attempts"])
+		if startedAt, err := strconv.ParseInt(node.Annotations["fencing/started-at"], 10, 64); err == nil && startedAt > 0 {
+			t := time.Unix(startedAt, 0).UTC()
+			s.StartedAt = &t
+		}
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Node < result[j].Node
+	})
+	return result, nil
+}
@@ -0,0 +1,33 @@
+package status
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListFencingNodes(t *testing.T) {
+	startedAt := time.Unix(1600000000, 0).UTC()
+	c := newTestClient(
+		newTestNode("node3", map[string]string{"fencing/state": "recovered"}),
+		newTestNode("node2", map[string]string{
+			"fencing/state":      "started",
+			"fencing/attempts":   "2",
+			"fencing/started-at": "1600000000",
+		}),
+		newTestNode("node1", map[string]string{"fencing/state": "pending"}),
+		newTestNode("node4", nil),
+	)
+	nodes, err := ListFencingNodes(context.TODO(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FencingStatus{
+		{Node: "node1", State: "pending"},
+		{Node: "node2", State: "started", Attempts: 2, StartedAt: &startedAt},
+	}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("nodes %+v, want %+v", nodes, want)
+	}
+}
@@ -0,0 +1,278 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	nodecontroller "github.com/kvaps/kube-fencing/pkg/controller/node"
+	"github.com/kvaps/kube-fencing/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	// Path is the path serving the fencing status
+	Path = "/fence/status"
+	// ApprovePath is the path approving the fencing of the node
+	ApprovePath = "/fence/approve"
+	// ClearPath is the path clearing the stuck fencing state of the node
+	ClearPath = "/fence/clear"
+	// EmergencyPath is the path starting fencing of all NotReady nodes matching the selector
+	EmergencyPath = "/fence/emergency"
+	// IncidentPath is the path getting and setting the incident ID stamped on the fencing jobs
+	IncidentPath = "/fence/incident"
+)
+
+// NodeStatus is a fencing status of the node
+type NodeStatus struct {
+	Name        string `json:"name"`
+	Enabled     bool   `json:"enabled"`
+	State       string `json:"state"`
+	Attempts    int    `json:"attempts"`
+	LastError   string `json:"lastError,omitempty"`
+	JobUID      string `json:"jobUID,omitempty"`
+	Timestamp   string `json:"timestamp,omitempty"`
+	RecoveredAt string `json:"recoveredAt,omitempty"`
+}
+
+// Handler serves fencing status of all nodes as JSON, ?state= filters nodes by fencing state
+type Handler struct {
+	Client client.Client
+}
+
+// server runs the status handler on the separate address
+type server struct {
+	addr    string
+	handler http.Handler
+}
+
+// Add creates the status server and adds it to the Manager.
+// The status is served to everyone, the actions require the token of the user allowed to access their path.
+func Add(mgr manager.Manager, addr string) error {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	auth := &authorizer{clientset: clientset}
+	mux := http.NewServeMux()
+	mux.Handle(Path, &Handler{Client: mgr.GetClient()})
+	mux.Handle(ApprovePath, auth.wrap(&ApproveHandler{Client: mgr.GetClient()}))
+	mux.Handle(ClearPath, auth.wrap(&ClearHandler{Client: mgr.GetClient()}))
+	mux.Handle(EmergencyPath, auth.wrap(&EmergencyHandler{Client: mgr.GetClient()}))
+	mux.Handle(IncidentPath, auth.wrap(&IncidentHandler{Client: mgr.GetClient()}))
+	return mgr.Add(&server{addr: addr, handler: mux})
+}
+
+// Start serves the status until stop is closed
+func (s *server) Start(stop <-chan struct{}) error {
+	srv := &http.Server{Addr: s.addr, Handler: s.handler}
+	go func() {
+		<-stop
+		if err := srv.Shutdown(context.Background()); err != nil {
+			klog.Errorln("Failed to shutdown status server:", err)
+		}
+	}()
+	klog.Infoln("Serving fencing status on", s.addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection allows serving the status on every replica
+func (s *server) NeedLeaderElection() bool {
+	return false
+}
+
+// ServeHTTP returns fencing status of the nodes
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	nodes, err := h.List(req.Context(), req.URL.Query().Get("state"))
+	if err != nil {
+		klog.Errorln("Failed to list fencing status:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(nodes); err != nil {
+		klog.Errorln("Failed to write fencing status:", err)
+	}
+}
+
+// List returns fencing status of the nodes in the state, empty state returns all nodes
+func (h *Handler) List(ctx context.Context, state string) ([]NodeStatus, error) {
+	nodes := &v1.NodeList{}
+	if err := h.Client.List(ctx, nodes); err != nil {
+		return nil, err
+	}
+
+	result := []NodeStatus{}
+	for _, node := range nodes.Items {
+		attempts, _ := strconv.Atoi(node.Annotations["fencing/attempts"])
+		s := NodeStatus{
+			Name:        node.Name,
+			Enabled:     node.Annotations["fencing/enabled"] == "true",
+			State:       node.Annotations["fencing/state"],
+			Attempts:    attempts,
+			LastError:   node.Annotations["fencing/last-error"],
+			JobUID:      node.Annotations["fencing/job-uid"],
+			Timestamp:   node.Annotations["fencing/timestamp"],
+			RecoveredAt: node.Annotations["fencing/recovered-at"],
+		}
+		if state != "" && s.State != state {
+			continue
+		}
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// ApproveHandler approves the fencing of the node specified by ?node= by setting fencing/approved=true annotation
+type ApproveHandler struct {
+	Client client.Client
+}
+
+// ServeHTTP approves the fencing of the node
+func (h *ApproveHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := req.URL.Query().Get("node")
+	if name == "" {
+		http.Error(w, "node is not specified", http.StatusBadRequest)
+		return
+	}
+	node := &v1.Node{}
+	err := h.Client.Get(req.Context(), types.NamespacedName{Name: name}, node)
+	if err == nil {
+		err = util.PatchNodeAnnotations(req.Context(), h.Client, node, map[string]interface{}{
+			"fencing/approved": "true",
+		})
+	}
+	if errors.IsNotFound(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		klog.Errorln("Failed to patch node", name, ":", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	klog.Infoln("Fencing of node", name, "is approved")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ClearHandler clears the fencing state of the node specified by ?node= and deletes its fencing jobs
+type ClearHandler struct {
+	Client client.Client
+}
+
+// ServeHTTP clears the fencing state of the node
+func (h *ClearHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := req.URL.Query().Get("node")
+	if name == "" {
+		http.Error(w, "node is not specified", http.StatusBadRequest)
+		return
+	}
+	err := nodecontroller.ClearFencing(req.Context(), h.Client, name)
+	if errors.IsNotFound(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		klog.Errorln("Failed to clear fencing of node", name, ":", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// EmergencyHandler starts fencing of all NotReady nodes matching the label selector specified by ?selector=,
+// names of the nodes started to fence are returned as JSON list
+type EmergencyHandler struct {
+	Client client.Client
+}
+
+// ServeHTTP starts emergency fencing of the selected nodes
+func (h *EmergencyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	selector, err := labels.Parse(req.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if selector.Empty() {
+		http.Error(w, "selector is not specified", http.StatusBadRequest)
+		return
+	}
+	started, err := nodecontroller.EmergencyFence(req.Context(), h.Client, selector)
+	if err != nil {
+		klog.Errorln("Failed to start emergency fencing of nodes", selector.String(), ":", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if started == nil {
+		started = []string{}
+	}
+	klog.Infoln("Emergency fencing started for nodes", started)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(started); err != nil {
+		klog.Errorln("Failed to write emergency fencing response:", err)
+	}
+}
+
+// IncidentHandler returns the current incident ID on GET and sets it from ?id= on POST, empty id clears it
+type IncidentHandler struct {
+	Client client.Client
+}
+
+// ServeHTTP gets or sets the incident ID
+func (h *IncidentHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var id string
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+		id, err = nodecontroller.IncidentID(req.Context(), h.Client)
+	case http.MethodPost:
+		id = req.URL.Query().Get("id")
+		err = nodecontroller.SetIncidentID(req.Context(), h.Client, id)
+		if err == nil {
+			klog.Infoln("Incident ID is set to", id)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		klog.Errorln("Failed to access incident ID:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"id": id}); err != nil {
+		klog.Errorln("Failed to write incident ID:", err)
+	}
+}
@@ -0,0 +1,259 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestClient returns the fake client with the objects
+func newTestClient(objs ...runtime.Object) client.Client {
+	return fake.NewFakeClientWithScheme(scheme.Scheme, objs...)
+}
+
+// newTestNode returns the node with the annotations
+func newTestNode(name string, annotations map[string]string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+}
+
+// serve returns the recorded response of the handler to the request
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestApproveHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		code     int
+		approved bool
+	}{
+		{name: "node is approved", method: http.MethodPost, target: "/fence/approve?node=node1", code: http.StatusNoContent, approved: true},
+		{name: "unknown node", method: http.MethodPost, target: "/fence/approve?node=node2", code: http.StatusNotFound},
+		{name: "node is not specified", method: http.MethodPost, target: "/fence/approve", code: http.StatusBadRequest},
+		{name: "GET is not allowed", method: http.MethodGet, target: "/fence/approve?node=node1", code: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(newTestNode("node1", map[string]string{
+				"fencing/enabled": "true",
+				"fencing/state":   "awaiting-approval",
+			}))
+			w := serve(&ApproveHandler{Client: c}, tt.method, tt.target)
+			if w.Code != tt.code {
+				t.Fatalf("code is %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			node := &v1.Node{}
+			if err := c.Get(context.TODO(), types.NamespacedName{Name: "node1"}, node); err != nil {
+				t.Fatal(err)
+			}
+			if approved := node.Annotations["fencing/approved"] == "true"; approved != tt.approved {
+				t.Errorf("node approved: %v, want %v", approved, tt.approved)
+			}
+			if node.Annotations["fencing/enabled"] != "true" || node.Annotations["fencing/state"] != "awaiting-approval" {
+				t.Errorf("other annotations are changed: %v", node.Annotations)
+			}
+		})
+	}
+}
+
+func TestClearHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		code    int
+		cleared bool
+	}{
+		{name: "node is cleared", method: http.MethodPost, target: "/fence/clear?node=node1", code: http.StatusNoContent, cleared: true},
+		{name: "unknown node", method: http.MethodPost, target: "/fence/clear?node=node2", code: http.StatusNotFound},
+		{name: "node is not specified", method: http.MethodPost, target: "/fence/clear", code: http.StatusBadRequest},
+		{name: "GET is not allowed", method: http.MethodGet, target: "/fence/clear?node=node1", code: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(newTestNode("node1", map[string]string{
+				"fencing/enabled":    "true",
+				"fencing/state":      "failed",
+				"fencing/last-error": "job failed",
+			}))
+			w := serve(&ClearHandler{Client: c}, tt.method, tt.target)
+			if w.Code != tt.code {
+				t.Fatalf("code is %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			node := &v1.Node{}
+			if err := c.Get(context.TODO(), types.NamespacedName{Name: "node1"}, node); err != nil {
+				t.Fatal(err)
+			}
+			_, failed := node.Annotations["fencing/state"]
+			if failed == tt.cleared {
+				t.Errorf("node state %q, want cleared %v", node.Annotations["fencing/state"], tt.cleared)
+			}
+			if node.Annotations["fencing/enabled"] != "true" {
+				t.Errorf("fencing/enabled is not preserved")
+			}
+		})
+	}
+}
+
+func TestEmergencyHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		code    int
+		started string
+	}{
+		{name: "matching nodes are started", method: http.MethodPost, target: "/fence/emergency?selector=rack%3Dr1", code: http.StatusOK, started: `["node1"]`},
+		{name: "no matching nodes", method: http.MethodPost, target: "/fence/emergency?selector=rack%3Dr2", code: http.StatusOK, started: `[]`},
+		{name: "selector is not specified", method: http.MethodPost, target: "/fence/emergency", code: http.StatusBadRequest},
+		{name: "invalid selector", method: http.MethodPost, target: "/fence/emergency?selector=rack%3D%3D%3D", code: http.StatusBadRequest},
+		{name: "GET is not allowed", method: http.MethodGet, target: "/fence/emergency?selector=rack%3Dr1", code: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failed := newTestNode("node1", nil)
+			failed.Labels = map[string]string{"rack": "r1"}
+			failed.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionUnknown}}
+			ready := newTestNode("node3", nil)
+			ready.Labels = map[string]string{"rack": "r1"}
+			ready.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+			w := serve(&EmergencyHandler{Client: newTestClient(failed, ready)}, tt.method, tt.target)
+			if w.Code != tt.code {
+				t.Fatalf("code is %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			if tt.started != "" && strings.TrimSpace(w.Body.String()) != tt.started {
+				t.Errorf("started %s, want %s", w.Body.String(), tt.started)
+			}
+		})
+	}
+}
+
+func TestIncidentHandler(t *testing.T) {
+	h := &IncidentHandler{Client: newTestClient()}
+	tests := []struct {
+		name   string
+		method string
+		target string
+		code   int
+		id     string
+	}{
+		{name: "no incident", method: http.MethodGet, target: "/fence/incident", code: http.StatusOK, id: `{"id":""}`},
+		{name: "incident is set", method: http.MethodPost, target: "/fence/incident?id=INC-1", code: http.StatusOK, id: `{"id":"INC-1"}`},
+		{name: "incident is returned", method: http.MethodGet, target: "/fence/incident", code: http.StatusOK, id: `{"id":"INC-1"}`},
+		{name: "incident is cleared", method: http.MethodPost, target: "/fence/incident", code: http.StatusOK, id: `{"id":""}`},
+		{name: "cleared incident is returned", method: http.MethodGet, target: "/fence/incident", code: http.StatusOK, id: `{"id":""}`},
+		{name: "DELETE is not allowed", method: http.MethodDelete, target: "/fence/incident", code: http.StatusMethodNotAllowed},
+	}
+	// The cases share the handler, so the ID set by one case is returned by the next one
+	for _, tt := range tests {
+		w := serve(h, tt.method, tt.target)
+		if w.Code != tt.code {
+			t.Fatalf("%s: code is %d, want %d: %s", tt.name, w.Code, tt.code, w.Body.String())
+		}
+		if tt.id != "" && strings.TrimSpace(w.Body.String()) != tt.id {
+			t.Errorf("%s: response is %s, want %s", tt.name, w.Body.String(), tt.id)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	job := func(name, node, fencing string) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "fencing",
+			Labels:    map[string]string{"fencing": fencing, "node": node},
+		}}
+	}
+	c := newTestClient(
+		newTestNode("node2", map[string]string{
+			"fencing/enabled":    "true",
+			"fencing/state":      "failed",
+			"fencing/attempts":   "3",
+			"fencing/last-error": "job failed",
+		}),
+		newTestNode("node1", map[string]string{
+			"fencing/enabled":  "true",
+			"fencing/state":    "started",
+			"fencing/attempts": "1",
+			"fencing/job-uid":  "uid1",
+		}),
+		newTestNode("node3", nil),
+		// Attempts are counted by the node annotation, the jobs may be removed or not used by the backend
+		job("fence-node2-1", "node2", "retained"),
+		job("fence-node2", "node2", "fence"),
+		job("fence-node1", "node1", "fence"),
+		job("other", "node1", "other"),
+	)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		code   int
+		nodes  []NodeStatus
+	}{
+		{
+			name:   "all nodes",
+			method: http.MethodGet,
+			target: "/fence/status",
+			code:   http.StatusOK,
+			nodes: []NodeStatus{
+				{Name: "node1", Enabled: true, State: "started", Attempts: 1, JobUID: "uid1"},
+				{Name: "node2", Enabled: true, State: "failed", Attempts: 3, LastError: "job failed"},
+				{Name: "node3"},
+			},
+		},
+		{
+			name:   "nodes in state",
+			method: http.MethodGet,
+			target: "/fence/status?state=failed",
+			code:   http.StatusOK,
+			nodes: []NodeStatus{
+				{Name: "node2", Enabled: true, State: "failed", Attempts: 3, LastError: "job failed"},
+			},
+		},
+		{
+			name:   "no nodes in state",
+			method: http.MethodGet,
+			target: "/fence/status?state=fenced",
+			code:   http.StatusOK,
+			nodes:  []NodeStatus{},
+		},
+		{name: "POST is not allowed", method: http.MethodPost, target: "/fence/status", code: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(&Handler{Client: c}, tt.method, tt.target)
+			if w.Code != tt.code {
+				t.Fatalf("code is %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			if tt.nodes == nil {
+				return
+			}
+			var nodes []NodeStatus
+			if err := json.Unmarshal(w.Body.Bytes(), &nodes); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(nodes, tt.nodes) {
+				t.Errorf("nodes %+v, want %+v", nodes, tt.nodes)
+			}
+		})
+	}
+}
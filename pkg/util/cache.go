@@ -0,0 +1,117 @@
+package util
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// NamespacesCacheBuilder returns the cache watching namespaced objects in the namespaces only,
+// so the controller needs no cluster-wide permissions for them, cluster-scoped objects (e.g. nodes) are watched as usual
+func NamespacesCacheBuilder(namespaces []string) cache.NewCacheFunc {
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		namespaced, err := cache.MultiNamespacedCacheBuilder(namespaces)(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		// Cluster-scoped objects are not restricted by the namespace of the cache
+		opts.Namespace = namespaces[0]
+		cluster, err := cache.New(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &namespacesCache{Cache: namespaced, cluster: cluster, scheme: opts.Scheme, mapper: opts.Mapper}, nil
+	}
+}
+
+// namespacesCache serves namespaced objects from the multi-namespace cache and cluster-scoped objects from the cluster one
+type namespacesCache struct {
+	cache.Cache
+	cluster cache.Cache
+	scheme  *runtime.Scheme
+	mapper  meta.RESTMapper
+}
+
+// cacheFor returns the cache serving the objects of the kind
+func (c *namespacesCache) cacheFor(gvk schema.GroupVersionKind) (cache.Cache, error) {
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return c.cluster, nil
+	}
+	return c.Cache, nil
+}
+
+// cacheForObject returns the cache serving the object or the list
+func (c *namespacesCache) cacheForObject(obj runtime.Object) (cache.Cache, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return nil, err
+	}
+	return c.cacheFor(gvk)
+}
+
+func (c *namespacesCache) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	ca, err := c.cacheForObject(obj)
+	if err != nil {
+		return err
+	}
+	return ca.Get(ctx, key, obj)
+}
+
+func (c *namespacesCache) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	ca, err := c.cacheForObject(list)
+	if err != nil {
+		return err
+	}
+	return ca.List(ctx, list, opts...)
+}
+
+func (c *namespacesCache) GetInformer(obj runtime.Object) (cache.Informer, error) {
+	ca, err := c.cacheForObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	return ca.GetInformer(obj)
+}
+
+func (c *namespacesCache) GetInformerForKind(gvk schema.GroupVersionKind) (cache.Informer, error) {
+	ca, err := c.cacheFor(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return ca.GetInformerForKind(gvk)
+}
+
+func (c *namespacesCache) IndexField(obj runtime.Object, field string, extractValue client.IndexerFunc) error {
+	ca, err := c.cacheForObject(obj)
+	if err != nil {
+		return err
+	}
+	return ca.IndexField(obj, field, extractValue)
+}
+
+func (c *namespacesCache) Start(stopCh <-chan struct{}) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.cluster.Start(stopCh)
+	}()
+	if err := c.Cache.Start(stopCh); err != nil {
+		return err
+	}
+	return <-errCh
+}
+
+func (c *namespacesCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	return c.cluster.WaitForCacheSync(stop) && c.Cache.WaitForCacheSync(stop)
+}
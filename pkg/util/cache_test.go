@@ -0,0 +1,41 @@
+package util
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+)
+
+func TestNamespacesCacheRouting(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(v1.SchemeGroupVersion.WithKind("Node"), meta.RESTScopeRoot)
+	mapper.Add(v1.SchemeGroupVersion.WithKind("PodTemplate"), meta.RESTScopeNamespace)
+	namespaced, cluster := &informertest.FakeInformers{}, &informertest.FakeInformers{}
+	c := &namespacesCache{Cache: namespaced, cluster: cluster, scheme: scheme.Scheme, mapper: mapper}
+
+	tests := []struct {
+		name    string
+		obj     runtime.Object
+		cluster bool
+	}{
+		{name: "cluster-scoped object", obj: &v1.Node{}, cluster: true},
+		{name: "cluster-scoped list", obj: &v1.NodeList{}, cluster: true},
+		{name: "namespaced object", obj: &v1.PodTemplate{}},
+		{name: "namespaced list", obj: &v1.PodTemplateList{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca, err := c.cacheForObject(tt.obj)
+			if err != nil {
+				t.Fatalf("cache lookup failed: %v", err)
+			}
+			if (ca == cluster) != tt.cluster {
+				t.Errorf("object is served by cluster cache %v, want %v", ca == cluster, tt.cluster)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CleanupNode cleans up the fenced node according to fencing/mode annotation:
+// none - do nothing, flush - remove all pods and volumeattachments from the node, delete - remove the node,
+// soft - cordon the node and remove all pods from it.
+// requeueAfter is returned while the node is drained, the cleanup must be called again then.
+func CleanupNode(ctx context.Context, c client.Client, cs kubernetes.Interface, node *v1.Node, annotations map[string]string) (requeueAfter time.Duration, err error) {
+	nodeName := node.Name
+	fencingMode := annotations["fencing/mode"]
+
+	// Grace period for deleting pods, force-delete by default
+	var gracePeriod int64
+	if v, ok := annotations["fencing/pod-grace-period"]; ok {
+		if gracePeriod, err = strconv.ParseInt(v, 10, 64); err != nil {
+			klog.Errorln("Failed to parse pod grace period string", v, ":", err)
+			gracePeriod = 0
+		}
+	}
+
+	switch fencingMode {
+	case "none":
+		// Do nothing
+		return 0, nil
+	case "delete":
+		// Delete the node
+		klog.Infoln("Removing node", nodeName)
+		return 0, c.Delete(ctx, node,
+			client.GracePeriodSeconds(0),
+			client.PropagationPolicy(metav1.DeletePropagationBackground),
+		)
+	case "flush":
+		// Flush all resources from the node
+		klog.Infoln("Flushing node", nodeName)
+
+		// Try to evict pods gracefully first
+		if annotations["fencing/drain"] == "true" {
+			timeout := 60 * time.Second
+			if v, ok := annotations["fencing/drain-timeout"]; ok {
+				var err error
+				if timeout, err = ParseDuration(v); err != nil {
+					klog.Errorln("Failed to parse drain timeout string", v, ":", err)
+					timeout = 60 * time.Second
+				}
+			}
+			klog.Infoln("Draining node", nodeName)
+			requeueAfter, err := DrainNode(ctx, c, cs, node, timeout)
+			if err != nil {
+				klog.Errorln("Failed to drain node", nodeName, ":", err)
+			}
+			if requeueAfter > 0 {
+				return requeueAfter, nil
+			}
+		}
+
+		if err := FlushNode(ctx, c, nodeName, gracePeriod); err != nil {
+			klog.Errorln("Failed to flush node", nodeName, ":", err)
+		}
+	case "soft":
+		// Cordon the node and remove its pods without power action
+		klog.Infoln("Cordoning node", nodeName)
+		mergePatch, _ := json.Marshal(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"unschedulable": true,
+			},
+		})
+		if err := c.Patch(ctx, node, client.RawPatch(types.MergePatchType, mergePatch)); err != nil {
+			klog.Errorln("Failed to cordon node", nodeName, ":", err)
+			return 0, err
+		}
+		if err := DeleteNodePods(ctx, c, nodeName, gracePeriod); err != nil {
+			klog.Errorln("Failed to delete pods from node", nodeName, ":", err)
+		}
+		if annotations["fencing/soft-detach-volumes"] == "true" {
+			if err := DeleteNodeVolumeAttachments(ctx, c, nodeName); err != nil {
+				klog.Errorln("Failed to delete volumeattachments from node", nodeName, ":", err)
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unknown fencing mode %q", fencingMode)
+	}
+
+	// Let Kubernetes force-detach volumes and delete pods of the fenced node
+	if annotations["fencing/out-of-service"] == "true" {
+		klog.Infoln("Tainting node", nodeName, "out of service")
+		if err := TaintOutOfService(ctx, c, node); err != nil {
+			klog.Errorln("Failed to taint node", nodeName, ":", err)
+			return 0, err
+		}
+	}
+
+	// Setting new condition
+	var newConditions []v1.NodeCondition
+
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady || c.Reason == "NodeStatusUnknown" {
+			c.Reason = "NodeFenced"
+			c.Message = "Node was fenced by fencing controller."
+			//TODO update time
+		}
+		newConditions = append(newConditions, c)
+	}
+
+	node.Status.Conditions = newConditions
+	node.Status.VolumesAttached = nil
+	node.Status.VolumesInUse = nil
+
+	klog.Infoln("Updating node status", nodeName)
+	return 0, c.Status().Update(ctx, node)
+}
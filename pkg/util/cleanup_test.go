@@ -0,0 +1,62 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// gracePeriodClient records the grace periods the pods are deleted with
+type gracePeriodClient struct {
+	client.Client
+	gracePeriods []int64
+}
+
+func (c *gracePeriodClient) DeleteAllOf(ctx context.Context, obj runtime.Object, opts ...client.DeleteAllOfOption) error {
+	if _, ok := obj.(*v1.Pod); ok {
+		deleteOpts := client.DeleteAllOfOptions{}
+		deleteOpts.ApplyOptions(opts)
+		if deleteOpts.GracePeriodSeconds != nil {
+			c.gracePeriods = append(c.gracePeriods, *deleteOpts.GracePeriodSeconds)
+		}
+	}
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
+
+func TestCleanupPodGracePeriod(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		gracePeriod string
+		want        int64
+	}{
+		{name: "force-delete by default", mode: "flush", want: 0},
+		{name: "configured grace period", mode: "flush", gracePeriod: "30", want: 30},
+		{name: "invalid grace period", mode: "flush", gracePeriod: "soon", want: 0},
+		{name: "soft mode", mode: "soft", gracePeriod: "30", want: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+			ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+			c := &gracePeriodClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, node, ns)}
+			annotations := map[string]string{"fencing/mode": tt.mode}
+			if tt.gracePeriod != "" {
+				annotations["fencing/pod-grace-period"] = tt.gracePeriod
+			}
+			if _, err := CleanupNode(context.TODO(), c, k8sfake.NewSimpleClientset(), node, annotations); err != nil {
+				t.Fatalf("cleanup failed: %v", err)
+			}
+			if len(c.gracePeriods) != 1 || c.gracePeriods[0] != tt.want {
+				t.Errorf("pods are deleted with grace periods %v, want %d", c.gracePeriods, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// drainPollInterval is the interval of retrying the evictions blocked by PodDisruptionBudgets
+const drainPollInterval = 5 * time.Second
+
+// DrainNode evicts the pods from the node respecting PodDisruptionBudgets without waiting for their termination,
+// the pods of the fenced node are force-deleted afterwards anyway. The drain start is recorded in fencing/drain-started
+// annotation, requeueAfter is returned while some evictions are blocked and the timeout is not expired.
+func DrainNode(ctx context.Context, c client.Client, cs kubernetes.Interface, node *v1.Node, timeout time.Duration) (requeueAfter time.Duration, err error) {
+	started, err := strconv.ParseInt(node.Annotations["fencing/drain-started"], 10, 64)
+	if err != nil {
+		started = time.Now().Unix()
+		err = PatchNodeAnnotations(ctx, c, node, map[string]interface{}{
+			"fencing/drain-started": strconv.FormatInt(started, 10),
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	blocked, err := evictNodePods(cs, node.Name)
+	if err != nil {
+		return 0, err
+	}
+	if remain := time.Until(time.Unix(started, 0).Add(timeout)); blocked > 0 && remain > 0 {
+		klog.Infoln("Eviction of", blocked, "pods from node", node.Name, "is blocked, drain timeout remains", remain)
+		if remain < drainPollInterval {
+			return remain, nil
+		}
+		return drainPollInterval, nil
+	}
+	if blocked > 0 {
+		klog.Infoln("Eviction of", blocked, "pods from node", node.Name, "is still blocked after", timeout)
+	}
+	return 0, PatchNodeAnnotations(ctx, c, node, map[string]interface{}{
+		"fencing/drain-started": nil,
+	})
+}
+
+// evictNodePods requests eviction of the pods on the node, which are not terminating yet,
+// returns the number of pods which eviction is blocked by PodDisruptionBudget
+func evictNodePods(cs kubernetes.Interface, nodeName string) (int, error) {
+	pods, err := cs.CoreV1().Pods("").List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	blocked := 0
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed || pod.DeletionTimestamp != nil {
+			continue
+		}
+		err = cs.CoreV1().Pods(pod.Namespace).Evict(&policyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+		})
+		// TooManyRequests means eviction is blocked by PodDisruptionBudget, try again later
+		if errors.IsTooManyRequests(err) {
+			blocked++
+		} else if err != nil && !errors.IsNotFound(err) {
+			klog.Errorln("Failed to evict pod", pod.Namespace+"/"+pod.Name, ":", err)
+		}
+	}
+	return blocked, nil
+}
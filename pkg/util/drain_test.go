@@ -0,0 +1,106 @@
+package util
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newDrainPod returns the pod on node1 in the phase
+func newDrainPod(name string, phase v1.PodPhase) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       v1.PodSpec{NodeName: "node1"},
+		Status:     v1.PodStatus{Phase: phase},
+	}
+}
+
+// newDrainClientset returns the fake clientset with the pods, evictions of the protected pods are blocked
+func newDrainClientset(evicted *[]string, protected map[string]bool, pods ...runtime.Object) *k8sfake.Clientset {
+	cs := k8sfake.NewSimpleClientset(pods...)
+	cs.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		name := action.(k8stesting.CreateAction).GetObject().(metav1.Object).GetName()
+		if protected[name] {
+			return true, nil, errors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+		}
+		*evicted = append(*evicted, name)
+		return true, nil, nil
+	})
+	return cs
+}
+
+func TestDrainNode(t *testing.T) {
+	terminating := newDrainPod("terminating", v1.PodRunning)
+	now := metav1.Now()
+	terminating.DeletionTimestamp = &now
+
+	justNow := strconv.FormatInt(time.Now().Unix(), 10)
+	longAgo := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	tests := []struct {
+		name      string
+		started   string
+		protected map[string]bool
+		evicted   []string
+		requeue   bool
+		recorded  bool
+	}{
+		{name: "pods are evicted", evicted: []string{"pending", "running"}},
+		{name: "blocked eviction is retried", protected: map[string]bool{"running": true}, evicted: []string{"pending"}, requeue: true, recorded: true},
+		{name: "blocked eviction is retried until timeout", started: justNow, protected: map[string]bool{"running": true}, evicted: []string{"pending"}, requeue: true, recorded: true},
+		{name: "blocked eviction is given up after timeout", started: longAgo, protected: map[string]bool{"running": true}, evicted: []string{"pending"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+			if tt.started != "" {
+				node.Annotations = map[string]string{"fencing/drain-started": tt.started}
+			}
+			c := fake.NewFakeClientWithScheme(scheme.Scheme, node.DeepCopy())
+			var evicted []string
+			cs := newDrainClientset(&evicted, tt.protected,
+				newDrainPod("pending", v1.PodPending),
+				newDrainPod("running", v1.PodRunning),
+				newDrainPod("succeeded", v1.PodSucceeded),
+				newDrainPod("failed", v1.PodFailed),
+				terminating,
+			)
+
+			requeueAfter, err := DrainNode(context.TODO(), c, cs, node, time.Minute)
+			if err != nil {
+				t.Fatalf("drain failed: %v", err)
+			}
+			if requeue := requeueAfter > 0; requeue != tt.requeue {
+				t.Errorf("drain requeued after %v, want requeue %v", requeueAfter, tt.requeue)
+			}
+			if requeueAfter > drainPollInterval {
+				t.Errorf("drain requeued after %v, longer than poll interval", requeueAfter)
+			}
+			sort.Strings(evicted)
+			if !reflect.DeepEqual(evicted, tt.evicted) {
+				t.Errorf("evicted pods are %v, want %v", evicted, tt.evicted)
+			}
+			stored := getNode(t, c)
+			if _, recorded := stored.Annotations["fencing/drain-started"]; recorded != tt.recorded {
+				t.Errorf("drain start recorded is %v, want %v", recorded, tt.recorded)
+			}
+			if tt.started != "" && tt.recorded && stored.Annotations["fencing/drain-started"] != tt.started {
+				t.Errorf("drain start is changed to %s", stored.Annotations["fencing/drain-started"])
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ParseExitCodes parses comma-separated list of exit codes and their ranges, e.g. 3,10-12
+func ParseExitCodes(s string) (map[int32]bool, error) {
+	codes := map[int32]bool{}
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		bounds := strings.SplitN(p, "-", 2)
+		from, err := strconv.ParseInt(bounds[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exit code %q", p)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.ParseInt(bounds[1], 10, 32); err != nil || to < from {
+				return nil, fmt.Errorf("invalid exit code range %q", p)
+			}
+		}
+		for code := from; code <= to; code++ {
+			codes[int32(code)] = true
+		}
+	}
+	return codes, nil
+}
+
+// JobSucceededByExitCode returns true if any pod of the job has all containers terminated
+// with zero or one of the exit codes listed in fencing/success-exit-codes job annotation
+func JobSucceededByExitCode(ctx context.Context, c client.Client, job *batchv1.Job) (bool, error) {
+	s, ok := job.Annotations["fencing/success-exit-codes"]
+	if !ok || s == "" {
+		return false, nil
+	}
+	codes, err := ParseExitCodes(s)
+	if err != nil {
+		return false, err
+	}
+	pods := &v1.PodList{}
+	err = c.List(ctx, pods,
+		client.InNamespace(job.Namespace),
+		client.MatchingLabels{"job-name": job.Name},
+	)
+	if err != nil {
+		return false, err
+	}
+	for _, pod := range pods.Items {
+		if podExitedWithCodes(&pod, codes) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// podExitedWithCodes returns true if all containers of the pod are terminated with zero or listed exit codes
+func podExitedWithCodes(pod *v1.Pod, codes map[int32]bool) bool {
+	if len(pod.Status.ContainerStatuses) == 0 {
+		return false
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		t := cs.State.Terminated
+		if t == nil {
+			return false
+		}
+		if t.ExitCode != 0 && !codes[t.ExitCode] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseExitCodes(t *testing.T) {
+	tests := []struct {
+		s       string
+		codes   map[int32]bool
+		invalid bool
+	}{
+		{s: "", codes: map[int32]bool{}},
+		{s: "3", codes: map[int32]bool{3: true}},
+		{s: "3, 10-12", codes: map[int32]bool{3: true, 10: true, 11: true, 12: true}},
+		{s: "3,,4", codes: map[int32]bool{3: true, 4: true}},
+		{s: "three", invalid: true},
+		{s: "12-10", invalid: true},
+		{s: "10-x", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			codes, err := ParseExitCodes(tt.s)
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("invalid exit codes are parsed as %v", codes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			if !reflect.DeepEqual(codes, tt.codes) {
+				t.Errorf("exit codes are %v, want %v", codes, tt.codes)
+			}
+		})
+	}
+}
+
+// newExitedPod returns the pod of the job with containers terminated with the exit codes, -1 means running
+func newExitedPod(name, job string, exitCodes ...int32) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "fencing",
+			Labels:    map[string]string{"job-name": job},
+		},
+	}
+	for _, code := range exitCodes {
+		cs := v1.ContainerStatus{}
+		if code >= 0 {
+			cs.State.Terminated = &v1.ContainerStateTerminated{ExitCode: code}
+		}
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, cs)
+	}
+	return pod
+}
+
+func TestJobSucceededByExitCode(t *testing.T) {
+	tests := []struct {
+		name      string
+		codes     string
+		pods      []runtime.Object
+		succeeded bool
+	}{
+		{name: "no success codes", pods: []runtime.Object{newExitedPod("pod1", "fence-node1", 3)}},
+		{name: "listed exit code", codes: "3", pods: []runtime.Object{newExitedPod("pod1", "fence-node1", 3)}, succeeded: true},
+		{name: "exit code in range", codes: "1,10-12", pods: []runtime.Object{newExitedPod("pod1", "fence-node1", 11)}, succeeded: true},
+		{name: "not listed exit code", codes: "3", pods: []runtime.Object{newExitedPod("pod1", "fence-node1", 1)}},
+		{name: "all containers must exit with success codes", codes: "3", pods: []runtime.Object{newExitedPod("pod1", "fence-node1", 3, 1)}},
+		{name: "zero and listed codes", codes: "3", pods: []runtime.Object{newExitedPod("pod1", "fence-node1", 0, 3)}, succeeded: true},
+		{name: "running container", codes: "3", pods: []runtime.Object{newExitedPod("pod1", "fence-node1", 3, -1)}},
+		{name: "any pod of the job", codes: "3", pods: []runtime.Object{newExitedPod("pod1", "fence-node1", 1), newExitedPod("pod2", "fence-node1", 3)}, succeeded: true},
+		{name: "pods of other jobs", codes: "3", pods: []runtime.Object{newExitedPod("pod1", "fence-node2", 3)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "fence-node1", Namespace: "fencing"}}
+			if tt.codes != "" {
+				job.Annotations = map[string]string{"fencing/success-exit-codes": tt.codes}
+			}
+			c := fake.NewFakeClientWithScheme(scheme.Scheme, tt.pods...)
+			succeeded, err := JobSucceededByExitCode(context.TODO(), c, job)
+			if err != nil {
+				t.Fatalf("check exit codes failed: %v", err)
+			}
+			if succeeded != tt.succeeded {
+				t.Errorf("job succeeded is %v, want %v", succeeded, tt.succeeded)
+			}
+		})
+	}
+}
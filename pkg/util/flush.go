@@ -0,0 +1,77 @@
+package util
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FlushNode removes all pods with gracePeriod seconds and volumeattachments from the node.
+// It tries to remove as much as possible and returns the last occurred error.
+func FlushNode(ctx context.Context, c client.Client, nodeName string, gracePeriod int64) error {
+	lastErr := DeleteNodePods(ctx, c, nodeName, gracePeriod)
+	if err := DeleteNodeVolumeAttachments(ctx, c, nodeName); err != nil {
+		lastErr = err
+	}
+	return lastErr
+}
+
+// DeleteNodePods deletes all pods from the node with gracePeriod seconds and returns the last occurred error.
+func DeleteNodePods(ctx context.Context, c client.Client, nodeName string, gracePeriod int64) error {
+	var lastErr error
+
+	// Fetch a list of all namespaces for DeleteAllOf requests
+	namespaces := v1.NamespaceList{}
+	pod := &v1.Pod{}
+	if err := c.List(ctx, &namespaces); err != nil {
+		klog.Errorln("Failed to get namespace list:", err)
+		lastErr = err
+	}
+	for _, ns := range namespaces.Items {
+		opts := []client.DeleteAllOfOption{
+			client.InNamespace(ns.Name),
+			client.MatchingFields{"spec.nodeName": nodeName},
+			client.GracePeriodSeconds(gracePeriod),
+			client.PropagationPolicy(metav1.DeletePropagationBackground),
+		}
+		err := c.DeleteAllOf(ctx, pod, opts...)
+		if err != nil {
+			klog.Errorln("Failed to delete pods in namespace", ns.Name, ":", err)
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// DeleteNodeVolumeAttachments removes all volumeattachments from the node and returns the last occurred error.
+func DeleteNodeVolumeAttachments(ctx context.Context, c client.Client, nodeName string) error {
+	var lastErr error
+
+	// Fetch a list of all volumeattachments and delete them
+	volumeattachment := &storagev1.VolumeAttachment{}
+	volumeattachments := storagev1.VolumeAttachmentList{}
+	if err := c.List(ctx, &volumeattachments); err != nil {
+		klog.Errorln("Failed to get volumeattachment list:", err)
+		lastErr = err
+	}
+	for _, va := range volumeattachments.Items {
+		if va.Spec.NodeName == nodeName {
+			opts := []client.DeleteAllOfOption{
+				client.MatchingFields{"metadata.name": va.Name},
+				client.GracePeriodSeconds(0),
+			}
+			err := c.DeleteAllOf(ctx, volumeattachment, opts...)
+			if err != nil {
+				klog.Errorln("Failed to delete volumeattachment", va.Name, ":", err)
+				lastErr = err
+			}
+		}
+	}
+
+	return lastErr
+}
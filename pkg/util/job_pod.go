@@ -0,0 +1,45 @@
+package util
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// JobRestartPolicy returns the restart policy of the job pod created from the podTemplate, Always (the default of pods)
+// is not allowed in Jobs, so it is overridden with Never and overridden is true
+func JobRestartPolicy(podTemplate *v1.PodTemplate) (policy v1.RestartPolicy, overridden bool) {
+	switch policy = podTemplate.Template.Spec.RestartPolicy; policy {
+	case v1.RestartPolicyAlways, "":
+		return v1.RestartPolicyNever, true
+	}
+	return policy, false
+}
+
+// SetJobPodSpec adjusts the pod spec copied from the podTemplate so it can be used in a Job: the restart policy
+// is overridden and the pullSecrets and fencing/pull-secret ones of the podTemplate are added to its image pull secrets
+func SetJobPodSpec(spec *v1.PodSpec, podTemplate *v1.PodTemplate, pullSecrets []string) {
+	// Jobs do not allow restartPolicy Always
+	spec.RestartPolicy, _ = JobRestartPolicy(podTemplate)
+
+	// Add image pull secrets to those of the podTemplate, the node can not attach arbitrary secrets to its job pods
+	names := append([]string{}, pullSecrets...)
+	if v, ok := podTemplate.Annotations["fencing/pull-secret"]; ok {
+		names = append(names, strings.Split(v, ",")...)
+	}
+	for _, name := range names {
+		if name != "" && !hasPullSecret(spec.ImagePullSecrets, name) {
+			spec.ImagePullSecrets = append(spec.ImagePullSecrets, v1.LocalObjectReference{Name: name})
+		}
+	}
+}
+
+// hasPullSecret returns true if the image pull secret is in the list
+func hasPullSecret(secrets []v1.LocalObjectReference, name string) bool {
+	for _, s := range secrets {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
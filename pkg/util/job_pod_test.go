@@ -0,0 +1,54 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestJobRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy     v1.RestartPolicy
+		want       v1.RestartPolicy
+		overridden bool
+	}{
+		{policy: "", want: v1.RestartPolicyNever, overridden: true},
+		{policy: v1.RestartPolicyAlways, want: v1.RestartPolicyNever, overridden: true},
+		{policy: v1.RestartPolicyNever, want: v1.RestartPolicyNever},
+		{policy: v1.RestartPolicyOnFailure, want: v1.RestartPolicyOnFailure},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			podTemplate := &v1.PodTemplate{}
+			podTemplate.Template.Spec.RestartPolicy = tt.policy
+			policy, overridden := JobRestartPolicy(podTemplate)
+			if policy != tt.want || overridden != tt.overridden {
+				t.Errorf("restartPolicy is %s (overridden %v), want %s (overridden %v)", policy, overridden, tt.want, tt.overridden)
+			}
+		})
+	}
+}
+
+func TestSetJobPodSpec(t *testing.T) {
+	podTemplate := &v1.PodTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{"fencing/pull-secret": "registry,agent"},
+		},
+	}
+	podTemplate.Template.Spec.ImagePullSecrets = []v1.LocalObjectReference{{Name: "agent"}}
+	spec := podTemplate.Template.Spec.DeepCopy()
+
+	SetJobPodSpec(spec, podTemplate, []string{"global"})
+	if spec.RestartPolicy != v1.RestartPolicyNever {
+		t.Errorf("restartPolicy is %s, want %s", spec.RestartPolicy, v1.RestartPolicyNever)
+	}
+	want := []v1.LocalObjectReference{{Name: "agent"}, {Name: "global"}, {Name: "registry"}}
+	if !reflect.DeepEqual(spec.ImagePullSecrets, want) {
+		t.Errorf("imagePullSecrets are %v, want %v", spec.ImagePullSecrets, want)
+	}
+	if len(podTemplate.Template.Spec.ImagePullSecrets) != 1 {
+		t.Errorf("imagePullSecrets of the podTemplate are modified: %v", podTemplate.Template.Spec.ImagePullSecrets)
+	}
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TaintNodeOutOfService is the taint key which lets Kubernetes 1.24+ force-detach volumes
+// and delete pods of the shut down node
+const TaintNodeOutOfService = "node.kubernetes.io/out-of-service"
+
+// HasOutOfServiceTaint reports if the node has out-of-service taint
+func HasOutOfServiceTaint(node *v1.Node) bool {
+	for _, t := range node.Spec.Taints {
+		if t.Key == TaintNodeOutOfService {
+			return true
+		}
+	}
+	return false
+}
+
+// TaintOutOfService adds node.kubernetes.io/out-of-service=nodeshutdown:NoExecute taint to the node
+func TaintOutOfService(ctx context.Context, c client.Client, node *v1.Node) error {
+	if HasOutOfServiceTaint(node) {
+		return nil
+	}
+	patch := client.MergeFrom(node.DeepCopy())
+	node.Spec.Taints = append(node.Spec.Taints, v1.Taint{
+		Key:    TaintNodeOutOfService,
+		Value:  "nodeshutdown",
+		Effect: v1.TaintEffectNoExecute,
+	})
+	return c.Patch(ctx, node, patch)
+}
+
+// RemoveOutOfServiceTaint removes out-of-service taint from the node
+func RemoveOutOfServiceTaint(ctx context.Context, c client.Client, node *v1.Node) error {
+	if !HasOutOfServiceTaint(node) {
+		return nil
+	}
+	patch := client.MergeFrom(node.DeepCopy())
+	var taints []v1.Taint
+	for _, t := range node.Spec.Taints {
+		if t.Key != TaintNodeOutOfService {
+			taints = append(taints, t)
+		}
+	}
+	node.Spec.Taints = taints
+	return c.Patch(ctx, node, patch)
+}
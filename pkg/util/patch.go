@@ -0,0 +1,184 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FieldManager is the field manager of the node annotations written by server-side apply
+const FieldManager = "kube-fencing"
+
+// NodePatchType is the patch type used to update node annotations,
+// strategic merge patch can be used if merge patch is mishandled by proxies,
+// apply patch makes the controller own only the fencing annotations it writes
+var NodePatchType = types.MergePatchType
+
+// PatchNodeAnnotations applies the annotations to the node by NodePatchType patch, nil values remove annotations.
+// The patch is conditional on the resourceVersion of the node, so the annotations computed from the stale node
+// are never written: the node is fetched again and the patch is retried on conflict.
+// Patch is skipped if the node has the annotations already.
+func PatchNodeAnnotations(ctx context.Context, c client.Client, node *v1.Node, annotations map[string]interface{}) error {
+	first := true
+	// Cache may lag behind the conflicting update, so the retries are spread
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if !first {
+			if err := c.Get(ctx, types.NamespacedName{Name: node.Name}, node); err != nil {
+				return err
+			}
+		}
+		first = false
+		if annotationsApplied(node, annotations) {
+			return nil
+		}
+		var err error
+		if NodePatchType == types.ApplyPatchType {
+			err = applyNodeAnnotations(ctx, c, node, annotations)
+		} else {
+			err = c.Patch(ctx, node, client.RawPatch(NodePatchType, annotationsPatch(node, annotations)))
+		}
+		if err == nil {
+			removeAnnotations(node, annotations)
+		}
+		return err
+	})
+}
+
+// removeAnnotations deletes the removed annotations from the patched node, the patch response is decoded
+// into the existing annotations map, so the removed keys are kept there
+func removeAnnotations(node *v1.Node, annotations map[string]interface{}) {
+	for k, v := range annotations {
+		if v == nil {
+			delete(node.Annotations, k)
+		}
+	}
+}
+
+// annotationsApplied returns true if the node has all the annotations with the same values and has no removed ones
+func annotationsApplied(node *v1.Node, annotations map[string]interface{}) bool {
+	for k, v := range annotations {
+		current, ok := node.Annotations[k]
+		if v == nil {
+			if ok {
+				return false
+			}
+			continue
+		}
+		if s, isString := v.(string); !isString || !ok || current != s {
+			return false
+		}
+	}
+	return true
+}
+
+// applyNodeAnnotations writes the annotations of the node by server-side apply with FieldManager.
+// Apply configuration contains only the annotations applied by the controller before and the written ones,
+// so the annotations of other managers such as fencing/enabled are never taken over. The written annotations
+// owned by other managers with different values are updated by merge patch instead of forcing the ownership,
+// and the removed annotations co-owned by other managers are deleted by merge patch.
+func applyNodeAnnotations(ctx context.Context, c client.Client, node *v1.Node, annotations map[string]interface{}) error {
+	desired := map[string]interface{}{}
+	for _, k := range appliedAnnotations(node) {
+		if v, ok := node.Annotations[k]; ok {
+			desired[k] = v
+		}
+	}
+	removed := map[string]interface{}{}
+	for k, v := range annotations {
+		if v == nil {
+			delete(desired, k)
+			removed[k] = nil
+			continue
+		}
+		desired[k] = v
+	}
+	metadata := map[string]interface{}{
+		"name":        node.Name,
+		"annotations": desired,
+	}
+	if node.ResourceVersion != "" {
+		metadata["resourceVersion"] = node.ResourceVersion
+	}
+	applyPatch, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Node",
+		"metadata":   metadata,
+	})
+	err := c.Patch(ctx, node, client.RawPatch(types.ApplyPatchType, applyPatch), client.FieldOwner(FieldManager))
+	if fieldManagerConflict(err) {
+		return c.Patch(ctx, node, client.RawPatch(types.MergePatchType, annotationsPatch(node, annotations)), client.FieldOwner(FieldManager))
+	}
+	if err != nil {
+		return err
+	}
+
+	// Remove the annotations still owned by other managers
+	for k := range removed {
+		if _, ok := node.Annotations[k]; !ok {
+			delete(removed, k)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	return c.Patch(ctx, node, client.RawPatch(types.MergePatchType, annotationsPatch(node, removed)))
+}
+
+// annotationsPatch returns the merge patch of the node annotations conditional on the resourceVersion of the node
+func annotationsPatch(node *v1.Node, annotations map[string]interface{}) []byte {
+	metadata := map[string]interface{}{
+		"annotations": annotations,
+	}
+	if node.ResourceVersion != "" {
+		metadata["resourceVersion"] = node.ResourceVersion
+	}
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": metadata,
+	})
+	return patch
+}
+
+// appliedAnnotations returns the annotations of the node owned by FieldManager through server-side apply
+func appliedAnnotations(node *v1.Node) []string {
+	var keys []string
+	for _, entry := range node.ManagedFields {
+		if entry.Manager != FieldManager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		fields := struct {
+			Metadata struct {
+				Annotations map[string]json.RawMessage `json:"f:annotations"`
+			} `json:"f:metadata"`
+		}{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		for k := range fields.Metadata.Annotations {
+			if strings.HasPrefix(k, "f:") {
+				keys = append(keys, strings.TrimPrefix(k, "f:"))
+			}
+		}
+	}
+	return keys
+}
+
+// fieldManagerConflict returns true if the apply failed because other managers own the fields with different values
+func fieldManagerConflict(err error) bool {
+	status, ok := err.(errors.APIStatus)
+	if !ok || !errors.IsConflict(err) || status.Status().Details == nil {
+		return false
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type == metav1.CauseTypeFieldManagerConflict {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,326 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// recordedPatch is the patch sent by patchClient
+type recordedPatch struct {
+	patchType types.PatchType
+	data      map[string]interface{}
+}
+
+// patchClient records the patches and fails them with errs in order before passing them to the fake client
+type patchClient struct {
+	client.Client
+	errs    []error
+	patches []recordedPatch
+	gets    int
+}
+
+func (c *patchClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	c.gets++
+	return c.Client.Get(ctx, key, obj)
+}
+
+func (c *patchClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	raw, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return err
+	}
+	c.patches = append(c.patches, recordedPatch{patchType: patch.Type(), data: data})
+	if len(c.errs) > 0 {
+		err, c.errs = c.errs[0], c.errs[1:]
+		return err
+	}
+	if patch.Type() == types.ApplyPatchType {
+		// Fake client does not support server-side apply, the owned annotations left out of apply configuration are removed
+		node := obj.(*v1.Node)
+		annotations := map[string]interface{}{}
+		for k, v := range data["metadata"].(map[string]interface{})["annotations"].(map[string]interface{}) {
+			annotations[k] = v
+		}
+		for _, k := range appliedAnnotations(node) {
+			if _, ok := annotations[k]; !ok {
+				annotations[k] = nil
+			}
+		}
+		merge, _ := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+		// Apply returns the whole node, so the removed annotations don't stay in the decoded object
+		applied := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: node.Name}}
+		if err := c.Client.Patch(ctx, applied, client.RawPatch(types.MergePatchType, merge), opts...); err != nil {
+			return err
+		}
+		*node = *applied
+		return nil
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+// newPatchClient returns the patchClient with the node
+func newPatchClient(node *v1.Node, errs ...error) *patchClient {
+	return &patchClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, node.DeepCopy()), errs: errs}
+}
+
+// newPatchNode returns the node with the copy of annotations
+func newPatchNode(annotations map[string]string) *v1.Node {
+	a := map[string]string{}
+	for k, v := range annotations {
+		a[k] = v
+	}
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", ResourceVersion: "1", Annotations: a}}
+}
+
+// getNode returns the node stored by the client
+func getNode(t *testing.T, c client.Client) *v1.Node {
+	node := &v1.Node{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: "node1"}, node); err != nil {
+		t.Fatalf("get node failed: %v", err)
+	}
+	return node
+}
+
+func TestPatchNodeAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		node        map[string]string
+		annotations map[string]interface{}
+		want        map[string]string
+		patches     int
+	}{
+		{name: "set annotations", node: map[string]string{"fencing/enabled": "true"},
+			annotations: map[string]interface{}{"fencing/state": "started"},
+			want:        map[string]string{"fencing/enabled": "true", "fencing/state": "started"}, patches: 1},
+		{name: "remove annotations", node: map[string]string{"fencing/enabled": "true", "fencing/state": "fenced"},
+			annotations: map[string]interface{}{"fencing/state": nil},
+			want:        map[string]string{"fencing/enabled": "true"}, patches: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newPatchNode(tt.node)
+			c := newPatchClient(node)
+			if err := PatchNodeAnnotations(context.TODO(), c, node, tt.annotations); err != nil {
+				t.Fatalf("patch failed: %v", err)
+			}
+			if len(c.patches) != tt.patches {
+				t.Errorf("node is patched %d times, want %d", len(c.patches), tt.patches)
+			}
+			if got := getNode(t, c).Annotations; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("annotations are %v, want %v", got, tt.want)
+			}
+			// The patched node is used by the caller afterwards
+			if !reflect.DeepEqual(node.Annotations, tt.want) {
+				t.Errorf("patched node annotations are %v, want %v", node.Annotations, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodePatchType(t *testing.T) {
+	defer func(patchType types.PatchType) {
+		NodePatchType = patchType
+	}(NodePatchType)
+
+	for _, patchType := range []types.PatchType{types.MergePatchType, types.StrategicMergePatchType, types.ApplyPatchType} {
+		t.Run(string(patchType), func(t *testing.T) {
+			NodePatchType = patchType
+			node := newPatchNode(map[string]string{"fencing/enabled": "true"})
+			c := newPatchClient(node)
+			if err := PatchNodeAnnotations(context.TODO(), c, node, map[string]interface{}{"fencing/state": "started"}); err != nil {
+				t.Fatalf("patch failed: %v", err)
+			}
+			if len(c.patches) != 1 {
+				t.Fatalf("node is patched %d times, want 1", len(c.patches))
+			}
+			if c.patches[0].patchType != patchType {
+				t.Errorf("patch type is %s, want %s", c.patches[0].patchType, patchType)
+			}
+			want := map[string]string{"fencing/enabled": "true", "fencing/state": "started"}
+			if got := getNode(t, c).Annotations; !reflect.DeepEqual(got, want) {
+				t.Errorf("annotations are %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPatchNodeAnnotationsApplied(t *testing.T) {
+	defer func(patchType types.PatchType) {
+		NodePatchType = patchType
+	}(NodePatchType)
+
+	for _, patchType := range []types.PatchType{types.MergePatchType, types.StrategicMergePatchType, types.ApplyPatchType} {
+		t.Run(string(patchType), func(t *testing.T) {
+			NodePatchType = patchType
+			node := newPatchNode(map[string]string{"fencing/state": "started"})
+			c := newPatchClient(node)
+			annotations := map[string]interface{}{"fencing/state": "started", "fencing/last-error": nil}
+			if err := PatchNodeAnnotations(context.TODO(), c, node, annotations); err != nil {
+				t.Fatalf("patch failed: %v", err)
+			}
+			if len(c.patches) != 0 || c.gets != 0 {
+				t.Errorf("node is patched %d times after %d gets, want no patches", len(c.patches), c.gets)
+			}
+		})
+	}
+}
+
+func TestPatchNodeAnnotationsConflict(t *testing.T) {
+	conflict := errors.NewConflict(schema.GroupResource{Resource: "nodes"}, "node1", nil)
+	stale := newPatchNode(map[string]string{"fencing/enabled": "true"})
+	c := newPatchClient(stale, conflict)
+
+	// The node is changed since the patch was computed
+	current := getNode(t, c)
+	current.Annotations["fencing/enabled"] = "false"
+	if err := c.Client.Update(context.TODO(), current); err != nil {
+		t.Fatalf("update node failed: %v", err)
+	}
+	c.gets = 0
+
+	err := PatchNodeAnnotations(context.TODO(), c, stale, map[string]interface{}{"fencing/state": "started"})
+	if err != nil {
+		t.Fatalf("patch failed: %v", err)
+	}
+	if len(c.patches) != 2 || c.gets != 1 {
+		t.Fatalf("node is patched %d times after %d gets, want 2 patches after 1 get", len(c.patches), c.gets)
+	}
+	metadata := c.patches[0].data["metadata"].(map[string]interface{})
+	if metadata["resourceVersion"] != "1" {
+		t.Errorf("patch is conditional on resourceVersion %v, want 1", metadata["resourceVersion"])
+	}
+	metadata = c.patches[1].data["metadata"].(map[string]interface{})
+	if metadata["resourceVersion"] != current.ResourceVersion {
+		t.Errorf("retry is conditional on resourceVersion %v, want %s", metadata["resourceVersion"], current.ResourceVersion)
+	}
+	want := map[string]string{"fencing/enabled": "false", "fencing/state": "started"}
+	if got := getNode(t, c).Annotations; !reflect.DeepEqual(got, want) {
+		t.Errorf("annotations are %v, want %v", got, want)
+	}
+}
+
+// appliedEntry returns the managed fields entry of FieldManager applying the annotations
+func appliedEntry(manager string, keys ...string) metav1.ManagedFieldsEntry {
+	annotations := map[string]interface{}{}
+	for _, k := range keys {
+		annotations["f:"+k] = map[string]interface{}{}
+	}
+	raw, _ := json.Marshal(map[string]interface{}{
+		"f:metadata": map[string]interface{}{"f:annotations": annotations},
+	})
+	return metav1.ManagedFieldsEntry{
+		Manager:   manager,
+		Operation: metav1.ManagedFieldsOperationApply,
+		FieldsV1:  &metav1.FieldsV1{Raw: raw},
+	}
+}
+
+func TestAppliedAnnotations(t *testing.T) {
+	node := newPatchNode(nil)
+	node.ManagedFields = []metav1.ManagedFieldsEntry{
+		appliedEntry(FieldManager, "fencing/state"),
+		appliedEntry("kubectl", "fencing/enabled"),
+		{Manager: FieldManager, Operation: metav1.ManagedFieldsOperationUpdate, FieldsV1: appliedEntry(FieldManager, "fencing/mode").FieldsV1},
+		{Manager: FieldManager, Operation: metav1.ManagedFieldsOperationApply, FieldsV1: &metav1.FieldsV1{Raw: []byte("invalid")}},
+	}
+	if keys := appliedAnnotations(node); !reflect.DeepEqual(keys, []string{"fencing/state"}) {
+		t.Errorf("applied annotations are %v, want [fencing/state]", keys)
+	}
+}
+
+func TestApplyNodeAnnotations(t *testing.T) {
+	defer func(patchType types.PatchType) {
+		NodePatchType = patchType
+	}(NodePatchType)
+	NodePatchType = types.ApplyPatchType
+
+	fieldConflict := &errors.StatusError{ErrStatus: metav1.Status{
+		Status: metav1.StatusFailure,
+		Reason: metav1.StatusReasonConflict,
+		Code:   409,
+		Details: &metav1.StatusDetails{Causes: []metav1.StatusCause{
+			{Type: metav1.CauseTypeFieldManagerConflict, Field: ".metadata.annotations.fencing/state"},
+		}},
+	}}
+	tests := []struct {
+		name        string
+		annotations map[string]interface{}
+		errs        []error
+		applied     map[string]interface{}
+		merged      []map[string]interface{}
+	}{
+		{
+			name:        "owned annotations are kept in apply configuration",
+			annotations: map[string]interface{}{"fencing/attempts": "1"},
+			applied:     map[string]interface{}{"fencing/state": "started", "fencing/attempts": "1"},
+		},
+		{
+			name:        "removed owned annotations are left out of apply configuration",
+			annotations: map[string]interface{}{"fencing/state": nil},
+			applied:     map[string]interface{}{},
+		},
+		{
+			name:        "removed annotations of other managers are deleted by merge patch",
+			annotations: map[string]interface{}{"fencing/enabled": nil},
+			applied:     map[string]interface{}{"fencing/state": "started"},
+			merged:      []map[string]interface{}{{"fencing/enabled": nil}},
+		},
+		{
+			name:        "annotations owned by other managers are updated by merge patch",
+			annotations: map[string]interface{}{"fencing/state": "fenced"},
+			errs:        []error{fieldConflict},
+			applied:     map[string]interface{}{"fencing/state": "fenced"},
+			merged:      []map[string]interface{}{{"fencing/state": "fenced"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newPatchNode(map[string]string{"fencing/enabled": "true", "fencing/state": "started"})
+			node.ManagedFields = []metav1.ManagedFieldsEntry{appliedEntry(FieldManager, "fencing/state")}
+			c := newPatchClient(node, tt.errs...)
+			if err := PatchNodeAnnotations(context.TODO(), c, node, tt.annotations); err != nil {
+				t.Fatalf("patch failed: %v", err)
+			}
+			if len(c.patches) != 1+len(tt.merged) {
+				t.Fatalf("node is patched %d times, want %d", len(c.patches), 1+len(tt.merged))
+			}
+			apply := c.patches[0]
+			if apply.patchType != types.ApplyPatchType {
+				t.Fatalf("first patch type is %s, want apply", apply.patchType)
+			}
+			metadata := apply.data["metadata"].(map[string]interface{})
+			if !reflect.DeepEqual(metadata["annotations"], tt.applied) {
+				t.Errorf("applied annotations are %v, want %v", metadata["annotations"], tt.applied)
+			}
+			if metadata["resourceVersion"] != "1" {
+				t.Errorf("apply is conditional on resourceVersion %v, want 1", metadata["resourceVersion"])
+			}
+			for i, want := range tt.merged {
+				p := c.patches[i+1]
+				if p.patchType != types.MergePatchType {
+					t.Errorf("patch type is %s, want merge", p.patchType)
+				}
+				metadata := p.data["metadata"].(map[string]interface{})
+				if !reflect.DeepEqual(metadata["annotations"], want) {
+					t.Errorf("merged annotations are %v, want %v", metadata["annotations"], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PostFenceWait returns the remaining time to wait for the fenced node to rejoin before declaring it fenced.
+// The wait is counted from fencing/fenced-at annotation, which is set on the first call.
+func PostFenceWait(ctx context.Context, c client.Client, node *v1.Node, wait time.Duration) (time.Duration, error) {
+	if wait <= 0 {
+		return 0, nil
+	}
+	fencedAt, err := strconv.ParseInt(node.Annotations["fencing/fenced-at"], 10, 64)
+	if err != nil {
+		// Record the time when fencing succeeded
+		fencedAt = time.Now().Unix()
+		err := PatchNodeAnnotations(ctx, c, node, map[string]interface{}{
+			"fencing/fenced-at": strconv.FormatInt(fencedAt, 10),
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	if remainTime := time.Until(time.Unix(fencedAt, 0).Add(wait)); remainTime > 0 {
+		return remainTime, nil
+	}
+	return 0, nil
+}
+
+// NodeReady returns true if the node has Ready condition with True status
+func NodeReady(node *v1.Node) bool {
+	_, c := GetNodeCondition(&node.Status, v1.NodeReady)
+	return c != nil && c.Status == v1.ConditionTrue
+}
@@ -0,0 +1,112 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NodePodOwners returns the controllers owning the pods on the node formatted as namespace/Kind/name
+func NodePodOwners(cs kubernetes.Interface, nodeName string) ([]string, error) {
+	pods, err := cs.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var owners []string
+	for _, pod := range pods.Items {
+		ref := metav1.GetControllerOf(&pod)
+		// DaemonSet pods are never rescheduled to other nodes
+		if ref == nil || ref.Kind == "DaemonSet" {
+			continue
+		}
+		owner := pod.Namespace + "/" + ref.Kind + "/" + ref.Name
+		if !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+	return owners, nil
+}
+
+// CountWorkloadPods returns the number of running pods on the node, except DaemonSet and static ones
+func CountWorkloadPods(cs kubernetes.Interface, nodeName string) (int, error) {
+	pods, err := cs.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if _, ok := pod.Annotations[v1.MirrorPodAnnotationKey]; ok {
+			continue
+		}
+		if ref := metav1.GetControllerOf(&pod); ref != nil && ref.Kind == "DaemonSet" {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// PendingOwners returns the owners which have no pods created since the fencing start and scheduled
+// to other nodes than nodeName, the pods existed before are not replacements of the fenced ones
+func PendingOwners(cs kubernetes.Interface, nodeName string, owners []string, since time.Time) ([]string, error) {
+	list, err := cs.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	rescheduled := map[string]bool{}
+	for i := range list.Items {
+		pod := &list.Items[i]
+		ref := metav1.GetControllerOf(pod)
+		if ref == nil || pod.DeletionTimestamp != nil || pod.CreationTimestamp.Time.Before(since) {
+			continue
+		}
+		if pod.Spec.NodeName != "" && pod.Spec.NodeName != nodeName {
+			rescheduled[pod.Namespace+"/"+ref.Kind+"/"+ref.Name] = true
+		}
+	}
+	var pending []string
+	for _, owner := range owners {
+		if strings.Count(owner, "/") < 2 {
+			continue
+		}
+		if !rescheduled[owner] {
+			pending = append(pending, owner)
+		}
+	}
+	return pending, nil
+}
+
+// RescheduleAnnotations collects the workloads on the node to confirm their rescheduling after fencing,
+// it returns the node annotations to track them, or nil if fencing/reschedule-timeout is not set
+func RescheduleAnnotations(cs kubernetes.Interface, nodeName string, annotations map[string]string) (map[string]interface{}, error) {
+	v, ok := annotations["fencing/reschedule-timeout"]
+	if !ok {
+		return nil, nil
+	}
+	timeout, err := ParseDuration(v)
+	if err != nil || timeout <= 0 {
+		return nil, err
+	}
+	owners, err := NodePodOwners(cs, nodeName)
+	if err != nil || len(owners) == 0 {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"fencing/reschedule-owners":   strings.Join(owners, ","),
+		"fencing/reschedule-deadline": strconv.FormatInt(time.Now().Add(timeout).Unix(), 10),
+	}, nil
+}
@@ -0,0 +1,124 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+// newOwnedPod returns the pod owned by the ReplicaSet, created the given time ago on the node
+func newOwnedPod(name, namespace, owner, nodeName string, ago time.Duration) *v1.Pod {
+	controller := true
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-ago)),
+			OwnerReferences:   []metav1.OwnerReference{{Kind: "ReplicaSet", Name: owner, Controller: &controller}},
+		},
+		Spec: v1.PodSpec{NodeName: nodeName},
+	}
+}
+
+func TestPendingOwners(t *testing.T) {
+	terminating := newOwnedPod("web-2", "default", "web", "node2", time.Second)
+	now := metav1.Now()
+	terminating.DeletionTimestamp = &now
+
+	since := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name    string
+		pods    []*v1.Pod
+		pending []string
+	}{
+		{name: "replacement is created on other node", pods: []*v1.Pod{newOwnedPod("web-2", "default", "web", "node2", time.Second)}},
+		{name: "pod existed before fencing is not replacement", pods: []*v1.Pod{newOwnedPod("web-2", "default", "web", "node2", time.Hour)}, pending: []string{"default/ReplicaSet/web"}},
+		{name: "replacement is created on fenced node", pods: []*v1.Pod{newOwnedPod("web-2", "default", "web", "node1", time.Second)}, pending: []string{"default/ReplicaSet/web"}},
+		{name: "replacement is not scheduled", pods: []*v1.Pod{newOwnedPod("web-2", "default", "web", "", time.Second)}, pending: []string{"default/ReplicaSet/web"}},
+		{name: "replacement is terminating", pods: []*v1.Pod{terminating}, pending: []string{"default/ReplicaSet/web"}},
+		{name: "replacement is in other namespace", pods: []*v1.Pod{newOwnedPod("web-2", "other", "web", "node2", time.Second)}, pending: []string{"default/ReplicaSet/web"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := k8sfake.NewSimpleClientset()
+			for _, pod := range tt.pods {
+				cs.Tracker().Add(pod)
+			}
+			pending, err := PendingOwners(cs, "node1", []string{"default/ReplicaSet/web"}, since)
+			if err != nil {
+				t.Fatalf("pending owners failed: %v", err)
+			}
+			if !reflect.DeepEqual(pending, tt.pending) {
+				t.Errorf("pending owners are %v, want %v", pending, tt.pending)
+			}
+		})
+	}
+}
+
+func TestPendingOwnersListsPodsOnce(t *testing.T) {
+	cs := k8sfake.NewSimpleClientset(
+		newOwnedPod("web-2", "default", "web", "node2", time.Second),
+		newOwnedPod("db-2", "db", "db", "node2", time.Second),
+	)
+	owners := []string{"default/ReplicaSet/web", "db/ReplicaSet/db", "cache/ReplicaSet/cache"}
+	pending, err := PendingOwners(cs, "node1", owners, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("pending owners failed: %v", err)
+	}
+	if !reflect.DeepEqual(pending, []string{"cache/ReplicaSet/cache"}) {
+		t.Errorf("pending owners are %v, want [cache/ReplicaSet/cache]", pending)
+	}
+	lists := 0
+	for _, action := range cs.Actions() {
+		if action.GetVerb() == "list" {
+			lists++
+		}
+	}
+	if lists != 1 {
+		t.Errorf("pods are listed %d times, want once", lists)
+	}
+}
+
+func TestCountWorkloadPods(t *testing.T) {
+	controller := true
+	daemon := newOwnedPod("agent", "kube-system", "agent", "node1", time.Hour)
+	daemon.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "agent", Controller: &controller}}
+	mirror := newOwnedPod("etcd", "kube-system", "", "node1", time.Hour)
+	mirror.OwnerReferences = nil
+	mirror.Annotations = map[string]string{v1.MirrorPodAnnotationKey: "hash"}
+	finished := newOwnedPod("backup", "default", "backup", "node1", time.Hour)
+	finished.Status.Phase = v1.PodSucceeded
+	bare := newOwnedPod("debug", "default", "", "node1", time.Hour)
+	bare.OwnerReferences = nil
+
+	tests := []struct {
+		name  string
+		pods  []*v1.Pod
+		count int
+	}{
+		{name: "no pods"},
+		{name: "only daemon, mirror and finished pods", pods: []*v1.Pod{daemon, mirror, finished}},
+		{name: "workload pods", pods: []*v1.Pod{daemon, newOwnedPod("web-1", "default", "web", "node1", time.Hour), bare}, count: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := k8sfake.NewSimpleClientset()
+			for _, pod := range tt.pods {
+				if err := cs.Tracker().Add(pod); err != nil {
+					t.Fatal(err)
+				}
+			}
+			count, err := CountWorkloadPods(cs, "node1")
+			if err != nil {
+				t.Fatalf("count failed: %v", err)
+			}
+			if count != tt.count {
+				t.Errorf("workload pods count is %d, want %d", count, tt.count)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package util
 
 import (
+	"strconv"
+	"time"
+
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 )
@@ -32,3 +35,25 @@ func GetJobCondition(status *batchv1.JobStatus, conditionType batchv1.JobConditi
 	}
 	return -1, nil
 }
+
+// GetJobFailureReason returns the reason and message of the failed condition of the job.
+// Returns empty string if the job is not failed.
+func GetJobFailureReason(status *batchv1.JobStatus) string {
+	_, c := GetJobCondition(status, batchv1.JobFailed)
+	if c == nil {
+		return ""
+	}
+	if c.Message == "" {
+		return c.Reason
+	}
+	return c.Reason + ": " + c.Message
+}
+
+// ParseDuration parses a Go duration string like "2m" or "90s",
+// bare integers are interpreted as seconds for backward compatibility.
+func ParseDuration(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
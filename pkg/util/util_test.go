@@ -0,0 +1,40 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s        string
+		duration time.Duration
+		invalid  bool
+	}{
+		{s: "90", duration: 90 * time.Second},
+		{s: "0", duration: 0},
+		{s: "2m", duration: 2 * time.Minute},
+		{s: "1m30s", duration: 90 * time.Second},
+		{s: "500ms", duration: 500 * time.Millisecond},
+		{s: "", invalid: true},
+		{s: "soon", invalid: true},
+		{s: "10 minutes", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			duration, err := ParseDuration(tt.s)
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("invalid duration is parsed as %v", duration)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			if duration != tt.duration {
+				t.Errorf("duration is %v, want %v", duration, tt.duration)
+			}
+		})
+	}
+}
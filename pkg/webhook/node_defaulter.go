@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// NodeDefaulterPath is the path serving the node defaulting webhook
+const NodeDefaulterPath = "/mutate-v1-node"
+
+var (
+	// NodeSelector selects the nodes which get the default annotations
+	NodeSelector = labels.Everything()
+	// DefaultAnnotations are the fencing annotations added to selected nodes on creation
+	DefaultAnnotations map[string]string
+)
+
+// Add registers the node defaulting webhook in the Manager webhook server
+func Add(mgr manager.Manager) error {
+	mgr.GetWebhookServer().Register(NodeDefaulterPath, &admission.Webhook{Handler: &nodeDefaulter{}})
+	return nil
+}
+
+// nodeDefaulter stamps default fencing annotations onto the nodes
+type nodeDefaulter struct{}
+
+// Handle adds missing default annotations to the node matching NodeSelector
+func (d *nodeDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	node := &v1.Node{}
+	if err := json.Unmarshal(req.Object.Raw, node); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !NodeSelector.Matches(labels.Set(node.Labels)) {
+		return admission.Allowed("node does not match the selector")
+	}
+
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	for k, v := range DefaultAnnotations {
+		if _, ok := node.Annotations[k]; !ok {
+			node.Annotations[k] = v
+		}
+	}
+
+	marshaled, err := json.Marshal(node)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	klog.Infoln("Defaulting fencing annotations for node", node.Name)
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// patchedAnnotations returns the annotations added by the response patches
+func patchedAnnotations(resp admission.Response) map[string]string {
+	added := map[string]string{}
+	for _, op := range resp.Patches {
+		switch {
+		case op.Path == "/metadata/annotations":
+			for k, v := range op.Value.(map[string]interface{}) {
+				added[k] = v.(string)
+			}
+		case strings.HasPrefix(op.Path, "/metadata/annotations/"):
+			k := strings.TrimPrefix(op.Path, "/metadata/annotations/")
+			added[strings.Replace(strings.Replace(k, "~1", "/", -1), "~0", "~", -1)] = op.Value.(string)
+		}
+	}
+	return added
+}
+
+func TestNodeDefaulter(t *testing.T) {
+	defer func(selector labels.Selector, annotations map[string]string) {
+		NodeSelector, DefaultAnnotations = selector, annotations
+	}(NodeSelector, DefaultAnnotations)
+	DefaultAnnotations = map[string]string{"fencing/enabled": "true", "fencing/template": "ipmi"}
+
+	tests := []struct {
+		name        string
+		selector    string
+		labels      map[string]string
+		annotations map[string]string
+		added       map[string]string
+	}{
+		{name: "node without annotations", added: map[string]string{"fencing/enabled": "true", "fencing/template": "ipmi"}},
+		{name: "existing annotations are kept", annotations: map[string]string{"fencing/enabled": "false"}, added: map[string]string{"fencing/template": "ipmi"}},
+		{name: "node matching selector", selector: "node-role.kubernetes.io/worker", labels: map[string]string{"node-role.kubernetes.io/worker": ""},
+			added: map[string]string{"fencing/enabled": "true", "fencing/template": "ipmi"}},
+		{name: "node not matching selector", selector: "node-role.kubernetes.io/worker", added: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			NodeSelector = labels.Everything()
+			if tt.selector != "" {
+				selector, err := labels.Parse(tt.selector)
+				if err != nil {
+					t.Fatalf("parse selector failed: %v", err)
+				}
+				NodeSelector = selector
+			}
+			raw, _ := json.Marshal(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: tt.labels, Annotations: tt.annotations}})
+			resp := (&nodeDefaulter{}).Handle(context.TODO(), admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Operation: admissionv1beta1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+			if !resp.Allowed {
+				t.Fatalf("node is not allowed: %v", resp.Result)
+			}
+			if added := patchedAnnotations(resp); !reflect.DeepEqual(added, tt.added) {
+				t.Errorf("added annotations are %v, want %v", added, tt.added)
+			}
+		})
+	}
+}
+
+func TestNodeDefaulterInvalidObject(t *testing.T) {
+	resp := (&nodeDefaulter{}).Handle(context.TODO(), admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Object: runtime.RawExtension{Raw: []byte("not a node")},
+	}})
+	if resp.Allowed || resp.Result == nil || resp.Result.Code != 400 {
+		t.Errorf("invalid object response is %+v, want bad request", resp.AdmissionResponse)
+	}
+}